@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,6 +12,7 @@ import (
 	"github.com/jos3lo89/library-api/internal/repositories"
 	"github.com/jos3lo89/library-api/internal/routes"
 	"github.com/jos3lo89/library-api/internal/services"
+	"github.com/jos3lo89/library-api/pkg/utils"
 )
 
 func main() {
@@ -18,8 +20,17 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	if cfg.JWTSecret == "" {
-		log.Fatal("JWT_SECRET is required")
+	if cfg.SigningKeyEncryptionKey == "" {
+		log.Fatal("SIGNING_KEY_ENCRYPTION_KEY is required")
+	}
+	if cfg.CSRFSecret == "" {
+		log.Fatal("CSRF_SECRET is required")
+	}
+	if cfg.TOTPEncryptionKey == "" {
+		log.Fatal("TOTP_ENCRYPTION_KEY is required")
+	}
+	if cfg.SigningKeyEncryptionKey == cfg.CSRFSecret || cfg.SigningKeyEncryptionKey == cfg.TOTPEncryptionKey || cfg.CSRFSecret == cfg.TOTPEncryptionKey {
+		log.Fatal("SIGNING_KEY_ENCRYPTION_KEY, CSRF_SECRET and TOTP_ENCRYPTION_KEY must be different")
 	}
 
 	db, err := config.ConnectDatabase(cfg)
@@ -29,37 +40,148 @@ func main() {
 
 	if err := db.AutoMigrate(
 		&models.User{},
+		&models.PendingRegistration{},
+		&models.RegistrationInvite{},
+		&models.SigningKey{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.OIDCLoginState{},
+		&models.ServiceAccount{},
+		&models.APIKey{},
+		&models.LoginThrottle{},
+		&models.AuthAuditLog{},
 		&models.AcademicPeriod{},
+		&models.PendingEnrollment{},
 		&models.Enrollment{},
 		&models.Category{},
+		&models.CategorySlugRedirect{},
 		&models.Book{},
+		&models.BookAsset{},
 		&models.Review{},
+		&models.OutboxEmail{},
+		&models.Course{},
+		&models.CourseReserve{},
+		&models.AccessRule{},
+		&models.MetadataCache{},
+		&models.Author{},
+		&models.AuthorVariant{},
+		&models.BookAuthor{},
+		&models.Tag{},
+		&models.ReadingList{},
+		&models.ReadingListItem{},
+		&models.Suggestion{},
+		&models.SuggestionVote{},
 	); err != nil {
 		log.Fatal(err)
 	}
 
+	dniFormat, err := services.NewDNIFormat(cfg.DNIPattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	userRepo := repositories.NewUserRepository(db)
 	bookRepo := repositories.NewBookRepository(db)
 
-	authService := services.NewAuthService(userRepo, cfg.JWTSecret)
-	userService := services.NewUserService(db)
+	mailTransport, err := services.NewMailTransport(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailService, err := services.NewMailService(db, mailTransport, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	resetDelivery, err := services.NewResetDelivery(cfg, mailService)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signingKeyService, err := services.NewSigningKeyService(db, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := signingKeyService.Maintain(); err != nil {
+		log.Fatal(err)
+	}
+	tokens := &utils.TokenSettings{Keys: signingKeyService, Issuer: cfg.JWTIssuer, Audience: cfg.JWTAudience}
+
+	loginGuard := services.NewLoginGuard(db, cfg)
+	twoFactorService := services.NewTwoFactorService(db, cfg)
+	oidcService := services.NewOIDCService(db, mailService, cfg)
+	verifiers, err := services.NewCredentialVerifiers(cfg, userRepo, mailService)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService := services.NewAuthService(userRepo, mailService, resetDelivery, loginGuard, twoFactorService, verifiers, tokens, cfg)
+	userService := services.NewUserService(db, mailService, dniFormat)
 	bookService := services.NewBookService(bookRepo)
 	categoryService := services.NewCategoryService(db)
-	enrollmentService := services.NewEnrollmentService(db)
+	enrollmentService := services.NewEnrollmentService(db, dniFormat)
+	registrationService, err := services.NewRegistrationService(db, userRepo, mailService, enrollmentService, dniFormat, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 	periodService := services.NewPeriodService(db)
-	reviewService := services.NewReviewService(db)
+	courseService := services.NewCourseService(db)
+	policyService := services.NewPolicyService(db)
+	assetService := services.NewAssetService(db)
+	authorService := services.NewAuthorService(db)
+	suggestionService := services.NewSuggestionService(db, mailService)
+	catalogService := services.NewCatalogExchangeService(db, authorService, suggestionService)
+	tagService := services.NewTagService(db)
+	readingListService := services.NewReadingListService(db)
+	serviceAccountService := services.NewServiceAccountService(db)
+	if err := assetService.MigrateLegacy(); err != nil {
+		log.Fatal(err)
+	}
+	if err := authorService.MigrateLegacy(); err != nil {
+		log.Fatal(err)
+	}
+	if err := twoFactorService.MigrateLegacy(); err != nil {
+		log.Fatal(err)
+	}
+	reviewHub := services.NewReviewHub(db, cfg.DatabaseDSN())
+	reviewService := services.NewReviewService(db, reviewHub)
+	if err := reviewService.RefreshRatings(); err != nil {
+		log.Fatal(err)
+	}
 
 	s3Service, err := services.NewS3Service(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	authHandler := handlers.NewAuthHandler(authService, cfg)
+	metadataProviders, err := services.NewMetadataProviders(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metadataService := services.NewMetadataService(db, metadataProviders, cfg.MetadataCacheTTL)
+
+	authHandler := handlers.NewAuthHandler(authService, twoFactorService, oidcService, registrationService, cfg)
 	userHandler := handlers.NewUserHandler(userService)
 	categoryHandler := handlers.NewCategoryHandler(categoryService)
-	bookHandler := handlers.NewBookHandler(bookService, s3Service, enrollmentService, periodService, reviewService, cfg)
+	bookHandler := handlers.NewBookHandler(bookService, s3Service, enrollmentService, periodService, reviewService, reviewHub, policyService, assetService, authorService, tagService, readingListService, suggestionService, cfg)
 	enrollmentHandler := handlers.NewEnrollmentHandler(enrollmentService)
 	periodHandler := handlers.NewPeriodHandler(periodService)
+	mailHandler := handlers.NewMailHandler(mailService)
+	courseHandler := handlers.NewCourseHandler(courseService, enrollmentService, periodService)
+	policyHandler := handlers.NewPolicyHandler(policyService, bookService, userService, enrollmentService, periodService)
+	catalogHandler := handlers.NewCatalogHandler(catalogService)
+	metadataHandler := handlers.NewMetadataHandler(metadataService)
+	authorHandler := handlers.NewAuthorHandler(authorService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	readingListHandler := handlers.NewReadingListHandler(readingListService)
+	suggestionHandler := handlers.NewSuggestionHandler(suggestionService, enrollmentService, periodService)
+	loginGuardHandler := handlers.NewLoginGuardHandler(loginGuard)
+	serviceAccountHandler := handlers.NewServiceAccountHandler(serviceAccountService)
+	signingKeyHandler := handlers.NewSigningKeyHandler(signingKeyService)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+	opdsHandler := handlers.NewOPDSHandler(bookService, categoryService, assetService, enrollmentService, periodService, policyService, s3Service)
+
+	go mailService.RunDispatcher(context.Background())
+	go reviewHub.Listen(context.Background())
+	go signingKeyService.RunRotation(context.Background())
 
 	app := fiber.New()
 
@@ -70,7 +192,38 @@ func main() {
 		Categories:  categoryHandler,
 		Enrollments: enrollmentHandler,
 		Periods:     periodHandler,
-		JWTSecret:   cfg.JWTSecret,
+		Mail:        mailHandler,
+		Courses:     courseHandler,
+		Policies:    policyHandler,
+		OPDS:        opdsHandler,
+		Catalog:     catalogHandler,
+		Metadata:    metadataHandler,
+		Authors:     authorHandler,
+		Tags:        tagHandler,
+		Lists:       readingListHandler,
+		Suggestions: suggestionHandler,
+		LoginGuard:  loginGuardHandler,
+		Keys:        signingKeyHandler,
+		Invites:     registrationHandler,
+		Services:    serviceAccountHandler,
+		Tokens:      tokens,
+		CSRFSecret:  cfg.CSRFSecret,
+		Origins:     cfg.AllowedOrigins,
+		Sessions:    authService.CheckSession,
+		APIKeys: func(key, ip string) (uint, string, []string, error) {
+			principal, err := serviceAccountService.Authenticate(key, ip)
+			if err != nil {
+				return 0, "", nil, err
+			}
+			return principal.AccountID, string(principal.Role), principal.Scopes, nil
+		},
+		Credentials: func(dni, password, ip string) (uint, string, error) {
+			user, err := authService.VerifyCredentials(dni, password, ip)
+			if err != nil {
+				return 0, "", err
+			}
+			return user.ID, string(user.Role), nil
+		},
 	})
 
 	log.Fatal(app.Listen(":" + cfg.Port))
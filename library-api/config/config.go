@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,15 +17,92 @@ type Config struct {
 	DBName         string
 	DBPort         string
 	DBSSLMode      string
-	JWTSecret      string
 	CookieSecure   bool
 	CookieSameSite string
+	CSRFSecret     string
+	AllowedOrigins []string
 	AWSAccessKey   string
 	AWSSecretKey   string
 	AWSRegion      string
 	AWSBucket      string
 	S3PublicURL    string
 	MaxReviewDepth int
+	MailTransport  string
+	MailFrom       string
+	MailFileDir    string
+	MailLocale     string
+	SMTPHost       string
+	SMTPPort       string
+	SMTPUser       string
+	SMTPPassword   string
+	SMTPTimeout    time.Duration
+	MailInterval   time.Duration
+	MailMaxRetries int
+
+	MetadataProviders []string
+	OpenLibraryURL    string
+	GoogleBooksURL    string
+	GoogleBooksAPIKey string
+	MetadataTimeout   time.Duration
+	MetadataCacheTTL  time.Duration
+
+	PasswordResetChannel string
+	PasswordResetURL     string
+	PasswordResetTTL     time.Duration
+
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginFailureWindow time.Duration
+	LoginBaseDelay     time.Duration
+	LoginMaxDelay      time.Duration
+	LoginLockout       time.Duration
+
+	TOTPIssuer              string
+	TOTPEncryptionKey       string
+	SigningKeyEncryptionKey string
+	AdminRequire2FA         bool
+	TwoFactorPreAuthTTL     time.Duration
+
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCDNIClaim     string
+	OIDCNameClaim    string
+	OIDCEmailClaim   string
+	OIDCProvision    bool
+	OIDCLinkAny      bool
+	OIDCPostLoginURL string
+
+	AuthVerifiers          []string
+	LDAPURL                string
+	LDAPStartTLS           bool
+	LDAPAllowCleartext     bool
+	LDAPInsecureSkipVerify bool
+	LDAPBindDN             string
+	LDAPBindPassword       string
+	LDAPBaseDN             string
+	LDAPUserFilter         string
+	LDAPNameAttribute      string
+	LDAPEmailAttribute     string
+	LDAPGroupAttribute     string
+	LDAPRoleGroups         string
+	LDAPProvision          bool
+	LDAPTimeout            time.Duration
+
+	JWTAlgorithm       string
+	JWTIssuer          string
+	JWTAudience        string
+	JWTKeyRotation     time.Duration
+	JWTKeyPublishAhead time.Duration
+	JWTKeyOverlap      time.Duration
+
+	RegistrationMode         string
+	RegistrationEmailDomains []string
+	RegistrationCodeTTL      time.Duration
+	RegistrationMaxAttempts  int
+	DNIPattern               string
 }
 
 func Load() (*Config, error) {
@@ -38,15 +116,92 @@ func Load() (*Config, error) {
 		DBName:         getEnv("DB_NAME", "biblioteca_db"),
 		DBPort:         getEnv("DB_PORT", "5432"),
 		DBSSLMode:      getEnv("DB_SSLMODE", "disable"),
-		JWTSecret:      getEnv("JWT_SECRET", ""),
 		CookieSecure:   getEnvBool("COOKIE_SECURE", false),
 		CookieSameSite: getEnv("COOKIE_SAMESITE", "Lax"),
+		CSRFSecret:     getEnv("CSRF_SECRET", ""),
+		AllowedOrigins: getEnvList("ALLOWED_ORIGINS", []string{"http://localhost:5173"}),
 		AWSAccessKey:   getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretKey:   getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		AWSRegion:      getEnv("AWS_REGION", ""),
 		AWSBucket:      getEnv("AWS_BUCKET_NAME", ""),
 		S3PublicURL:    getEnv("AWS_PUBLIC_URL", ""),
 		MaxReviewDepth: getEnvInt("MAX_REVIEW_DEPTH", 3),
+		MailTransport:  getEnv("MAIL_TRANSPORT", "file"),
+		MailFrom:       getEnv("MAIL_FROM", "Biblioteca <no-reply@biblioteca.local>"),
+		MailFileDir:    getEnv("MAIL_FILE_DIR", "storage/mail"),
+		MailLocale:     getEnv("MAIL_DEFAULT_LOCALE", "es"),
+		SMTPHost:       getEnv("SMTP_HOST", ""),
+		SMTPPort:       getEnv("SMTP_PORT", "587"),
+		SMTPUser:       getEnv("SMTP_USER", ""),
+		SMTPPassword:   getEnv("SMTP_PASSWORD", ""),
+		SMTPTimeout:    getEnvDuration("SMTP_TIMEOUT", 30*time.Second),
+		MailInterval:   getEnvDuration("MAIL_DISPATCH_INTERVAL", 10*time.Second),
+		MailMaxRetries: getEnvInt("MAIL_MAX_ATTEMPTS", 5),
+
+		MetadataProviders: getEnvList("METADATA_PROVIDERS", []string{"openlibrary", "googlebooks"}),
+		OpenLibraryURL:    getEnv("OPENLIBRARY_BASE_URL", "https://openlibrary.org"),
+		GoogleBooksURL:    getEnv("GOOGLE_BOOKS_BASE_URL", "https://www.googleapis.com"),
+		GoogleBooksAPIKey: getEnv("GOOGLE_BOOKS_API_KEY", ""),
+		MetadataTimeout:   getEnvDuration("METADATA_TIMEOUT", 5*time.Second),
+		MetadataCacheTTL:  getEnvDuration("METADATA_CACHE_TTL", 720*time.Hour),
+
+		PasswordResetChannel: getEnv("PASSWORD_RESET_CHANNEL", "mail"),
+		PasswordResetURL:     getEnv("PASSWORD_RESET_URL", "http://localhost:5173/reset-password"),
+		PasswordResetTTL:     getEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures: getEnvInt("LOGIN_IP_MAX_FAILURES", 30),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginBaseDelay:     getEnvDuration("LOGIN_BASE_DELAY", time.Second),
+		LoginMaxDelay:      getEnvDuration("LOGIN_MAX_DELAY", 30*time.Second),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+
+		TOTPIssuer:              getEnv("TOTP_ISSUER", "Biblioteca"),
+		TOTPEncryptionKey:       getEnv("TOTP_ENCRYPTION_KEY", ""),
+		SigningKeyEncryptionKey: getEnv("SIGNING_KEY_ENCRYPTION_KEY", ""),
+		AdminRequire2FA:         getEnvBool("ADMIN_REQUIRE_2FA", false),
+		TwoFactorPreAuthTTL:     getEnvDuration("TWO_FACTOR_PREAUTH_TTL", 5*time.Minute),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:3000/api/auth/oidc/callback"),
+		OIDCScopes:       getEnvList("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		OIDCDNIClaim:     getEnv("OIDC_DNI_CLAIM", "dni"),
+		OIDCNameClaim:    getEnv("OIDC_NAME_CLAIM", "name"),
+		OIDCEmailClaim:   getEnv("OIDC_EMAIL_CLAIM", "email"),
+		OIDCProvision:    getEnvBool("OIDC_AUTO_PROVISION", true),
+		OIDCLinkAny:      getEnvBool("OIDC_LINK_ANY_ACCOUNT", false),
+		OIDCPostLoginURL: getEnv("OIDC_POST_LOGIN_URL", "http://localhost:5173/"),
+
+		AuthVerifiers:          getEnvList("AUTH_VERIFIERS", []string{"local"}),
+		LDAPURL:                getEnv("LDAP_URL", ""),
+		LDAPStartTLS:           getEnvBool("LDAP_START_TLS", true),
+		LDAPAllowCleartext:     getEnvBool("LDAP_ALLOW_CLEARTEXT", false),
+		LDAPInsecureSkipVerify: getEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+		LDAPBindDN:             getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:             getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:         getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+		LDAPNameAttribute:      getEnv("LDAP_NAME_ATTRIBUTE", "cn"),
+		LDAPEmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPGroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPRoleGroups:         getEnv("LDAP_ROLE_GROUPS", ""),
+		LDAPProvision:          getEnvBool("LDAP_PROVISION", true),
+		LDAPTimeout:            getEnvDuration("LDAP_TIMEOUT", 5*time.Second),
+
+		JWTAlgorithm:       getEnv("JWT_ALGORITHM", "RS256"),
+		JWTIssuer:          getEnv("JWT_ISSUER", "http://localhost:3000"),
+		JWTAudience:        getEnv("JWT_AUDIENCE", "library-api"),
+		JWTKeyRotation:     getEnvDuration("JWT_KEY_ROTATION", 720*time.Hour),
+		JWTKeyPublishAhead: getEnvDuration("JWT_KEY_PUBLISH_AHEAD", time.Hour),
+		JWTKeyOverlap:      getEnvDuration("JWT_KEY_OVERLAP", 48*time.Hour),
+
+		RegistrationMode:         getEnv("REGISTRATION_MODE", "disabled"),
+		RegistrationEmailDomains: getEnvList("REGISTRATION_EMAIL_DOMAINS", nil),
+		RegistrationCodeTTL:      getEnvDuration("REGISTRATION_CODE_TTL", 15*time.Minute),
+		RegistrationMaxAttempts:  getEnvInt("REGISTRATION_MAX_ATTEMPTS", 5),
+		DNIPattern:               getEnv("DNI_PATTERN", "^[0-9]{8}$"),
 	}, nil
 }
 
@@ -83,3 +238,29 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return parsed
 }
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -9,8 +9,8 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-func ConnectDatabase(cfg *Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
+func (cfg *Config) DatabaseDSN() string {
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
 		cfg.DBHost,
 		cfg.DBUser,
@@ -19,8 +19,10 @@ func ConnectDatabase(cfg *Config) (*gorm.DB, error) {
 		cfg.DBPort,
 		cfg.DBSSLMode,
 	)
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+func ConnectDatabase(cfg *Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseDSN()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
@@ -1,33 +1,81 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/jos3lo89/library-api/config"
 	"github.com/jos3lo89/library-api/internal/services"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const (
+	sessionTTL     = 24 * time.Hour
+	deliveryBearer = "bearer"
 )
 
 type AuthHandler struct {
-	auth   *services.AuthService
-	config *config.Config
+	auth         *services.AuthService
+	twoFactor    *services.TwoFactorService
+	oidc         *services.OIDCService
+	registration *services.RegistrationService
+	config       *config.Config
 }
 
-func NewAuthHandler(auth *services.AuthService, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{auth: auth, config: cfg}
+func NewAuthHandler(auth *services.AuthService, twoFactor *services.TwoFactorService, oidc *services.OIDCService, registration *services.RegistrationService, cfg *config.Config) *AuthHandler {
+	return &AuthHandler{auth: auth, twoFactor: twoFactor, oidc: oidc, registration: registration, config: cfg}
 }
 
 type registerRequest struct {
-	DNI      string `json:"dni"`
-	FullName string `json:"full_name"`
-	Password string `json:"password"`
+	DNI        string `json:"dni"`
+	FullName   string `json:"full_name"`
+	Email      string `json:"email"`
+	Locale     string `json:"locale"`
+	Password   string `json:"password"`
+	InviteCode string `json:"invite_code"`
+}
+
+type verifyRegistrationRequest struct {
+	DNI  string `json:"dni"`
+	Code string `json:"code"`
 }
 
 type loginRequest struct {
 	DNI      string `json:"dni"`
 	Password string `json:"password"`
+	Delivery string `json:"delivery"`
+}
+
+type forgotPasswordRequest struct {
+	DNI string `json:"dni"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type twoFactorRequest struct {
+	PreAuthToken string `json:"pre_auth_token"`
+	Code         string `json:"code"`
+	Delivery     string `json:"delivery"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type linkOIDCRequest struct {
+	Subject string `json:"subject"`
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
@@ -39,14 +87,41 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
 	}
 
-	user, err := h.auth.Register(body.DNI, body.FullName, body.Password)
+	challenge, err := h.registration.Start(services.RegistrationRequest{
+		DNI:        body.DNI,
+		FullName:   body.FullName,
+		Email:      body.Email,
+		Locale:     normalizeLocale(body.Locale),
+		Password:   body.Password,
+		InviteCode: body.InviteCode,
+	})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(registrationErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	return c.Status(http.StatusAccepted).JSON(challenge)
+}
+
+func (h *AuthHandler) VerifyRegistration(c *fiber.Ctx) error {
+	var body verifyRegistrationRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.DNI == "" || body.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
+	}
+
+	user, err := h.registration.Verify(body.DNI, body.Code)
+	if err != nil {
+		return c.Status(registrationErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
 	return c.Status(http.StatusCreated).JSON(user)
 }
 
+func (h *AuthHandler) RegistrationMode(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"mode": h.registration.Mode()})
+}
+
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var body loginRequest
 	if err := c.BodyParser(&body); err != nil {
@@ -56,13 +131,285 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing credentials"})
 	}
 
-	token, user, err := h.auth.Login(body.DNI, body.Password)
+	result, err := h.auth.Login(body.DNI, body.Password, c.IP())
+	if err != nil {
+		return loginError(c, err)
+	}
+	if result.TwoFactorStep != "" {
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+			"step":                result.TwoFactorStep,
+			"pre_auth_token":      result.PreAuthToken,
+		})
+	}
+
+	return c.JSON(h.deliverToken(c, result.Token, body.Delivery, fiber.Map{"user": result.User}))
+}
+
+func (h *AuthHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var body twoFactorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.PreAuthToken == "" || body.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
+	}
+
+	token, user, err := h.auth.CompleteTwoFactor(body.PreAuthToken, body.Code, c.IP())
+	if err != nil {
+		return loginError(c, err)
+	}
+
+	return c.JSON(h.deliverToken(c, token, body.Delivery, fiber.Map{"user": user}))
+}
+
+func (h *AuthHandler) TwoFactorStatus(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	status, err := h.twoFactor.Status(userID)
+	if err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(status)
+}
+
+func (h *AuthHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	var body twoFactorRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		}
+	}
+	userID, ok := h.twoFactorUser(c, body.PreAuthToken)
+	if !ok {
+		return nil
+	}
+
+	enrollment, err := h.twoFactor.Setup(userID)
+	if err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(enrollment)
+}
+
+func (h *AuthHandler) EnableTwoFactor(c *fiber.Ctx) error {
+	var body twoFactorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing code"})
+	}
+	userID, ok := h.twoFactorUser(c, body.PreAuthToken)
+	if !ok {
+		return nil
+	}
+
+	codes, err := h.twoFactor.Enable(userID, body.Code)
+	if err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	response := fiber.Map{"enabled": true, "recovery_codes": codes}
+	if _, hasSession := c.Locals("user_id").(uint); !hasSession {
+		user, err := h.auth.PreAuthUser(body.PreAuthToken, services.TwoFactorSetup)
+		if err != nil {
+			return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		token, err := h.auth.IssueToken(user)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		response["user"] = user
+		response = h.deliverToken(c, token, body.Delivery, response)
+	}
+	return c.JSON(response)
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var body twoFactorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	if err := h.twoFactor.Disable(userID, body.Code); err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var body twoFactorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(userID, body.Code)
+	if err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) ResetTwoFactor(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.twoFactor.Reset(uint(id)); err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "two-factor authentication reset"})
+}
+
+func (h *AuthHandler) LinkOIDC(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body linkOIDCRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	subject := strings.TrimSpace(body.Subject)
+	if subject == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing subject"})
+	}
+
+	if err := h.oidc.Link(uint(id), subject); err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "identity linked"})
+}
+
+func (h *AuthHandler) UnlinkOIDC(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.oidc.Unlink(uint(id)); err != nil {
+		return c.Status(authErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "identity unlinked"})
+}
+
+func (h *AuthHandler) twoFactorUser(c *fiber.Ctx, preAuth string) (uint, bool) {
+	if userID, ok := c.Locals("user_id").(uint); ok {
+		return userID, true
+	}
+	if preAuth == "" {
+		c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return 0, false
+	}
+	user, err := h.auth.PreAuthUser(preAuth, services.TwoFactorSetup)
+	if err != nil {
+		c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func (h *AuthHandler) OIDCLogin(c *fiber.Ctx) error {
+	redirect := c.Query("redirect")
+	if !safeRedirect(redirect) {
+		redirect = ""
+	}
+
+	authURL, state, err := h.oidc.Begin(c.UserContext(), redirect)
+	if errors.Is(err, services.ErrSSODisabled) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "identity provider unavailable"})
 	}
 
-	h.setAuthCookie(c, token)
-	return c.JSON(fiber.Map{"user": user})
+	h.setStateCookie(c, state, time.Now().Add(10*time.Minute))
+	return c.Redirect(authURL, http.StatusFound)
+}
+
+func (h *AuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	state := c.Query("state")
+	expected := c.Cookies("oidc_state")
+	h.setStateCookie(c, "", time.Unix(0, 0))
+
+	if c.Query("error") != "" {
+		return c.Redirect(h.ssoTarget("", "provider_error"), http.StatusFound)
+	}
+	if state == "" || expected == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		return c.Redirect(h.ssoTarget("", "invalid_state"), http.StatusFound)
+	}
+
+	user, redirect, err := h.oidc.Complete(c.UserContext(), state, c.Query("code"))
+	if err != nil {
+		return c.Redirect(h.ssoTarget("", ssoErrorCode(err)), http.StatusFound)
+	}
+
+	result, err := h.auth.StartSession(user)
+	if err != nil {
+		return c.Redirect(h.ssoTarget("", "server_error"), http.StatusFound)
+	}
+	if result.TwoFactorStep != "" {
+		fragment := url.Values{"two_factor": {result.TwoFactorStep}, "pre_auth_token": {result.PreAuthToken}}
+		return c.Redirect(h.ssoTarget(redirect, "")+"#"+fragment.Encode(), http.StatusFound)
+	}
+
+	h.setAuthCookie(c, result.Token)
+	return c.Redirect(h.ssoTarget(redirect, ""), http.StatusFound)
+}
+
+func (h *AuthHandler) setStateCookie(c *fiber.Ctx, value string, expires time.Time) {
+	sameSite := "Lax"
+	if parseSameSite(h.config.CookieSameSite) == "None" {
+		sameSite = "None"
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "oidc_state",
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   h.config.CookieSecure,
+		SameSite: sameSite,
+	})
+}
+
+func (h *AuthHandler) ssoTarget(redirect string, errorCode string) string {
+	target := h.config.OIDCPostLoginURL
+	if redirect != "" {
+		target = strings.TrimRight(target, "/") + redirect
+	}
+	if errorCode == "" {
+		return target
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	query := parsed.Query()
+	query.Set("sso_error", errorCode)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
 }
 
 func (h *AuthHandler) Me(c *fiber.Ctx) error {
@@ -73,7 +420,20 @@ func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"user_id": userID, "role": c.Locals("role")})
 }
 
+func (h *AuthHandler) CSRFToken(c *fiber.Ctx) error {
+	session := c.Cookies("access_token")
+	if method, _ := c.Locals("auth_method").(string); method != "cookie" || session == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "csrf tokens are only used with cookie sessions"})
+	}
+	return c.JSON(fiber.Map{"csrf_token": h.setCSRFCookie(c, session, time.Now().Add(sessionTTL))})
+}
+
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	h.clearAuthCookie(c)
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "logged out"})
+}
+
+func (h *AuthHandler) clearAuthCookie(c *fiber.Ctx) {
 	cookie := fiber.Cookie{
 		Name:     "access_token",
 		Value:    "",
@@ -83,19 +443,188 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 		SameSite: parseSameSite(h.config.CookieSameSite),
 	}
 	c.Cookie(&cookie)
-	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "logged out"})
+	h.setCSRFCookie(c, "", time.Unix(0, 0))
+}
+
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var body forgotPasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if strings.TrimSpace(body.DNI) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing dni"})
+	}
+
+	if err := h.auth.RequestPasswordReset(strings.TrimSpace(body.DNI)); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{"message": "if the account exists, reset instructions have been sent"})
 }
 
-func (h *AuthHandler) setAuthCookie(c *fiber.Ctx, token string) {
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var body resetPasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Token == "" || body.Password == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
+	}
+
+	if err := h.auth.ResetPassword(body.Token, body.Password); err != nil {
+		return c.Status(passwordErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.clearAuthCookie(c)
+	return c.JSON(fiber.Map{"message": "password updated"})
+}
+
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var body changePasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.OldPassword == "" || body.NewPassword == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
+	}
+
+	token, _, err := h.auth.ChangePassword(userID, body.OldPassword, body.NewPassword, c.IP())
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return loginError(c, err)
+	}
+	if err != nil {
+		return c.Status(passwordErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	delivery, _ := c.Locals("auth_method").(string)
+	return c.JSON(h.deliverToken(c, token, delivery, fiber.Map{"message": "password updated"}))
+}
+
+func loginError(c *fiber.Ctx, err error) error {
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error(), "retry_after": retryAfter})
+	}
+
+	status := authErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		return c.Status(status).JSON(fiber.Map{"error": "login failed"})
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
+
+func ssoErrorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrInvalidSSOState):
+		return "invalid_state"
+	case errors.Is(err, services.ErrSSOExchange):
+		return "exchange_failed"
+	case errors.Is(err, services.ErrSSOMissingDNI):
+		return "missing_dni"
+	case errors.Is(err, services.ErrSSOAccountConflict):
+		return "account_conflict"
+	case errors.Is(err, services.ErrSSONoAccount):
+		return "no_account"
+	case errors.Is(err, services.ErrSSOLinkRequired):
+		return "link_required"
+	case errors.Is(err, services.ErrUserInactive):
+		return "inactive"
+	default:
+		return "server_error"
+	}
+}
+
+func safeRedirect(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\") && len(path) <= 512
+}
+
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidPreAuth), errors.Is(err, services.ErrInvalidTwoFactorCode):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrUserInactive), errors.Is(err, services.ErrTwoFactorMandatory):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTwoFactorEnabled), errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrTwoFactorNotStarted),
+		errors.Is(err, services.ErrSSOAccountConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func registrationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidDNI), errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrEmailRequired),
+		errors.Is(err, services.ErrEmailDomain), errors.Is(err, services.ErrInviteRequired), errors.Is(err, services.ErrInvalidVerificationCode):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRegistrationDisabled), errors.Is(err, services.ErrInvalidInvite), errors.Is(err, services.ErrNotInRoster):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrDNIRegistered), errors.Is(err, services.ErrRegistrationPending):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRegistrationCooldown):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func passwordErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrInvalidResetToken):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *AuthHandler) deliverToken(c *fiber.Ctx, token string, delivery string, response fiber.Map) fiber.Map {
+	if strings.EqualFold(strings.TrimSpace(delivery), deliveryBearer) {
+		response["access_token"] = token
+		response["token_type"] = "Bearer"
+		response["expires_in"] = int(sessionTTL.Seconds())
+		return response
+	}
+	response["csrf_token"] = h.setAuthCookie(c, token)
+	return response
+}
+
+func (h *AuthHandler) setAuthCookie(c *fiber.Ctx, token string) string {
+	expires := time.Now().Add(sessionTTL)
 	cookie := fiber.Cookie{
 		Name:     "access_token",
 		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  expires,
 		HTTPOnly: true,
 		Secure:   h.config.CookieSecure,
 		SameSite: parseSameSite(h.config.CookieSameSite),
 	}
 	c.Cookie(&cookie)
+	return h.setCSRFCookie(c, token, expires)
+}
+
+func (h *AuthHandler) setCSRFCookie(c *fiber.Ctx, session string, expires time.Time) string {
+	value := ""
+	if session != "" {
+		value = utils.CSRFToken(session, h.config.CSRFSecret)
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "csrf_token",
+		Value:    value,
+		Expires:  expires,
+		Secure:   h.config.CookieSecure,
+		SameSite: parseSameSite(h.config.CookieSameSite),
+	})
+	return value
 }
 
 func parseSameSite(value string) string {
@@ -108,3 +637,12 @@ func parseSameSite(value string) string {
 		return "Lax"
 	}
 }
+
+func normalizeLocale(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "en":
+		return "en"
+	default:
+		return "es"
+	}
+}
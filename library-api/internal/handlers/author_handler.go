@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type AuthorHandler struct {
+	authors *services.AuthorService
+}
+
+func NewAuthorHandler(authors *services.AuthorService) *AuthorHandler {
+	return &AuthorHandler{authors: authors}
+}
+
+type createAuthorRequest struct {
+	Name     string   `json:"name"`
+	Variants []string `json:"variants"`
+}
+
+type renameAuthorRequest struct {
+	Name string `json:"name"`
+}
+
+type mergeAuthorsRequest struct {
+	SourceIDs []uint `json:"source_ids"`
+}
+
+type setBookAuthorsRequest struct {
+	Authors []services.AuthorCredit `json:"authors"`
+}
+
+func (h *AuthorHandler) List(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	items, total, err := h.authors.Search(c.Query("q"), (page-1)*limit, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (h *AuthorHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	author, err := h.authors.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	books, err := h.authors.ListBooks(author.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"author": author, "books": books})
+}
+
+func (h *AuthorHandler) Create(c *fiber.Ctx) error {
+	var body createAuthorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name required"})
+	}
+
+	author, err := h.authors.Create(body.Name, body.Variants)
+	if err != nil {
+		return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusCreated).JSON(author)
+}
+
+func (h *AuthorHandler) Rename(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body renameAuthorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name required"})
+	}
+
+	author, err := h.authors.Rename(uint(id), body.Name)
+	if err != nil {
+		return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(author)
+}
+
+func (h *AuthorHandler) AddVariant(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body renameAuthorRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name required"})
+	}
+
+	author, err := h.authors.AddVariant(uint(id), body.Name)
+	if err != nil {
+		return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(author)
+}
+
+func (h *AuthorHandler) Merge(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body mergeAuthorsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	author, err := h.authors.Merge(uint(id), body.SourceIDs)
+	if err != nil {
+		return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(author)
+}
+
+func (h *AuthorHandler) SetBookAuthors(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body setBookAuthorsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if err := validateAuthorCredits(body.Authors); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.authors.LinkBook(uint(id), body.Authors); err != nil {
+		return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	books, err := h.authors.BookCredits(uint(id))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": books})
+}
+
+func authorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAuthorNotFound), errors.Is(err, services.ErrBookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrVariantInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrInvalidMergeList), errors.Is(err, services.ErrAuthorName):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
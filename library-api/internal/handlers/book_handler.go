@@ -1,7 +1,17 @@
 package handlers
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -15,51 +25,176 @@ import (
 	"github.com/jos3lo89/library-api/internal/services"
 )
 
+const reviewStreamRecheck = 30 * time.Second
+
 type BookHandler struct {
 	books       *services.BookService
 	s3          *services.S3Service
 	enrollments *services.EnrollmentService
 	periods     *services.PeriodService
 	reviews     *services.ReviewService
+	reviewHub   *services.ReviewHub
+	policies    *services.PolicyService
+	assets      *services.AssetService
+	authors     *services.AuthorService
+	tags        *services.TagService
+	lists       *services.ReadingListService
+	suggestions *services.SuggestionService
 	config      *config.Config
 }
 
-func NewBookHandler(books *services.BookService, s3 *services.S3Service, enrollments *services.EnrollmentService, periods *services.PeriodService, reviews *services.ReviewService, cfg *config.Config) *BookHandler {
-	return &BookHandler{books: books, s3: s3, enrollments: enrollments, periods: periods, reviews: reviews, config: cfg}
+func NewBookHandler(books *services.BookService, s3 *services.S3Service, enrollments *services.EnrollmentService, periods *services.PeriodService, reviews *services.ReviewService, reviewHub *services.ReviewHub, policies *services.PolicyService, assets *services.AssetService, authors *services.AuthorService, tags *services.TagService, lists *services.ReadingListService, suggestions *services.SuggestionService, cfg *config.Config) *BookHandler {
+	return &BookHandler{books: books, s3: s3, enrollments: enrollments, periods: periods, reviews: reviews, reviewHub: reviewHub, policies: policies, assets: assets, authors: authors, tags: tags, lists: lists, suggestions: suggestions, config: cfg}
 }
 
 func (h *BookHandler) List(c *fiber.Ctx) error {
 	query := strings.TrimSpace(c.Query("q"))
-	categoryParam := c.Query("category_id")
+	cursor := strings.TrimSpace(c.Query("cursor"))
+	cursorMode := cursor != "" || c.Query("pagination") == "cursor"
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	maxLimit := 50
+	if cursorMode {
+		page, maxLimit = 1, 100
+	}
 	if page < 1 {
 		page = 1
 	}
-	if limit < 1 || limit > 50 {
+	if limit < 1 || limit > maxLimit {
 		limit = 10
 	}
 
-	var categoryID *uint
-	if categoryParam != "" {
-		if parsed, err := strconv.ParseUint(categoryParam, 10, 64); err == nil {
-			id := uint(parsed)
-			categoryID = &id
+	var categoryIDs []uint
+	for _, value := range queryValues(c, "category_id") {
+		if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+			categoryIDs = append(categoryIDs, uint(parsed))
+		}
+	}
+
+	filter := services.BookFilter{
+		Query:        query,
+		CategoryIDs:  categoryIDs,
+		Publisher:    strings.TrimSpace(c.Query("publisher")),
+		Languages:    queryValues(c, "language"),
+		Edition:      strings.TrimSpace(c.Query("edition")),
+		MatchAllTags: strings.EqualFold(c.Query("tag_mode"), "all"),
+		Sort:         c.Query("sort"),
+		Order:        c.Query("order"),
+		Offset:       (page - 1) * limit,
+		Limit:        limit,
+	}
+	for _, tag := range append(queryValues(c, "tag"), queryValues(c, "tags")...) {
+		if slug := services.Slugify(tag); slug != "" {
+			filter.Tags = append(filter.Tags, slug)
+		}
+	}
+	if value := c.Query("downloadable"); value != "" {
+		downloadable, err := strconv.ParseBool(value)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid downloadable"})
+		}
+		filter.Downloadable = &downloadable
+	}
+
+	authorID, err := optionalUintQuery(c, "author_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid author_id"})
+	}
+	filter.AuthorID = authorID
+
+	if isbn := strings.TrimSpace(c.Query("isbn")); isbn != "" {
+		normalized, err := services.NormalizeISBN(isbn)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid isbn"})
 		}
+		filter.ISBN = normalized
 	}
 
-	offset := (page - 1) * limit
-	books, total, err := h.books.List(query, categoryID, offset, limit)
+	if filter.YearFrom, err = optionalIntQuery(c, "year_from"); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid year_from"})
+	}
+	if filter.YearTo, err = optionalIntQuery(c, "year_to"); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid year_to"})
+	}
+	year, err := optionalIntQuery(c, "year")
 	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid year"})
+	}
+	if year != nil {
+		filter.YearFrom, filter.YearTo = year, year
+	}
+
+	if cursorMode {
+		return h.listCursor(c, filter, cursor)
+	}
+
+	books, total, err := h.books.List(filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.markFavorites(c, books); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"items": books,
 		"total": total,
 		"page":  page,
 		"limit": limit,
-	})
+	}
+	if c.QueryBool("facets", true) {
+		facets, err := h.books.Facets(filter)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		response["facets"] = facets
+	}
+	return c.JSON(response)
+}
+
+func (h *BookHandler) listCursor(c *fiber.Ctx, filter services.BookFilter, cursor string) error {
+	result, err := h.books.ListCursor(filter, cursor, c.QueryBool("with_total", false))
+	if err != nil {
+		return c.Status(bookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.markFavorites(c, result.Items); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	links := fiber.Map{}
+	if result.NextCursor != "" {
+		links["next"] = cursorLink(c, result.NextCursor)
+	}
+	if result.PrevCursor != "" {
+		links["prev"] = cursorLink(c, result.PrevCursor)
+	}
+
+	response := fiber.Map{
+		"items":       result.Items,
+		"limit":       result.Limit,
+		"next_cursor": result.NextCursor,
+		"prev_cursor": result.PrevCursor,
+		"links":       links,
+	}
+	if result.Total != nil {
+		response["total"] = *result.Total
+	}
+	if c.QueryBool("facets", cursor == "") {
+		facets, err := h.books.Facets(filter)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		response["facets"] = facets
+	}
+	return c.JSON(response)
+}
+
+func cursorLink(c *fiber.Ctx, cursor string) string {
+	values, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	values.Del("page")
+	values.Del("pagination")
+	values.Set("cursor", cursor)
+	return c.Path() + "?" + values.Encode()
 }
 
 func (h *BookHandler) GetByID(c *fiber.Ctx) error {
@@ -73,7 +208,20 @@ func (h *BookHandler) GetByID(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
 	}
 
-	return c.JSON(book)
+	books := []models.Book{*book}
+	if err := h.markFavorites(c, books); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(books[0])
+}
+
+func (h *BookHandler) markFavorites(c *fiber.Ctx, books []models.Book) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return nil
+	}
+	return h.lists.MarkFavorites(userID, books)
 }
 
 func (h *BookHandler) Create(c *fiber.Ctx) error {
@@ -84,9 +232,23 @@ func (h *BookHandler) Create(c *fiber.Ctx) error {
 	isDownloadableValue := strings.TrimSpace(c.FormValue("is_downloadable"))
 	coverURL := strings.TrimSpace(c.FormValue("cover_url"))
 
-	if title == "" || author == "" || categoryIDValue == "" {
+	credits, err := parseAuthorCredits(c.FormValue("authors"), author)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if title == "" || len(credits) == 0 || categoryIDValue == "" {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
 	}
+	if author == "" {
+		names := make([]string, 0, len(credits))
+		for _, credit := range credits {
+			if credit.Role == models.AuthorRoleAuthor && credit.Name != "" {
+				names = append(names, credit.Name)
+			}
+		}
+		author = strings.Join(names, "; ")
+	}
 
 	categoryIDParsed, err := strconv.ParseUint(categoryIDValue, 10, 64)
 	if err != nil {
@@ -100,42 +262,186 @@ func (h *BookHandler) Create(c *fiber.Ctx) error {
 		}
 	}
 
-	file, err := c.FormFile("file")
+	year, err := optionalIntForm(c, "year")
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid year"})
+	}
+	pages, err := optionalIntForm(c, "pages")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid pages"})
 	}
 
-	fileHandle, err := file.Open()
+	file, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to open file"})
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
 	}
-	defer fileHandle.Close()
 
-	key := buildS3Key(file.Filename)
-	contentType := file.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/pdf"
+	format := detectAssetFormat(c.FormValue("format"), file.Filename)
+	if format == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported format"})
 	}
 
-	if err := h.s3.Upload(c.Context(), key, fileHandle, contentType); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to upload"})
+	asset, err := h.uploadAsset(c, file, format)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	asset.Format = format
+	asset.Edition = strings.TrimSpace(c.FormValue("edition"))
+	asset.Language = strings.TrimSpace(c.FormValue("language", "es"))
+	asset.IsPrimary = true
 
 	book := &models.Book{
 		Title:          title,
 		Author:         author,
 		Description:    description,
 		CoverURL:       coverURL,
-		S3Key:          key,
+		ISBN:           strings.TrimSpace(c.FormValue("isbn")),
+		Publisher:      strings.TrimSpace(c.FormValue("publisher")),
+		Language:       asset.Language,
+		Edition:        asset.Edition,
+		S3Key:          asset.StorageKey,
 		IsDownloadable: isDownloadable,
 		CategoryID:     uint(categoryIDParsed),
+		Assets:         []models.BookAsset{*asset},
+	}
+	if year != nil {
+		book.Year = *year
+	}
+	if pages != nil {
+		book.Pages = *pages
 	}
 
 	if err := h.books.Create(book); err != nil {
+		if deleteErr := h.s3.Delete(c.Context(), asset.StorageKey); deleteErr != nil {
+			log.Printf("failed to delete orphan object %s: %v", asset.StorageKey, deleteErr)
+		}
+		return c.Status(bookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.authors.LinkBook(book.ID, credits); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if tags := services.ParseTagList(c.FormValue("tags")); len(tags) > 0 {
+		if _, err := h.tags.SetBookTags(book.ID, tags); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if err := h.suggestions.BookCreated(book); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(http.StatusCreated).JSON(book)
+	created, err := h.books.FindByID(book.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+type updateBookRequest struct {
+	Title          *string `json:"title"`
+	Author         *string `json:"author"`
+	Description    *string `json:"description"`
+	CoverURL       *string `json:"cover_url"`
+	IsDownloadable *bool   `json:"is_downloadable"`
+	CategoryID     *uint   `json:"category_id"`
+	ISBN           *string `json:"isbn"`
+	Publisher      *string `json:"publisher"`
+	Year           *int    `json:"year"`
+	Language       *string `json:"language"`
+	Pages          *int    `json:"pages"`
+	Edition        *string `json:"edition"`
+
+	Authors *[]services.AuthorCredit `json:"authors"`
+	Tags    *[]string                `json:"tags"`
+}
+
+func (h *BookHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	var body updateBookRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	if body.Title != nil {
+		if strings.TrimSpace(*body.Title) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "title required"})
+		}
+		book.Title = strings.TrimSpace(*body.Title)
+	}
+	var credits []services.AuthorCredit
+	if body.Author != nil {
+		if strings.TrimSpace(*body.Author) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "author required"})
+		}
+		book.Author = strings.TrimSpace(*body.Author)
+		credits = services.CreditsFromString(book.Author)
+	}
+	if body.Authors != nil {
+		if err := validateAuthorCredits(*body.Authors); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		credits = *body.Authors
+	}
+	if body.Description != nil {
+		book.Description = strings.TrimSpace(*body.Description)
+	}
+	if body.CoverURL != nil {
+		book.CoverURL = strings.TrimSpace(*body.CoverURL)
+	}
+	if body.IsDownloadable != nil {
+		book.IsDownloadable = *body.IsDownloadable
+	}
+	if body.CategoryID != nil {
+		book.CategoryID = *body.CategoryID
+	}
+	if body.ISBN != nil {
+		book.ISBN = *body.ISBN
+	}
+	if body.Publisher != nil {
+		book.Publisher = *body.Publisher
+	}
+	if body.Year != nil {
+		book.Year = *body.Year
+	}
+	if body.Language != nil {
+		book.Language = *body.Language
+	}
+	if body.Pages != nil {
+		book.Pages = *body.Pages
+	}
+	if body.Edition != nil {
+		book.Edition = *body.Edition
+	}
+
+	if err := h.books.Update(book); err != nil {
+		return c.Status(bookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if credits != nil {
+		if err := h.authors.LinkBook(book.ID, credits); err != nil {
+			return c.Status(authorErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if body.Tags != nil {
+		if _, err := h.tags.SetBookTags(book.ID, *body.Tags); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	updated, err := h.books.FindByID(book.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(updated)
 }
 
 func (h *BookHandler) Read(c *fiber.Ctx) error {
@@ -159,16 +465,36 @@ func (h *BookHandler) Read(c *fiber.Ctx) error {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
 	}
 
-	if _, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID); err != nil {
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
 	}
 
-	url, err := h.s3.PresignGetURL(c.Context(), book.S3Key, 15*time.Minute)
+	if ok, err := h.checkPolicy(c, book, enrollment); !ok {
+		return err
+	}
+
+	var assetID *uint
+	if value := c.Query("asset_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid asset_id"})
+		}
+		id := uint(parsed)
+		assetID = &id
+	}
+
+	asset, err := h.assets.Resolve(book, assetID, strings.TrimSpace(c.Query("format")))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "asset not found"})
+	}
+
+	url, err := h.s3.PresignGetURL(c.Context(), asset.StorageKey, 15*time.Minute)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate url"})
 	}
 
-	return c.JSON(fiber.Map{"url": url})
+	return c.JSON(fiber.Map{"url": url, "asset": asset})
 }
 
 func (h *BookHandler) ListReviews(c *fiber.Ctx) error {
@@ -177,7 +503,8 @@ func (h *BookHandler) ListReviews(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
 	}
 
-	if _, err := h.books.FindByID(uint(id)); err != nil {
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
 	}
 
@@ -191,10 +518,15 @@ func (h *BookHandler) ListReviews(c *fiber.Ctx) error {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
 	}
 
-	if _, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID); err != nil {
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
 	}
 
+	if ok, err := h.checkPolicy(c, book, enrollment); !ok {
+		return err
+	}
+
 	reviews, err := h.reviews.ListTree(uint(id))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -215,7 +547,8 @@ func (h *BookHandler) CreateReview(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
 	}
 
-	if _, err := h.books.FindByID(uint(id)); err != nil {
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
 	}
 
@@ -253,6 +586,10 @@ func (h *BookHandler) CreateReview(c *fiber.Ctx) error {
 		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
 	}
 
+	if ok, err := h.checkPolicy(c, book, enrollment); !ok {
+		return err
+	}
+
 	displayName := enrollment.DisplayName
 	avatarURL := enrollment.AvatarURL
 
@@ -274,7 +611,463 @@ func (h *BookHandler) CreateReview(c *fiber.Ctx) error {
 	return c.Status(http.StatusCreated).JSON(review)
 }
 
+type updateReviewRequest struct {
+	Rating  *int   `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+func (h *BookHandler) UpdateReview(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	reviewID, err := strconv.ParseUint(c.Params("reviewId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid review id"})
+	}
+
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	var body updateReviewRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	if strings.TrimSpace(body.Comment) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "comment required"})
+	}
+
+	if body.Rating != nil {
+		if *body.Rating < 1 || *body.Rating > 5 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "rating must be 1-5"})
+		}
+	}
+
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
+	}
+
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
+	}
+
+	if ok, err := h.checkPolicy(c, book, enrollment); !ok {
+		return err
+	}
+
+	review, err := h.reviews.Update(uint(id), uint(reviewID), userID, strings.TrimSpace(body.Comment), body.Rating)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(review)
+}
+
+type setReviewHiddenRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+func (h *BookHandler) SetReviewHidden(c *fiber.Ctx) error {
+	reviewID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body setReviewHiddenRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	review, err := h.reviews.SetHidden(uint(reviewID), body.Hidden)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "review not found"})
+	}
+
+	return c.JSON(review)
+}
+
+func (h *BookHandler) StreamReviews(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
+	}
+
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
+	}
+
+	if ok, err := h.checkPolicy(c, book, enrollment); !ok {
+		return err
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	role, _ := c.Locals("role").(string)
+	sub := h.reviewHub.Subscribe(uint(id))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.reviewHub.Unsubscribe(sub)
+
+		heartbeat := time.NewTicker(20 * time.Second)
+		defer heartbeat.Stop()
+		recheck := time.NewTicker(reviewStreamRecheck)
+		defer recheck.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case message, ok := <-sub.Messages:
+				if !ok {
+					fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+					w.Flush()
+					return
+				}
+				payload, err := json.Marshal(message.Review)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, payload)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case <-recheck.C:
+				if !h.reviewStreamAllowed(uint(id), userID, role, currentPeriod.ID) {
+					fmt.Fprint(w, "event: revoked\ndata: {}\n\n")
+					w.Flush()
+					return
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func (h *BookHandler) reviewStreamAllowed(bookID uint, userID uint, role string, periodID uint) bool {
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil || currentPeriod.ID != periodID {
+		return false
+	}
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, periodID)
+	if err != nil {
+		return false
+	}
+	book, err := h.books.FindByID(bookID)
+	if err != nil {
+		return false
+	}
+	decision, err := h.policies.Evaluate(book, services.SubjectFromEnrollment(role, enrollment))
+	if err != nil {
+		log.Printf("review stream: evaluating access for user %d: %v", userID, err)
+		return false
+	}
+	return decision.Allowed
+}
+
+func (h *BookHandler) Access(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		return c.JSON(services.AccessDecision{Reasons: []string{"there is no current academic period"}})
+	}
+
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		return c.JSON(services.AccessDecision{Reasons: []string{"no active enrollment with access in period " + currentPeriod.Name}})
+	}
+
+	role, _ := c.Locals("role").(string)
+	decision, err := h.policies.Evaluate(book, services.SubjectFromEnrollment(role, enrollment))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	decision.Rules = nil
+
+	return c.JSON(decision)
+}
+
+func (h *BookHandler) checkPolicy(c *fiber.Ctx, book *models.Book, enrollment *models.Enrollment) (bool, error) {
+	role, _ := c.Locals("role").(string)
+	decision, err := h.policies.Evaluate(book, services.SubjectFromEnrollment(role, enrollment))
+	if err != nil {
+		return false, c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !decision.Allowed {
+		return false, c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access", "reasons": decision.Reasons})
+	}
+	return true, nil
+}
+
+func (h *BookHandler) ListAssets(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if _, err := h.books.FindByID(uint(id)); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	items, err := h.assets.ListByBook(uint(id))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *BookHandler) UploadAsset(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if _, err := h.books.FindByID(uint(id)); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	format := detectAssetFormat(c.FormValue("format"), file.Filename)
+	if format == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported format"})
+	}
+
+	isPrimary := false
+	if value := strings.TrimSpace(c.FormValue("is_primary")); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			isPrimary = parsed
+		}
+	}
+
+	asset, err := h.uploadAsset(c, file, format)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	asset.BookID = uint(id)
+	asset.Format = format
+	asset.Edition = strings.TrimSpace(c.FormValue("edition"))
+	asset.Language = strings.TrimSpace(c.FormValue("language", "es"))
+	asset.IsPrimary = isPrimary
+
+	if err := h.assets.Create(asset); err != nil {
+		_ = h.s3.Delete(c.Context(), asset.StorageKey)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusCreated).JSON(asset)
+}
+
+func (h *BookHandler) SetPrimaryAsset(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	assetID, err := strconv.ParseUint(c.Params("assetId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid asset id"})
+	}
+
+	asset, err := h.assets.SetPrimary(uint(id), uint(assetID))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "asset not found"})
+	}
+
+	return c.JSON(asset)
+}
+
+func (h *BookHandler) DeleteAsset(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	assetID, err := strconv.ParseUint(c.Params("assetId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid asset id"})
+	}
+
+	asset, err := h.assets.Delete(uint(id), uint(assetID))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.s3.Delete(c.Context(), asset.StorageKey); err != nil {
+		log.Printf("delete asset %d: %v", asset.ID, err)
+	}
+
+	return c.JSON(fiber.Map{"message": "asset deleted"})
+}
+
+func (h *BookHandler) uploadAsset(c *fiber.Ctx, file *multipart.FileHeader, format string) (*models.BookAsset, error) {
+	fileHandle, err := file.Open()
+	if err != nil {
+		return nil, errors.New("failed to open file")
+	}
+	defer fileHandle.Close()
+
+	key := buildS3Key(file.Filename)
+	contentType := services.AssetContentType(format)
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fileHandle); err != nil {
+		return nil, errors.New("failed to read file")
+	}
+	if _, err := fileHandle.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.New("failed to read file")
+	}
+
+	if err := h.s3.Upload(c.Context(), key, fileHandle, contentType); err != nil {
+		return nil, errors.New("failed to upload")
+	}
+
+	return &models.BookAsset{
+		SizeBytes:   file.Size,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+		ContentType: contentType,
+		StorageKey:  key,
+	}, nil
+}
+
+func detectAssetFormat(value string, filename string) string {
+	if strings.TrimSpace(value) != "" {
+		format, err := services.NormalizeAssetFormat(value)
+		if err != nil {
+			return ""
+		}
+		return format
+	}
+	return services.DetectAssetFormat(filename)
+}
+
 func buildS3Key(filename string) string {
 	ext := filepath.Ext(filename)
 	return "books/" + uuid.New().String() + ext
 }
+
+func bookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidISBN), errors.Is(err, services.ErrInvalidYear), errors.Is(err, services.ErrInvalidPages),
+		errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrCursorSort):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDuplicateISBN):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func queryValues(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, raw := range c.Context().QueryArgs().PeekMulti(key) {
+		for _, value := range strings.Split(string(raw), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func optionalIntQuery(c *fiber.Ctx, key string) (*int, error) {
+	return parseOptionalInt(c.Query(key))
+}
+
+func optionalIntForm(c *fiber.Ctx, key string) (*int, error) {
+	return parseOptionalInt(c.FormValue(key))
+}
+
+func parseOptionalInt(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func parseAuthorCredits(raw string, fallback string) ([]services.AuthorCredit, error) {
+	if strings.TrimSpace(raw) == "" {
+		return services.CreditsFromString(fallback), nil
+	}
+	var credits []services.AuthorCredit
+	if err := json.Unmarshal([]byte(raw), &credits); err != nil {
+		return nil, errors.New("invalid authors")
+	}
+	if err := validateAuthorCredits(credits); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+func validateAuthorCredits(credits []services.AuthorCredit) error {
+	if len(credits) == 0 {
+		return errors.New("at least one author is required")
+	}
+	for i := range credits {
+		credits[i].Name = strings.TrimSpace(credits[i].Name)
+		credits[i].Role = models.AuthorRole(strings.ToUpper(string(credits[i].Role)))
+		if credits[i].Role == "" {
+			credits[i].Role = models.AuthorRoleAuthor
+		}
+		if credits[i].AuthorID == 0 && credits[i].Name == "" {
+			return errors.New("each author needs author_id or name")
+		}
+		if !services.ValidAuthorRole(credits[i].Role) {
+			return services.ErrInvalidRole
+		}
+	}
+	return nil
+}
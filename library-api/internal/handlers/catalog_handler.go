@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type CatalogHandler struct {
+	catalog *services.CatalogExchangeService
+}
+
+func NewCatalogHandler(catalog *services.CatalogExchangeService) *CatalogHandler {
+	return &CatalogHandler{catalog: catalog}
+}
+
+func (h *CatalogHandler) Import(c *fiber.Ctx) error {
+	data, err := readImportPayload(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(data) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		format = services.DetectCatalogFormat(data)
+	}
+	if format == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "could not detect format, use marcxml, iso2709 or dc"})
+	}
+
+	categoryID, err := optionalUintQuery(c, "category_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+	}
+
+	report, err := h.catalog.Import(data, services.ImportOptions{
+		Format:      format,
+		DryRun:      c.QueryBool("dry_run", false),
+		OnDuplicate: strings.ToLower(c.Query("on_duplicate")),
+		CategoryID:  categoryID,
+	})
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(report)
+}
+
+func (h *CatalogHandler) Export(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", services.CatalogFormatMARCXML))
+
+	categoryID, err := optionalUintQuery(c, "category_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+	}
+
+	var ids []uint
+	for _, raw := range strings.Split(c.Query("ids"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid ids"})
+		}
+		ids = append(ids, uint(id))
+	}
+
+	var contentType, extension string
+	switch format {
+	case services.CatalogFormatMARCXML:
+		contentType, extension = "application/marcxml+xml", "xml"
+	case services.CatalogFormatISO2709:
+		contentType, extension = "application/marc", "mrc"
+	case services.CatalogFormatDC:
+		contentType, extension = "application/xml", "xml"
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be marcxml, iso2709 or dc"})
+	}
+
+	payload, err := h.catalog.Export(format, services.ExportFilter{
+		Query:      c.Query("q"),
+		CategoryID: categoryID,
+		IDs:        ids,
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"catalog-%s.%s\"", format, extension))
+	return c.Send(payload)
+}
+
+func readImportPayload(c *fiber.Ctx) ([]byte, error) {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		return c.Body(), nil
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("file is required")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
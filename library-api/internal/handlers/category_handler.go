@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,8 +21,24 @@ func NewCategoryHandler(categories *services.CategoryService) *CategoryHandler {
 }
 
 type createCategoryRequest struct {
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type updateCategoryRequest struct {
+	Name *string `json:"name"`
+	Slug *string `json:"slug"`
+}
+
+type moveCategoryRequest struct {
+	ParentID *uint `json:"parent_id"`
+	Position *int  `json:"position"`
+}
+
+type reorderCategoriesRequest struct {
+	ParentID *uint  `json:"parent_id"`
+	IDs      []uint `json:"ids"`
 }
 
 func (h *CategoryHandler) List(c *fiber.Ctx) error {
@@ -36,18 +54,133 @@ func (h *CategoryHandler) Create(c *fiber.Ctx) error {
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
 	}
-	if strings.TrimSpace(body.Name) == "" || strings.TrimSpace(body.Slug) == "" {
+	if strings.TrimSpace(body.Name) == "" {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
 	}
 
 	category := &models.Category{
-		Name: strings.TrimSpace(body.Name),
-		Slug: strings.TrimSpace(body.Slug),
+		Name:     strings.TrimSpace(body.Name),
+		Slug:     strings.TrimSpace(body.Slug),
+		ParentID: body.ParentID,
 	}
 
 	if err := h.categories.Create(category); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.Status(http.StatusCreated).JSON(category)
 }
+
+func (h *CategoryHandler) GetBySlug(c *fiber.Ctx) error {
+	category, redirected, err := h.categories.FindBySlug(c.Params("slug"))
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	if redirected {
+		return c.Redirect("/api/categories/slug/"+category.Slug, http.StatusMovedPermanently)
+	}
+	return c.JSON(category)
+}
+
+func (h *CategoryHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body updateCategoryRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	category, err := h.categories.Update(uint(id), body.Name, body.Slug)
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(category)
+}
+
+func (h *CategoryHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	reassignTo, err := optionalUintQuery(c, "reassign_to")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid reassign_to"})
+	}
+
+	result, err := h.categories.Delete(uint(id), reassignTo)
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+func (h *CategoryHandler) Tree(c *fiber.Ctx) error {
+	tree, err := h.categories.Tree()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": tree})
+}
+
+func (h *CategoryHandler) Breadcrumb(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	path, err := h.categories.Breadcrumb(uint(id))
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": path})
+}
+
+func (h *CategoryHandler) Move(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body moveCategoryRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	category, err := h.categories.Move(uint(id), body.ParentID, body.Position)
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(category)
+}
+
+func (h *CategoryHandler) Reorder(c *fiber.Ctx) error {
+	var body reorderCategoriesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	items, err := h.categories.Reorder(body.ParentID, body.IDs)
+	if err != nil {
+		return c.Status(categoryErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrParentNotFound), errors.Is(err, services.ErrCategoryCycle), errors.Is(err, services.ErrInvalidOrder),
+		errors.Is(err, services.ErrCategoryName), errors.Is(err, services.ErrInvalidSlug), errors.Is(err, services.ErrInvalidReassign):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCategoryNameUsed), errors.Is(err, services.ErrCategorySlugUsed), errors.Is(err, services.ErrCategoryInUse),
+		errors.Is(err, services.ErrCategoryHasRules):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
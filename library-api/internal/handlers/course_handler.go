@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type CourseHandler struct {
+	courses     *services.CourseService
+	enrollments *services.EnrollmentService
+	periods     *services.PeriodService
+}
+
+func NewCourseHandler(courses *services.CourseService, enrollments *services.EnrollmentService, periods *services.PeriodService) *CourseHandler {
+	return &CourseHandler{courses: courses, enrollments: enrollments, periods: periods}
+}
+
+type createCourseRequest struct {
+	PeriodID   uint   `json:"period_id"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Career     string `json:"career"`
+	Semester   string `json:"semester"`
+	TeacherIDs []uint `json:"teacher_ids"`
+}
+
+type setTeachersRequest struct {
+	TeacherIDs []uint `json:"teacher_ids"`
+}
+
+type addReserveRequest struct {
+	BookID uint   `json:"book_id"`
+	Kind   string `json:"kind"`
+	Notes  string `json:"notes"`
+}
+
+type reorderReservesRequest struct {
+	BookIDs []uint `json:"book_ids"`
+}
+
+func (h *CourseHandler) Create(c *fiber.Ctx) error {
+	var body createCourseRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.PeriodID == 0 || strings.TrimSpace(body.Code) == "" || strings.TrimSpace(body.Name) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing fields"})
+	}
+
+	course := &models.Course{
+		PeriodID: body.PeriodID,
+		Code:     strings.ToUpper(strings.TrimSpace(body.Code)),
+		Name:     strings.TrimSpace(body.Name),
+		Career:   strings.TrimSpace(body.Career),
+		Semester: strings.TrimSpace(body.Semester),
+	}
+
+	if err := h.courses.Create(course, body.TeacherIDs); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusCreated).JSON(course)
+}
+
+func (h *CourseHandler) List(c *fiber.Ctx) error {
+	periodID, err := optionalUintQuery(c, "period_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid period_id"})
+	}
+
+	items, err := h.courses.List(periodID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *CourseHandler) SetTeachers(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body setTeachersRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	course, err := h.courses.SetTeachers(uint(id), body.TeacherIDs)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(course)
+}
+
+func (h *CourseHandler) ListTeaching(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	periodID, err := optionalUintQuery(c, "period_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid period_id"})
+	}
+
+	items, err := h.courses.ListForTeacher(userID, periodID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *CourseHandler) ListReserves(c *fiber.Ctx) error {
+	courseID, ok := h.authorizeCourse(c)
+	if !ok {
+		return nil
+	}
+
+	items, err := h.courses.ListReserves(courseID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *CourseHandler) AddReserve(c *fiber.Ctx) error {
+	courseID, ok := h.authorizeCourse(c)
+	if !ok {
+		return nil
+	}
+
+	var body addReserveRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.BookID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing book_id"})
+	}
+
+	reserve := &models.CourseReserve{
+		CourseID: courseID,
+		BookID:   body.BookID,
+		Kind:     models.ReserveKind(strings.ToUpper(strings.TrimSpace(body.Kind))),
+		Notes:    strings.TrimSpace(body.Notes),
+	}
+
+	if err := h.courses.AddReserve(reserve); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusCreated).JSON(reserve)
+}
+
+func (h *CourseHandler) RemoveReserve(c *fiber.Ctx) error {
+	courseID, ok := h.authorizeCourse(c)
+	if !ok {
+		return nil
+	}
+
+	bookID, err := strconv.ParseUint(c.Params("bookId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid book id"})
+	}
+
+	if err := h.courses.RemoveReserve(courseID, uint(bookID)); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "reserve removed"})
+}
+
+func (h *CourseHandler) ReorderReserves(c *fiber.Ctx) error {
+	courseID, ok := h.authorizeCourse(c)
+	if !ok {
+		return nil
+	}
+
+	var body reorderReservesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	if err := h.courses.ReorderReserves(courseID, body.BookIDs); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "reserves reordered"})
+}
+
+func (h *CourseHandler) MyCourses(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
+	}
+
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
+	}
+
+	items, err := h.courses.ListForEnrollment(enrollment)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *CourseHandler) authorizeCourse(c *fiber.Ctx) (uint, bool) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+		return 0, false
+	}
+
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return 0, false
+	}
+	role, _ := c.Locals("role").(string)
+
+	allowed, err := h.courses.CanManage(uint(id), userID, role)
+	if err != nil {
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return 0, false
+	}
+	if !allowed {
+		c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not a teacher of this course"})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func optionalUintQuery(c *fiber.Ctx, key string) (*uint, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id := uint(parsed)
+	return &id, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -66,3 +67,43 @@ func (h *EnrollmentHandler) Create(c *fiber.Ctx) error {
 
 	return c.Status(http.StatusCreated).JSON(enrollment)
 }
+
+func (h *EnrollmentHandler) Import(c *fiber.Ctx) error {
+	periodID, err := optionalUintQuery(c, "period_id")
+	if err != nil || periodID == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "period_id is required"})
+	}
+	data, err := readImportPayload(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(data) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	report, err := h.enrollments.Import(*periodID, data, c.QueryBool("dry_run", false))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrPeriodNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrInvalidRoster):
+			status = http.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(report)
+}
+
+func (h *EnrollmentHandler) ListPending(c *fiber.Ctx) error {
+	periodID, err := optionalUintQuery(c, "period_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid period_id"})
+	}
+
+	items, err := h.enrollments.ListPending(periodID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
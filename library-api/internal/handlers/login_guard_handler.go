@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type LoginGuardHandler struct {
+	guard *services.LoginGuard
+}
+
+func NewLoginGuardHandler(guard *services.LoginGuard) *LoginGuardHandler {
+	return &LoginGuardHandler{guard: guard}
+}
+
+func (h *LoginGuardHandler) ListLocks(c *fiber.Ctx) error {
+	items, err := h.guard.ListLocks(c.Query("all") != "true")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *LoginGuardHandler) Unlock(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	subject, err := url.PathUnescape(c.Params("subject"))
+	if err != nil || strings.TrimSpace(subject) == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid subject"})
+	}
+
+	if err := h.guard.Unlock(throttleScope(c.Params("scope")), subject, userID); err != nil {
+		return c.Status(loginGuardErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "login unlocked"})
+}
+
+func (h *LoginGuardHandler) ListAudit(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter := services.AuthAuditFilter{
+		Event:   models.AuthAuditEvent(strings.ToUpper(strings.TrimSpace(c.Query("event")))),
+		Subject: c.Query("subject"),
+		Offset:  (page - 1) * limit,
+		Limit:   limit,
+	}
+	if scope := c.Query("scope"); scope != "" {
+		filter.Scope = throttleScope(scope)
+		if !services.ValidThrottleScope(filter.Scope) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": services.ErrInvalidScope.Error()})
+		}
+	}
+
+	items, total, err := h.guard.ListAudit(filter)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func throttleScope(value string) models.ThrottleScope {
+	return models.ThrottleScope(strings.ToUpper(strings.TrimSpace(value)))
+}
+
+func loginGuardErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrLockNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidScope):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type MailHandler struct {
+	mail *services.MailService
+}
+
+func NewMailHandler(mail *services.MailService) *MailHandler {
+	return &MailHandler{mail: mail}
+}
+
+func (h *MailHandler) ListOutbox(c *fiber.Ctx) error {
+	items, err := h.mail.ListOutbox(c.Query("status"))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *MailHandler) Retry(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.mail.Retry(uint(id)); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "email queued"})
+}
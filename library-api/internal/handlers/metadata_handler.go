@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type MetadataHandler struct {
+	metadata *services.MetadataService
+}
+
+func NewMetadataHandler(metadata *services.MetadataService) *MetadataHandler {
+	return &MetadataHandler{metadata: metadata}
+}
+
+func (h *MetadataHandler) LookupISBN(c *fiber.Ctx) error {
+	lookup, err := h.metadata.LookupISBN(c.UserContext(), c.Params("isbn"), c.QueryBool("refresh", false))
+	if errors.Is(err, services.ErrInvalidISBN) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		if lookup != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error(), "details": lookup.Errors})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !lookup.Found {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": services.ErrMetadataNotFound.Error(), "isbn": lookup.ISBN})
+	}
+
+	return c.JSON(lookup)
+}
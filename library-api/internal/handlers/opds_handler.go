@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+const (
+	opdsBasePath = "/api/opds"
+	opdsPageSize = 25
+)
+
+type OPDSHandler struct {
+	books       *services.BookService
+	categories  *services.CategoryService
+	assets      *services.AssetService
+	enrollments *services.EnrollmentService
+	periods     *services.PeriodService
+	policies    *services.PolicyService
+	s3          *services.S3Service
+}
+
+func NewOPDSHandler(books *services.BookService, categories *services.CategoryService, assets *services.AssetService, enrollments *services.EnrollmentService, periods *services.PeriodService, policies *services.PolicyService, s3 *services.S3Service) *OPDSHandler {
+	return &OPDSHandler{books: books, categories: categories, assets: assets, enrollments: enrollments, periods: periods, policies: policies, s3: s3}
+}
+
+type opdsPage struct {
+	title  string
+	self   string
+	page   int
+	total  int64
+	books  []models.Book
+	assets map[uint][]models.BookAsset
+}
+
+func (h *OPDSHandler) Root(c *fiber.Ctx) error {
+	categories, err := h.categories.List()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	feed := newAtomFeed("urn:library:opds:root", "Biblioteca digital", opdsBasePath, opdsNavigationType)
+	feed.Entries = append(feed.Entries, atomEntry{
+		ID:      "urn:library:opds:books",
+		Title:   "Todos los libros",
+		Updated: feed.Updated,
+		Content: &atomText{Type: "text", Body: "Catalogo completo, mas recientes primero"},
+		Links:   []atomLink{{Rel: relSubsection, Href: opdsBasePath + "/books", Type: opdsAcquisitionType}},
+	})
+	for _, category := range categories {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      fmt.Sprintf("urn:library:opds:category:%d", category.ID),
+			Title:   category.Name,
+			Updated: category.UpdatedAt.UTC().Format(time.RFC3339),
+			Content: &atomText{Type: "text", Body: "Libros de " + category.Name},
+			Links:   []atomLink{{Rel: relSubsection, Href: fmt.Sprintf("%s/categories/%d", opdsBasePath, category.ID), Type: opdsAcquisitionType}},
+		})
+	}
+
+	return writeAtom(c, opdsNavigationType, feed)
+}
+
+func (h *OPDSHandler) Books(c *fiber.Ctx) error {
+	page, err := h.loadPage(c, "Todos los libros", opdsBasePath+"/books", "", nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return writeAtom(c, opdsAcquisitionType, h.acquisitionFeed(page))
+}
+
+func (h *OPDSHandler) Category(c *fiber.Ctx) error {
+	category, ok := h.findCategory(c)
+	if !ok {
+		return nil
+	}
+	page, err := h.loadPage(c, category.Name, fmt.Sprintf("%s/categories/%d", opdsBasePath, category.ID), "", &category.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return writeAtom(c, opdsAcquisitionType, h.acquisitionFeed(page))
+}
+
+func (h *OPDSHandler) Search(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	page, err := h.loadPage(c, "Resultados: "+query, opdsBasePath+"/search?q="+url.QueryEscape(query), query, nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return writeAtom(c, opdsAcquisitionType, h.acquisitionFeed(page))
+}
+
+func (h *OPDSHandler) OpenSearch(c *fiber.Ctx) error {
+	description := openSearchDescription{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   "Biblioteca",
+		Description: "Buscar en el catalogo de la biblioteca digital",
+		InputEnc:    "UTF-8",
+		OutputEnc:   "UTF-8",
+		URLs: []openSearchURL{{
+			Type:     opdsAcquisitionType,
+			Template: c.BaseURL() + opdsBasePath + "/search?q={searchTerms}",
+		}},
+	}
+	payload, err := xml.MarshalIndent(description, "", "  ")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, openSearchType+"; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), payload...))
+}
+
+func (h *OPDSHandler) RootV2(c *fiber.Ctx) error {
+	categories, err := h.categories.List()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	feed := opds2Feed{
+		Metadata: opds2FeedMetadata{Title: "Biblioteca digital"},
+		Links:    opds2FeedLinks(opdsBasePath + "/v2/catalog"),
+		Navigation: []opds2Link{{
+			Rel:   relSubsection,
+			Href:  opdsBasePath + "/v2/books",
+			Type:  opdsJSONType,
+			Title: "Todos los libros",
+		}},
+	}
+	for _, category := range categories {
+		feed.Navigation = append(feed.Navigation, opds2Link{
+			Rel:   relSubsection,
+			Href:  fmt.Sprintf("%s/v2/categories/%d", opdsBasePath, category.ID),
+			Type:  opdsJSONType,
+			Title: category.Name,
+		})
+	}
+
+	return c.JSON(feed, opdsJSONType)
+}
+
+func (h *OPDSHandler) BooksV2(c *fiber.Ctx) error {
+	page, err := h.loadPage(c, "Todos los libros", opdsBasePath+"/v2/books", "", nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(h.publicationsFeed(page), opdsJSONType)
+}
+
+func (h *OPDSHandler) CategoryV2(c *fiber.Ctx) error {
+	category, ok := h.findCategory(c)
+	if !ok {
+		return nil
+	}
+	page, err := h.loadPage(c, category.Name, fmt.Sprintf("%s/v2/categories/%d", opdsBasePath, category.ID), "", &category.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(h.publicationsFeed(page), opdsJSONType)
+}
+
+func (h *OPDSHandler) SearchV2(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("query", c.Query("q")))
+	page, err := h.loadPage(c, "Resultados: "+query, opdsBasePath+"/v2/search?query="+url.QueryEscape(query), query, nil)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(h.publicationsFeed(page), opdsJSONType)
+}
+
+func (h *OPDSHandler) Acquire(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	assetID, err := strconv.ParseUint(c.Params("assetId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid asset id"})
+	}
+
+	book, err := h.books.FindByID(uint(id))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+	if !book.IsDownloadable {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "book is not downloadable"})
+	}
+
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
+	}
+
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access"})
+	}
+
+	role, _ := c.Locals("role").(string)
+	decision, err := h.policies.Evaluate(book, services.SubjectFromEnrollment(role, enrollment))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !decision.Allowed {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no access", "reasons": decision.Reasons})
+	}
+
+	selected := uint(assetID)
+	asset, err := h.assets.Resolve(book, &selected, "")
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "asset not found"})
+	}
+
+	url, err := h.s3.PresignGetURL(c.Context(), asset.StorageKey, 15*time.Minute)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate url"})
+	}
+
+	return c.Redirect(url, http.StatusFound)
+}
+
+func (h *OPDSHandler) findCategory(c *fiber.Ctx) (*models.Category, bool) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+		return nil, false
+	}
+	category, err := h.categories.FindByID(uint(id))
+	if err != nil {
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "category not found"})
+		return nil, false
+	}
+	return category, true
+}
+
+func (h *OPDSHandler) loadPage(c *fiber.Ctx, title string, self string, query string, categoryID *uint) (*opdsPage, error) {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	books, total, err := h.books.List(services.BookFilter{Query: query, CategoryID: categoryID, Offset: (page - 1) * opdsPageSize, Limit: opdsPageSize})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	assets, err := h.assets.ListByBooks(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return &opdsPage{title: title, self: self, page: page, total: total, books: books, assets: assets}, nil
+}
+
+func (h *OPDSHandler) acquisitionFeed(page *opdsPage) atomFeed {
+	feed := newAtomFeed("urn:library:opds:"+page.self, page.title, pageHref(page.self, page.page), opdsAcquisitionType)
+	total := page.total
+	size := opdsPageSize
+	start := (page.page-1)*opdsPageSize + 1
+	feed.TotalResults = &total
+	feed.ItemsPerPage = &size
+	feed.StartIndex = &start
+	feed.Links = append(feed.Links, pagingLinks(page, opdsAcquisitionType)...)
+
+	for _, book := range page.books {
+		entry := atomEntry{
+			ID:       fmt.Sprintf("urn:library:book:%d", book.ID),
+			Title:    book.Title,
+			Updated:  book.UpdatedAt.UTC().Format(time.RFC3339),
+			Authors:  []atomAuthor{{Name: book.Author}},
+			Language: book.Language,
+		}
+		if book.Category.ID != 0 {
+			entry.Categories = []atomCategory{{Term: book.Category.Slug, Label: book.Category.Name}}
+		}
+		if book.Description != "" {
+			entry.Summary = &atomText{Type: "text", Body: book.Description}
+		}
+		if book.CoverURL != "" {
+			entry.Links = append(entry.Links,
+				atomLink{Rel: relImage, Href: book.CoverURL, Type: "image/jpeg"},
+				atomLink{Rel: relThumbnail, Href: book.CoverURL, Type: "image/jpeg"},
+			)
+		}
+		for _, asset := range page.assets[book.ID] {
+			if entry.Language == "" {
+				entry.Language = asset.Language
+			}
+			if !book.IsDownloadable {
+				continue
+			}
+			entry.Links = append(entry.Links, atomLink{
+				Rel:   relAcquisition,
+				Href:  acquireHref(book.ID, asset.ID),
+				Type:  asset.ContentType,
+				Title: assetTitle(asset),
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func (h *OPDSHandler) publicationsFeed(page *opdsPage) opds2Feed {
+	total := page.total
+	size := opdsPageSize
+	current := page.page
+	feed := opds2Feed{
+		Metadata: opds2FeedMetadata{Title: page.title, NumberOfItems: &total, ItemsPerPage: &size, CurrentPage: &current},
+		Links:    opds2FeedLinks(pageHref(page.self, page.page)),
+	}
+	for _, link := range pagingLinks(page, opdsJSONType) {
+		feed.Links = append(feed.Links, opds2Link{Rel: link.Rel, Href: link.Href, Type: link.Type})
+	}
+
+	feed.Publications = make([]opds2Publication, 0, len(page.books))
+	for _, book := range page.books {
+		publication := opds2Publication{
+			Metadata: opds2PublicationMetadata{
+				Type:        "http://schema.org/Book",
+				Identifier:  fmt.Sprintf("urn:library:book:%d", book.ID),
+				Title:       book.Title,
+				Author:      []opds2Contrib{{Name: book.Author}},
+				Language:    book.Language,
+				Modified:    book.UpdatedAt.UTC().Format(time.RFC3339),
+				Description: book.Description,
+			},
+			Links: []opds2Link{{Rel: "self", Href: fmt.Sprintf("/api/books/%d", book.ID), Type: "application/json"}},
+		}
+		if book.Category.ID != 0 {
+			publication.Metadata.Subject = []opds2Contrib{{Name: book.Category.Name}}
+		}
+		if book.CoverURL != "" {
+			publication.Images = []opds2Link{{Href: book.CoverURL, Type: "image/jpeg"}}
+		}
+		for _, asset := range page.assets[book.ID] {
+			if publication.Metadata.Language == "" {
+				publication.Metadata.Language = asset.Language
+			}
+			if !book.IsDownloadable {
+				continue
+			}
+			publication.Links = append(publication.Links, opds2Link{
+				Rel:   relAcquisition,
+				Href:  acquireHref(book.ID, asset.ID),
+				Type:  asset.ContentType,
+				Title: assetTitle(asset),
+			})
+		}
+		feed.Publications = append(feed.Publications, publication)
+	}
+	return feed
+}
+
+func newAtomFeed(id string, title string, self string, selfType string) atomFeed {
+	return atomFeed{
+		Xmlns:       "http://www.w3.org/2005/Atom",
+		XmlnsDC:     "http://purl.org/dc/terms/",
+		XmlnsOPDS:   "http://opds-spec.org/2010/catalog",
+		XmlnsSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		ID:          id,
+		Title:       title,
+		Updated:     time.Now().UTC().Format(time.RFC3339),
+		Author:      atomAuthor{Name: "Biblioteca digital"},
+		Links: []atomLink{
+			{Rel: "self", Href: self, Type: selfType},
+			{Rel: "start", Href: opdsBasePath, Type: opdsNavigationType},
+			{Rel: "search", Href: opdsBasePath + "/opensearch.xml", Type: openSearchType},
+		},
+	}
+}
+
+func opds2FeedLinks(self string) []opds2Link {
+	return []opds2Link{
+		{Rel: "self", Href: self, Type: opdsJSONType},
+		{Rel: "start", Href: opdsBasePath + "/v2/catalog", Type: opdsJSONType},
+		{Rel: "search", Href: opdsBasePath + "/v2/search{?query}", Type: opdsJSONType, Templated: true},
+	}
+}
+
+func pagingLinks(page *opdsPage, linkType string) []atomLink {
+	links := []atomLink{}
+	if page.page > 1 {
+		links = append(links, atomLink{Rel: "previous", Href: pageHref(page.self, page.page-1), Type: linkType})
+	}
+	if int64(page.page*opdsPageSize) < page.total {
+		links = append(links, atomLink{Rel: "next", Href: pageHref(page.self, page.page+1), Type: linkType})
+	}
+	return links
+}
+
+func pageHref(base string, page int) string {
+	if page <= 1 {
+		return base
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "page=" + strconv.Itoa(page)
+}
+
+func acquireHref(bookID uint, assetID uint) string {
+	return fmt.Sprintf("%s/books/%d/assets/%d/acquire", opdsBasePath, bookID, assetID)
+}
+
+func assetTitle(asset models.BookAsset) string {
+	title := asset.Format
+	if asset.Edition != "" {
+		title += " - " + asset.Edition
+	}
+	return title
+}
+
+func writeAtom(c *fiber.Ctx, contentType string, feed atomFeed) error {
+	payload, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, contentType+"; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), payload...))
+}
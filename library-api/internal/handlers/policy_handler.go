@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type PolicyHandler struct {
+	policies    *services.PolicyService
+	books       *services.BookService
+	users       *services.UserService
+	enrollments *services.EnrollmentService
+	periods     *services.PeriodService
+}
+
+func NewPolicyHandler(policies *services.PolicyService, books *services.BookService, users *services.UserService, enrollments *services.EnrollmentService, periods *services.PeriodService) *PolicyHandler {
+	return &PolicyHandler{policies: policies, books: books, users: users, enrollments: enrollments, periods: periods}
+}
+
+type createPolicyRequest struct {
+	BookID      *uint  `json:"book_id"`
+	CategoryID  *uint  `json:"category_id"`
+	Effect      string `json:"effect"`
+	Career      string `json:"career"`
+	SemesterMin *int   `json:"semester_min"`
+	SemesterMax *int   `json:"semester_max"`
+	Role        string `json:"role"`
+	Description string `json:"description"`
+}
+
+type simulatePolicyRequest struct {
+	BookID   uint   `json:"book_id"`
+	UserID   uint   `json:"user_id"`
+	Role     string `json:"role"`
+	Career   string `json:"career"`
+	Semester *int   `json:"semester"`
+}
+
+func (h *PolicyHandler) Create(c *fiber.Ctx) error {
+	var body createPolicyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	rule := &models.AccessRule{
+		BookID:      body.BookID,
+		CategoryID:  body.CategoryID,
+		Effect:      models.PolicyEffect(body.Effect),
+		Career:      body.Career,
+		SemesterMin: body.SemesterMin,
+		SemesterMax: body.SemesterMax,
+		Role:        body.Role,
+		Description: strings.TrimSpace(body.Description),
+	}
+
+	if err := h.policies.Create(rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(http.StatusCreated).JSON(rule)
+}
+
+func (h *PolicyHandler) List(c *fiber.Ctx) error {
+	bookID, err := optionalUintQuery(c, "book_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid book_id"})
+	}
+	categoryID, err := optionalUintQuery(c, "category_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+	}
+
+	items, err := h.policies.List(bookID, categoryID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *PolicyHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.policies.Delete(uint(id)); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "rule deleted"})
+}
+
+func (h *PolicyHandler) Simulate(c *fiber.Ctx) error {
+	var body simulatePolicyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.BookID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing book_id"})
+	}
+
+	book, err := h.books.FindByID(body.BookID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "book not found"})
+	}
+
+	subject := services.AccessSubject{
+		Role:     strings.ToUpper(strings.TrimSpace(body.Role)),
+		Career:   strings.TrimSpace(body.Career),
+		Semester: body.Semester,
+	}
+
+	if body.UserID != 0 {
+		user, err := h.users.FindByID(body.UserID)
+		if err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+		}
+		currentPeriod, err := h.periods.GetCurrent()
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "no current period"})
+		}
+		enrollment, err := h.enrollments.GetActiveEnrollment(user.ID, currentPeriod.ID)
+		if err != nil {
+			return c.JSON(fiber.Map{
+				"subject":  services.AccessSubject{Role: string(user.Role)},
+				"decision": services.AccessDecision{Reasons: []string{"no active enrollment with access in period " + currentPeriod.Name}},
+			})
+		}
+		subject = services.SubjectFromEnrollment(string(user.Role), enrollment)
+	}
+
+	decision, err := h.policies.Evaluate(book, subject)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"subject": subject, "decision": decision})
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type ReadingListHandler struct {
+	lists *services.ReadingListService
+}
+
+func NewReadingListHandler(lists *services.ReadingListService) *ReadingListHandler {
+	return &ReadingListHandler{lists: lists}
+}
+
+type createReadingListRequest struct {
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+}
+
+type updateReadingListRequest struct {
+	Name       *string `json:"name"`
+	Visibility *string `json:"visibility"`
+}
+
+type addListBookRequest struct {
+	BookID uint `json:"book_id"`
+}
+
+type reorderListRequest struct {
+	BookIDs []uint `json:"book_ids"`
+}
+
+func (h *ReadingListHandler) List(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	items, err := h.lists.ListForUser(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *ReadingListHandler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var body createReadingListRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	list, err := h.lists.Create(userID, body.Name, listVisibility(body.Visibility))
+	if err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(list)
+}
+
+func (h *ReadingListHandler) GetByID(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	list, err := h.lists.Get(userID, uint(id))
+	if err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+func (h *ReadingListHandler) GetShared(c *fiber.Ctx) error {
+	list, err := h.lists.FindShared(c.Params("token"))
+	if err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"id":    list.ID,
+		"name":  list.Name,
+		"items": list.Items,
+	})
+}
+
+func (h *ReadingListHandler) Update(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body updateReadingListRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	var visibility *models.ListVisibility
+	if body.Visibility != nil {
+		value := listVisibility(*body.Visibility)
+		visibility = &value
+	}
+
+	list, err := h.lists.Update(userID, uint(id), body.Name, visibility)
+	if err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+func (h *ReadingListHandler) Delete(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.lists.Delete(userID, uint(id)); err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "list deleted"})
+}
+
+func (h *ReadingListHandler) AddBook(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body addListBookRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.BookID == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing book_id"})
+	}
+
+	if err := h.lists.AddBook(userID, uint(id), body.BookID); err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "book added"})
+}
+
+func (h *ReadingListHandler) RemoveBook(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	bookID, err := strconv.ParseUint(c.Params("bookId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid book id"})
+	}
+
+	if err := h.lists.RemoveBook(userID, uint(id), uint(bookID)); err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "book removed"})
+}
+
+func (h *ReadingListHandler) Reorder(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body reorderListRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	if err := h.lists.Reorder(userID, uint(id), body.BookIDs); err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "list reordered"})
+}
+
+func (h *ReadingListHandler) AddFavorite(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookID, err := strconv.ParseUint(c.Params("bookId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid book id"})
+	}
+
+	if err := h.lists.AddFavorite(userID, uint(bookID)); err != nil {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"book_id": bookID, "is_favorite": true})
+}
+
+func (h *ReadingListHandler) RemoveFavorite(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookID, err := strconv.ParseUint(c.Params("bookId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid book id"})
+	}
+
+	if err := h.lists.RemoveFavorite(userID, uint(bookID)); err != nil && !errors.Is(err, services.ErrBookNotInList) {
+		return c.Status(readingListErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"book_id": bookID, "is_favorite": false})
+}
+
+func listVisibility(value string) models.ListVisibility {
+	return models.ListVisibility(strings.ToUpper(strings.TrimSpace(value)))
+}
+
+func readingListErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrListNotFound), errors.Is(err, services.ErrBookNotFound), errors.Is(err, services.ErrBookNotInList):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrListName), errors.Is(err, services.ErrInvalidVisibility), errors.Is(err, services.ErrInvalidListOrder):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrFavoritesList):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
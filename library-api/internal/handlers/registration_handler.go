@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type RegistrationHandler struct {
+	registration *services.RegistrationService
+}
+
+func NewRegistrationHandler(registration *services.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{registration: registration}
+}
+
+type createInviteRequest struct {
+	Email     string     `json:"email"`
+	MaxUses   int        `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (h *RegistrationHandler) ListInvites(c *fiber.Ctx) error {
+	items, err := h.registration.ListInvites()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *RegistrationHandler) CreateInvite(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var body createInviteRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		}
+	}
+
+	code, invite, err := h.registration.CreateInvite(body.Email, body.MaxUses, body.ExpiresAt, userID)
+	if err != nil {
+		return c.Status(inviteErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"code": code, "invite": invite})
+}
+
+func (h *RegistrationHandler) RevokeInvite(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.registration.RevokeInvite(uint(id)); err != nil {
+		return c.Status(inviteErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "invitation revoked"})
+}
+
+func inviteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInviteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidMaxUses), errors.Is(err, services.ErrInvalidExpiry):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
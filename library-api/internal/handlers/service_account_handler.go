@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type ServiceAccountHandler struct {
+	accounts *services.ServiceAccountService
+}
+
+func NewServiceAccountHandler(accounts *services.ServiceAccountService) *ServiceAccountHandler {
+	return &ServiceAccountHandler{accounts: accounts}
+}
+
+type createServiceAccountRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type rotateAPIKeyRequest struct {
+	Overlap string `json:"overlap"`
+}
+
+func (h *ServiceAccountHandler) List(c *fiber.Ctx) error {
+	items, err := h.accounts.List()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *ServiceAccountHandler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var body createServiceAccountRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	role := models.Role(strings.ToUpper(strings.TrimSpace(body.Role)))
+	account, err := h.accounts.Create(body.Name, body.Description, role, userID)
+	if err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(account)
+}
+
+func (h *ServiceAccountHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	account, err := h.accounts.FindByID(uint(id))
+	if err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(account)
+}
+
+func (h *ServiceAccountHandler) Deactivate(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(uint); !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.accounts.Deactivate(uint(id)); err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "service account deactivated"})
+}
+
+func (h *ServiceAccountHandler) CreateKey(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(uint); !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body createAPIKeyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	secret, key, err := h.accounts.CreateKey(uint(id), body.Name, body.Scopes, body.ExpiresAt)
+	if err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"key": secret, "api_key": key})
+}
+
+func (h *ServiceAccountHandler) RotateKey(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(uint); !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	keyID, err := strconv.ParseUint(c.Params("keyId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid key id"})
+	}
+
+	var body rotateAPIKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		}
+	}
+	var overlap time.Duration
+	if body.Overlap != "" {
+		overlap, err = time.ParseDuration(body.Overlap)
+		if err != nil || overlap < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid overlap"})
+		}
+	}
+
+	secret, key, err := h.accounts.RotateKey(uint(id), uint(keyID), overlap)
+	if err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"key": secret, "api_key": key})
+}
+
+func (h *ServiceAccountHandler) RevokeKey(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(uint); !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	keyID, err := strconv.ParseUint(c.Params("keyId"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid key id"})
+	}
+
+	if err := h.accounts.RevokeKey(uint(id), uint(keyID)); err != nil {
+		return c.Status(serviceAccountErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "api key revoked"})
+}
+
+func serviceAccountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound), errors.Is(err, services.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrServiceAccountName), errors.Is(err, services.ErrInvalidUserRole), errors.Is(err, services.ErrInvalidAPIScope),
+		errors.Is(err, services.ErrInvalidExpiry):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrServiceAccountExists), errors.Is(err, services.ErrServiceAccountInactive), errors.Is(err, services.ErrAPIKeyRevoked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
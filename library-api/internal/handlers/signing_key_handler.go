@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type SigningKeyHandler struct {
+	keys *services.SigningKeyService
+}
+
+func NewSigningKeyHandler(keys *services.SigningKeyService) *SigningKeyHandler {
+	return &SigningKeyHandler{keys: keys}
+}
+
+func (h *SigningKeyHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{"keys": h.keys.JWKS()})
+}
+
+func (h *SigningKeyHandler) List(c *fiber.Ctx) error {
+	items, err := h.keys.List()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *SigningKeyHandler) Rotate(c *fiber.Ctx) error {
+	key, err := h.keys.Rotate()
+	if err != nil {
+		return c.Status(signingKeyErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusCreated).JSON(key)
+}
+
+func (h *SigningKeyHandler) Revoke(c *fiber.Ctx) error {
+	if err := h.keys.Revoke(c.Params("kid")); err != nil {
+		return c.Status(signingKeyErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "signing key revoked"})
+}
+
+func signingKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSigningKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSigningKeyInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type SuggestionHandler struct {
+	suggestions *services.SuggestionService
+	enrollments *services.EnrollmentService
+	periods     *services.PeriodService
+}
+
+func NewSuggestionHandler(suggestions *services.SuggestionService, enrollments *services.EnrollmentService, periods *services.PeriodService) *SuggestionHandler {
+	return &SuggestionHandler{suggestions: suggestions, enrollments: enrollments, periods: periods}
+}
+
+type createSuggestionRequest struct {
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	ISBN          string `json:"isbn"`
+	Justification string `json:"justification"`
+}
+
+type suggestionStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+	BookID *uint  `json:"book_id"`
+}
+
+type mergeSuggestionsRequest struct {
+	SourceIDs []uint `json:"source_ids"`
+}
+
+func (h *SuggestionHandler) List(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(uint)
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	filter := services.SuggestionFilter{
+		Status: models.SuggestionStatus(strings.ToUpper(strings.TrimSpace(c.Query("status")))),
+		Query:  c.Query("q"),
+		Sort:   c.Query("sort"),
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if filter.Status != "" && !services.ValidSuggestionStatus(filter.Status) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": services.ErrInvalidStatus.Error()})
+	}
+
+	items, total, err := h.suggestions.List(filter, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func (h *SuggestionHandler) GetByID(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(uint)
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	suggestion, err := h.suggestions.FindByID(uint(id), userID)
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suggestion)
+}
+
+func (h *SuggestionHandler) Create(c *fiber.Ctx) error {
+	enrollment, ok := h.currentEnrollment(c)
+	if !ok {
+		return nil
+	}
+
+	var body createSuggestionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	suggestion, duplicate, err := h.suggestions.Create(&models.Suggestion{
+		UserID:        enrollment.UserID,
+		EnrollmentID:  enrollment.ID,
+		Title:         body.Title,
+		Author:        body.Author,
+		ISBN:          body.ISBN,
+		Justification: body.Justification,
+	})
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if duplicate {
+		return c.JSON(fiber.Map{"duplicate": true, "suggestion": suggestion})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"duplicate": false, "suggestion": suggestion})
+}
+
+func (h *SuggestionHandler) Vote(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	enrollment, ok := h.currentEnrollment(c)
+	if !ok {
+		return nil
+	}
+
+	suggestion, err := h.suggestions.Vote(uint(id), enrollment.UserID, enrollment.ID)
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suggestion)
+}
+
+func (h *SuggestionHandler) Unvote(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	suggestion, err := h.suggestions.Unvote(uint(id), userID)
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suggestion)
+}
+
+func (h *SuggestionHandler) SetStatus(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body suggestionStatusRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	status := models.SuggestionStatus(strings.ToUpper(strings.TrimSpace(body.Status)))
+	suggestion, err := h.suggestions.SetStatus(uint(id), status, body.Note, body.BookID)
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suggestion)
+}
+
+func (h *SuggestionHandler) Merge(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body mergeSuggestionsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	suggestion, err := h.suggestions.Merge(uint(id), body.SourceIDs)
+	if err != nil {
+		return c.Status(suggestionErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suggestion)
+}
+
+func (h *SuggestionHandler) currentEnrollment(c *fiber.Ctx) (*models.Enrollment, bool) {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return nil, false
+	}
+	currentPeriod, err := h.periods.GetCurrent()
+	if err != nil {
+		c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no current period"})
+		return nil, false
+	}
+	enrollment, err := h.enrollments.GetActiveEnrollment(userID, currentPeriod.ID)
+	if err != nil {
+		c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "no active enrollment"})
+		return nil, false
+	}
+	return enrollment, true
+}
+
+func suggestionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSuggestionNotFound), errors.Is(err, services.ErrBookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSuggestionFields), errors.Is(err, services.ErrInvalidISBN), errors.Is(err, services.ErrInvalidStatus),
+		errors.Is(err, services.ErrInvalidSuggestionIDs):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSuggestionClosed), errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrBookInCatalog):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
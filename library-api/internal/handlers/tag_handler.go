@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/internal/services"
+)
+
+type TagHandler struct {
+	tags *services.TagService
+}
+
+func NewTagHandler(tags *services.TagService) *TagHandler {
+	return &TagHandler{tags: tags}
+}
+
+type setBookTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func (h *TagHandler) List(c *fiber.Ctx) error {
+	items, err := h.tags.List(c.Query("q"))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
+
+func (h *TagHandler) SetBookTags(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	var body setBookTagsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+
+	tags, err := h.tags.SetBookTags(uint(id), body.Tags)
+	if err != nil {
+		return c.Status(tagErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": tags})
+}
+
+func (h *TagHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if err := h.tags.Delete(uint(id)); err != nil {
+		return c.Status(tagErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "tag deleted"})
+}
+
+func tagErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTagNotFound), errors.Is(err, services.ErrBookNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
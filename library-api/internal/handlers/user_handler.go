@@ -21,6 +21,8 @@ func NewUserHandler(users *services.UserService) *UserHandler {
 type createUserRequest struct {
 	DNI      string `json:"dni"`
 	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+	Locale   string `json:"locale"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
 }
@@ -37,7 +39,7 @@ func (h *UserHandler) Create(c *fiber.Ctx) error {
 	role := models.RoleStudent
 	if body.Role != "" {
 		normalized := strings.ToUpper(body.Role)
-		if normalized != string(models.RoleAdmin) && normalized != string(models.RoleStudent) {
+		if normalized != string(models.RoleAdmin) && normalized != string(models.RoleStudent) && normalized != string(models.RoleTeacher) {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid role"})
 		}
 		role = models.Role(normalized)
@@ -46,6 +48,8 @@ func (h *UserHandler) Create(c *fiber.Ctx) error {
 	user := &models.User{
 		DNI:      strings.TrimSpace(body.DNI),
 		FullName: strings.TrimSpace(body.FullName),
+		Email:    strings.TrimSpace(body.Email),
+		Locale:   normalizeLocale(body.Locale),
 		Role:     role,
 		IsActive: true,
 	}
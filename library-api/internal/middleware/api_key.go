@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+type APIKeyChecker func(key, ip string) (accountID uint, role string, scopes []string, err error)
+
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+func apiKeyAuth(c *fiber.Ctx, key string, keys APIKeyChecker) error {
+	if keys == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid api key"})
+	}
+	accountID, role, scopes, err := keys(key, c.IP())
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid api key"})
+	}
+	if !scopeAllows(scopes, c.Method(), c.Path()) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "insufficient scope"})
+	}
+
+	c.Locals("service_account_id", accountID)
+	c.Locals("role", role)
+	c.Locals("scopes", scopes)
+	return c.Next()
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, utils.APIKeyPrefix)
+}
+
+func scopeAllows(scopes []string, method string, path string) bool {
+	area := scopeArea(path)
+	write := !safeMethod(method)
+	for _, scope := range scopes {
+		if scope == "*" {
+			return true
+		}
+		name, level, found := strings.Cut(scope, ":")
+		if !found || name != area {
+			continue
+		}
+		if level == "*" || level == "write" || (level == "read" && !write) {
+			return true
+		}
+	}
+	return false
+}
+
+func scopeArea(path string) string {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api"), "/"), "/")
+	if len(segments) > 1 {
+		switch segments[0] {
+		case "admin", "teacher", "me":
+			return segments[1]
+		}
+	}
+	return segments[0]
+}
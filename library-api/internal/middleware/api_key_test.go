@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newAPIKeyApp(keys APIKeyChecker) *fiber.App {
+	app := fiber.New()
+	app.Use(AuthRequired(nil, "", nil, keys))
+	app.All("/api/*", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"account": c.Locals("service_account_id"), "role": c.Locals("role")})
+	})
+	return app
+}
+
+func TestAuthRequiredChecksAPIKeyScopes(t *testing.T) {
+	app := newAPIKeyApp(func(key, ip string) (uint, string, []string, error) {
+		if key != "lib_0011aabb_secret" {
+			return 0, "", nil, errors.New("invalid api key")
+		}
+		return 7, "TEACHER", []string{"books:read"}, nil
+	})
+
+	cases := []struct {
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{"GET", "/api/books", "lib_0011aabb_secret", fiber.StatusOK},
+		{"POST", "/api/books", "lib_0011aabb_secret", fiber.StatusForbidden},
+		{"GET", "/api/loans", "lib_0011aabb_secret", fiber.StatusForbidden},
+		{"GET", "/api/books", "lib_0011aabb_wrong", fiber.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tc.key)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Fatalf("%s %s with %s: got %d, want %d", tc.method, tc.path, tc.key, resp.StatusCode, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/books", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer lib_0011aabb_secret")
+	if resp, _ := newAPIKeyApp(nil).Test(req); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("api keys must be rejected without a checker, got %d", resp.StatusCode)
+	}
+}
+
+func TestScopeArea(t *testing.T) {
+	cases := map[string]string{
+		"/api/books":                 "books",
+		"/api/books/12/reviews":      "books",
+		"/api/admin/users":           "users",
+		"/api/admin/users/3/unlock":  "users",
+		"/api/teacher/reading-lists": "reading-lists",
+		"/api/me/loans":              "loans",
+		"/api/me":                    "me",
+		"/api/admin":                 "admin",
+		"/api/":                      "",
+	}
+	for path, want := range cases {
+		if got := scopeArea(path); got != want {
+			t.Fatalf("%s: got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		scopes []string
+		method string
+		path   string
+		want   bool
+	}{
+		{[]string{"*"}, "DELETE", "/api/admin/users/3", true},
+		{[]string{"books:read"}, "GET", "/api/books/12", true},
+		{[]string{"books:read"}, "HEAD", "/api/books", true},
+		{[]string{"books:read"}, "POST", "/api/books", false},
+		{[]string{"books:read"}, "GET", "/api/loans", false},
+		{[]string{"books:write"}, "PUT", "/api/books/12", true},
+		{[]string{"books:write"}, "GET", "/api/books/12", true},
+		{[]string{"books:*"}, "PATCH", "/api/books/12", true},
+		{[]string{"users:read"}, "GET", "/api/admin/users", true},
+		{[]string{"users:read"}, "POST", "/api/admin/users/3/unlock", false},
+		{[]string{"admin:*"}, "GET", "/api/admin/users", false},
+		{[]string{"books"}, "GET", "/api/books", false},
+		{[]string{"loans:read", "books:write"}, "POST", "/api/books", true},
+		{nil, "GET", "/api/books", false},
+	}
+	for _, tc := range cases {
+		if got := scopeAllows(tc.scopes, tc.method, tc.path); got != tc.want {
+			t.Fatalf("%v %s %s: got %v, want %v", tc.scopes, tc.method, tc.path, got, tc.want)
+		}
+	}
+}
@@ -1,28 +1,97 @@
 package middleware
 
 import (
+	"encoding/base64"
 	"net/http"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/jos3lo89/library-api/pkg/utils"
 )
 
-func AuthRequired(jwtSecret string) fiber.Handler {
+type SessionChecker func(userID uint, sessionVersion uint) error
+
+func AuthRequired(tokens *utils.TokenSettings, csrfSecret string, sessions SessionChecker, keys APIKeyChecker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		token := c.Cookies("access_token")
+		token, method := bearerToken(c), "bearer"
+		if isAPIKey(token) {
+			return apiKeyAuth(c, token, keys)
+		}
+		if token == "" {
+			token, method = c.Cookies("access_token"), "cookie"
+		}
 		if token == "" {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "missing token"})
 		}
 
-		claims, err := utils.ParseToken(token, jwtSecret)
-		if err != nil {
+		claims, err := utils.ParseToken(token, tokens)
+		if err != nil || claims.Scope != "" {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
 		}
+		if err := sessions(claims.UserID, claims.SessionVersion); err != nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "session expired"})
+		}
+		if method == "cookie" && !validCSRF(c, token, csrfSecret) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "invalid csrf token"})
+		}
 
 		c.Locals("user_id", claims.UserID)
 		c.Locals("role", claims.Role)
+		c.Locals("auth_method", method)
 
 		return c.Next()
 	}
 }
+
+func OptionalAuth(tokens *utils.TokenSettings, csrfSecret string, sessions SessionChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, method := bearerToken(c), "bearer"
+		if token == "" {
+			token, method = c.Cookies("access_token"), "cookie"
+		}
+		if token != "" && !isAPIKey(token) {
+			if claims, err := utils.ParseToken(token, tokens); err == nil && claims.Scope == "" && sessions(claims.UserID, claims.SessionVersion) == nil {
+				if method == "cookie" && !validCSRF(c, token, csrfSecret) {
+					return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "invalid csrf token"})
+				}
+				c.Locals("user_id", claims.UserID)
+				c.Locals("role", claims.Role)
+				c.Locals("auth_method", method)
+			}
+		}
+		return c.Next()
+	}
+}
+
+type CredentialChecker func(dni, password, ip string) (userID uint, role string, err error)
+
+func BasicOrCookieAuth(tokens *utils.TokenSettings, sessions SessionChecker, realm string, check CredentialChecker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token := c.Cookies("access_token"); token != "" {
+			if claims, err := utils.ParseToken(token, tokens); err == nil && claims.Scope == "" && sessions(claims.UserID, claims.SessionVersion) == nil {
+				c.Locals("user_id", claims.UserID)
+				c.Locals("role", claims.Role)
+				return c.Next()
+			}
+		}
+
+		header := c.Get(fiber.HeaderAuthorization)
+		if strings.HasPrefix(header, "Basic ") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+			if err == nil {
+				dni, password, found := strings.Cut(string(decoded), ":")
+				if found {
+					if userID, role, err := check(dni, password, c.IP()); err == nil {
+						c.Locals("user_id", userID)
+						c.Locals("role", role)
+						return c.Next()
+					}
+				}
+			}
+		}
+
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="`+realm+`", charset="UTF-8"`)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+}
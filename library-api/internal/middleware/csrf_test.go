@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const testCSRFSecret = "csrf-test-secret"
+
+type staticKeys struct {
+	key *utils.SigningKey
+}
+
+func (k staticKeys) SigningKey() (*utils.SigningKey, error) {
+	return k.key, nil
+}
+
+func (k staticKeys) VerificationKey(kid string) (*utils.SigningKey, error) {
+	if kid != k.key.ID {
+		return nil, errors.New("unknown kid")
+	}
+	return k.key, nil
+}
+
+func newTestTokens(t *testing.T) *utils.TokenSettings {
+	t.Helper()
+	key, err := utils.GenerateSigningKey(utils.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("signing key: %v", err)
+	}
+	return &utils.TokenSettings{Keys: staticKeys{key: key}, Issuer: "http://localhost:3000", Audience: "library-api"}
+}
+
+func newCSRFApp(t *testing.T) (*fiber.App, string) {
+	t.Helper()
+	tokens := newTestTokens(t)
+	token, err := utils.GenerateToken(5, "STUDENT", 0, tokens, time.Minute)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	sessions := func(userID uint, sessionVersion uint) error { return nil }
+
+	app := fiber.New()
+	app.Use(OriginCheck([]string{" https://biblioteca.example.edu/ "}))
+	app.All("/required", AuthRequired(tokens, testCSRFSecret, sessions, nil), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("auth_method").(string))
+	})
+	app.All("/optional", OptionalAuth(tokens, testCSRFSecret, sessions), func(c *fiber.Ctx) error {
+		if c.Locals("user_id") == nil {
+			return c.SendString("anonymous")
+		}
+		return c.SendString(c.Locals("auth_method").(string))
+	})
+	return app, token
+}
+
+func send(t *testing.T, app *fiber.App, method string, path string, headers map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestCookieAuthRequiresCSRFToken(t *testing.T) {
+	app, token := newCSRFApp(t)
+	cookie := "access_token=" + token
+	valid := utils.CSRFToken(token, testCSRFSecret)
+
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"safe method", "GET", map[string]string{"Cookie": cookie}, fiber.StatusOK},
+		{"missing header", "POST", map[string]string{"Cookie": cookie}, fiber.StatusForbidden},
+		{"wrong header", "DELETE", map[string]string{"Cookie": cookie, CSRFHeader: utils.CSRFToken(token, "other-secret")}, fiber.StatusForbidden},
+		{"token of another session", "PUT", map[string]string{"Cookie": cookie, CSRFHeader: utils.CSRFToken(token+"x", testCSRFSecret)}, fiber.StatusForbidden},
+		{"valid header", "POST", map[string]string{"Cookie": cookie, CSRFHeader: valid}, fiber.StatusOK},
+		{"bearer needs no csrf", "POST", map[string]string{"Authorization": "Bearer " + token}, fiber.StatusOK},
+	}
+	for _, tc := range cases {
+		for _, path := range []string{"/required", "/optional"} {
+			if got := send(t, app, tc.method, path, tc.headers); got != tc.want {
+				t.Fatalf("%s %s: got %d, want %d", tc.name, path, got, tc.want)
+			}
+		}
+	}
+
+	if got := send(t, app, "POST", "/optional", map[string]string{"Cookie": "access_token=garbage"}); got != fiber.StatusOK {
+		t.Fatalf("invalid cookies must fall back to anonymous access, got %d", got)
+	}
+	if got := send(t, app, "POST", "/required", map[string]string{"Cookie": "access_token=garbage", CSRFHeader: valid}); got != fiber.StatusUnauthorized {
+		t.Fatalf("expected 401 for an invalid cookie, got %d", got)
+	}
+}
+
+func TestOriginCheck(t *testing.T) {
+	app, token := newCSRFApp(t)
+	bearer := "Bearer " + token
+
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"no origin", "POST", map[string]string{}, fiber.StatusOK},
+		{"allowed origin", "POST", map[string]string{"Origin": "https://Biblioteca.example.edu"}, fiber.StatusOK},
+		{"same origin", "POST", map[string]string{"Origin": "http://example.com"}, fiber.StatusOK},
+		{"foreign origin", "POST", map[string]string{"Origin": "https://evil.example.com"}, fiber.StatusForbidden},
+		{"foreign origin on safe method", "GET", map[string]string{"Origin": "https://evil.example.com"}, fiber.StatusOK},
+		{"allowed referer", "PATCH", map[string]string{"Referer": "https://biblioteca.example.edu/prestamos?id=1"}, fiber.StatusOK},
+		{"foreign referer", "DELETE", map[string]string{"Referer": "https://evil.example.com/form"}, fiber.StatusForbidden},
+		{"opaque referer", "POST", map[string]string{"Referer": "about:blank"}, fiber.StatusForbidden},
+		{"null origin", "POST", map[string]string{"Origin": "null"}, fiber.StatusForbidden},
+		{"origin wins over referer", "POST", map[string]string{"Origin": "https://evil.example.com", "Referer": "https://biblioteca.example.edu/"}, fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		tc.headers["Authorization"] = bearer
+		if got := send(t, app, tc.method, "/required", tc.headers); got != tc.want {
+			t.Fatalf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
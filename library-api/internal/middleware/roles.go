@@ -18,3 +18,18 @@ func RequireRole(role string) fiber.Handler {
 		return c.Next()
 	}
 }
+
+func RequireAnyRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		currentRole, ok := c.Locals("role").(string)
+		if !ok || currentRole == "" {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "missing role"})
+		}
+		for _, role := range roles {
+			if currentRole == role {
+				return c.Next()
+			}
+		}
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "insufficient role"})
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "ALLOW"
+	PolicyDeny  PolicyEffect = "DENY"
+)
+
+type AccessRule struct {
+	gorm.Model
+	BookID      *uint        `gorm:"index" json:"book_id,omitempty"`
+	CategoryID  *uint        `gorm:"index" json:"category_id,omitempty"`
+	Effect      PolicyEffect `gorm:"type:varchar(10);not null" json:"effect"`
+	Career      string       `json:"career,omitempty"`
+	SemesterMin *int         `json:"semester_min,omitempty"`
+	SemesterMax *int         `json:"semester_max,omitempty"`
+	Role        string       `gorm:"type:varchar(20)" json:"role,omitempty"`
+	Description string       `json:"description,omitempty"`
+}
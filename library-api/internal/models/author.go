@@ -0,0 +1,33 @@
+package models
+
+import "gorm.io/gorm"
+
+type AuthorRole string
+
+const (
+	AuthorRoleAuthor     AuthorRole = "AUTHOR"
+	AuthorRoleEditor     AuthorRole = "EDITOR"
+	AuthorRoleTranslator AuthorRole = "TRANSLATOR"
+)
+
+type Author struct {
+	gorm.Model
+	Name     string          `gorm:"not null;index" json:"name"`
+	Variants []AuthorVariant `json:"variants,omitempty"`
+}
+
+type AuthorVariant struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	AuthorID uint   `gorm:"not null;index" json:"author_id"`
+	Name     string `gorm:"not null" json:"name"`
+	NameKey  string `gorm:"not null;uniqueIndex" json:"-"`
+}
+
+type BookAuthor struct {
+	BookID   uint       `gorm:"primaryKey" json:"book_id"`
+	AuthorID uint       `gorm:"primaryKey;index" json:"author_id"`
+	Role     AuthorRole `gorm:"primaryKey;type:varchar(20)" json:"role"`
+	Position int        `gorm:"not null;default:0" json:"position"`
+	Author   Author     `gorm:"foreignKey:AuthorID" json:"author"`
+	Book     Book       `gorm:"foreignKey:BookID" json:"-"`
+}
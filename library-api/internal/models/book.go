@@ -4,13 +4,25 @@ import "gorm.io/gorm"
 
 type Book struct {
 	gorm.Model
-	Title          string   `gorm:"not null;index" json:"title"`
-	Author         string   `gorm:"not null" json:"author"`
-	Description    string   `gorm:"type:text" json:"description"`
-	CoverURL       string   `json:"cover_url"`
-	S3Key          string   `gorm:"not null" json:"-"`
-	IsDownloadable bool     `gorm:"default:false" json:"is_downloadable"`
-	CategoryID     uint     `json:"category_id"`
-	Category       Category `gorm:"foreignKey:CategoryID" json:"category"`
-	Reviews        []Review `json:"reviews,omitempty"`
+	Title          string       `gorm:"not null;index" json:"title"`
+	Author         string       `gorm:"not null" json:"author"`
+	Description    string       `gorm:"type:text" json:"description"`
+	CoverURL       string       `json:"cover_url"`
+	ISBN           string       `gorm:"size:13;uniqueIndex:idx_books_isbn_edition,priority:1,where:isbn <> '' AND deleted_at IS NULL" json:"isbn,omitempty"`
+	Publisher      string       `gorm:"index" json:"publisher,omitempty"`
+	Year           int          `gorm:"index" json:"year,omitempty"`
+	Language       string       `gorm:"size:10;index" json:"language,omitempty"`
+	Pages          int          `json:"pages,omitempty"`
+	Edition        string       `gorm:"size:60;uniqueIndex:idx_books_isbn_edition,priority:2,where:isbn <> '' AND deleted_at IS NULL" json:"edition,omitempty"`
+	S3Key          string       `gorm:"not null" json:"-"`
+	IsDownloadable bool         `gorm:"default:false" json:"is_downloadable"`
+	Rating         float64      `gorm:"type:numeric(3,2);not null;default:0;index" json:"rating"`
+	RatingCount    int          `gorm:"not null;default:0" json:"rating_count"`
+	CategoryID     uint         `json:"category_id"`
+	Category       Category     `gorm:"foreignKey:CategoryID" json:"category"`
+	Authors        []BookAuthor `json:"authors,omitempty"`
+	Tags           []Tag        `gorm:"many2many:book_tags" json:"tags,omitempty"`
+	Assets         []BookAsset  `json:"assets,omitempty"`
+	Reviews        []Review     `json:"reviews,omitempty"`
+	IsFavorite     *bool        `gorm:"-" json:"is_favorite,omitempty"`
 }
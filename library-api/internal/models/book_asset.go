@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+type BookAsset struct {
+	gorm.Model
+	BookID      uint   `gorm:"not null;index" json:"book_id"`
+	Format      string `gorm:"type:varchar(10);not null" json:"format"`
+	Edition     string `json:"edition,omitempty"`
+	Language    string `gorm:"size:10" json:"language,omitempty"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Checksum    string `gorm:"size:64" json:"checksum"`
+	ContentType string `json:"content_type"`
+	StorageKey  string `gorm:"not null" json:"-"`
+	IsPrimary   bool   `gorm:"default:false" json:"is_primary"`
+}
@@ -1,10 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Category struct {
 	gorm.Model
-	Name  string `gorm:"uniqueIndex;not null" json:"name"`
-	Slug  string `gorm:"uniqueIndex;not null" json:"slug"`
-	Books []Book `json:"-"`
+	Name     string     `gorm:"uniqueIndex;not null" json:"name"`
+	Slug     string     `gorm:"uniqueIndex;not null" json:"slug"`
+	ParentID *uint      `gorm:"index" json:"parent_id"`
+	Position int        `gorm:"not null;default:0" json:"position"`
+	Parent   *Category  `gorm:"foreignKey:ParentID" json:"-"`
+	Children []Category `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+	Books    []Book     `json:"-"`
+}
+
+type CategorySlugRedirect struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Slug       string    `gorm:"uniqueIndex;not null" json:"slug"`
+	CategoryID uint      `gorm:"not null;index" json:"category_id"`
+	Category   Category  `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
 }
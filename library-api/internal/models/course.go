@@ -0,0 +1,33 @@
+package models
+
+import "gorm.io/gorm"
+
+type ReserveKind string
+
+const (
+	ReserveRequired    ReserveKind = "REQUIRED"
+	ReserveRecommended ReserveKind = "RECOMMENDED"
+)
+
+type Course struct {
+	gorm.Model
+	PeriodID uint            `gorm:"not null;index;uniqueIndex:idx_course_period_code" json:"period_id"`
+	Code     string          `gorm:"not null;size:30;uniqueIndex:idx_course_period_code" json:"code"`
+	Name     string          `gorm:"not null" json:"name"`
+	Career   string          `gorm:"index" json:"career"`
+	Semester string          `gorm:"index" json:"semester"`
+	Period   AcademicPeriod  `gorm:"foreignKey:PeriodID" json:"-"`
+	Teachers []User          `gorm:"many2many:course_teachers" json:"teachers,omitempty"`
+	Reserves []CourseReserve `json:"reserves,omitempty"`
+}
+
+type CourseReserve struct {
+	gorm.Model
+	CourseID uint        `gorm:"not null;uniqueIndex:idx_course_book" json:"course_id"`
+	BookID   uint        `gorm:"not null;index;uniqueIndex:idx_course_book" json:"book_id"`
+	Kind     ReserveKind `gorm:"type:varchar(20);default:'REQUIRED'" json:"kind"`
+	Position int         `gorm:"not null;default:0" json:"position"`
+	Notes    string      `gorm:"type:text" json:"notes,omitempty"`
+	Course   Course      `gorm:"foreignKey:CourseID" json:"-"`
+	Book     Book        `gorm:"foreignKey:BookID" json:"book"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Enrollment struct {
 	gorm.Model
@@ -16,3 +20,18 @@ type Enrollment struct {
 	Period      AcademicPeriod `gorm:"foreignKey:PeriodID" json:"-"`
 	Reviews     []Review       `json:"-"`
 }
+
+type PendingEnrollment struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	PeriodID  uint           `gorm:"not null;uniqueIndex:idx_pending_period_dni" json:"period_id"`
+	DNI       string         `gorm:"size:20;not null;index;uniqueIndex:idx_pending_period_dni" json:"dni"`
+	FullName  string         `gorm:"not null" json:"full_name"`
+	Email     string         `gorm:"size:255" json:"email,omitempty"`
+	Career    string         `json:"career"`
+	Semester  string         `json:"semester"`
+	ClaimedAt *time.Time     `json:"claimed_at,omitempty"`
+	UserID    *uint          `json:"user_id,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Period    AcademicPeriod `gorm:"foreignKey:PeriodID" json:"-"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type ThrottleScope string
+
+const (
+	ThrottleScopeDNI ThrottleScope = "DNI"
+	ThrottleScopeIP  ThrottleScope = "IP"
+)
+
+type AuthAuditEvent string
+
+const (
+	AuthEventLockout AuthAuditEvent = "LOCKOUT"
+	AuthEventUnlock  AuthAuditEvent = "UNLOCK"
+)
+
+type LoginThrottle struct {
+	Scope         ThrottleScope `gorm:"type:varchar(10);primaryKey" json:"scope"`
+	Subject       string        `gorm:"size:64;primaryKey" json:"subject"`
+	Failures      int           `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time     `gorm:"not null" json:"last_failure_at"`
+	BlockedUntil  time.Time     `gorm:"not null;index" json:"blocked_until"`
+	Locked        bool          `gorm:"not null;default:false" json:"locked"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+type AuthAuditLog struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	Event     AuthAuditEvent `gorm:"type:varchar(20);not null;index" json:"event"`
+	Scope     ThrottleScope  `gorm:"type:varchar(10);not null" json:"scope"`
+	Subject   string         `gorm:"size:64;not null;index" json:"subject"`
+	IP        string         `gorm:"size:64" json:"ip,omitempty"`
+	Failures  int            `json:"failures"`
+	Until     *time.Time     `json:"until,omitempty"`
+	ActorID   *uint          `json:"actor_id,omitempty"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+}
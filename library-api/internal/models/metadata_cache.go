@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MetadataCache struct {
+	gorm.Model
+	ISBN      string    `gorm:"uniqueIndex;size:13;not null" json:"isbn"`
+	Provider  string    `gorm:"size:40" json:"provider"`
+	Found     bool      `gorm:"default:false" json:"found"`
+	Payload   string    `gorm:"type:text" json:"-"`
+	FetchedAt time.Time `gorm:"not null" json:"fetched_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type OIDCLoginState struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	StateHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Verifier  string    `gorm:"size:128;not null" json:"-"`
+	Nonce     string    `gorm:"size:64;not null" json:"-"`
+	Redirect  string    `gorm:"size:512" json:"redirect"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
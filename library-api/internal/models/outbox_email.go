@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "PENDING"
+	OutboxSending OutboxStatus = "SENDING"
+	OutboxSent    OutboxStatus = "SENT"
+	OutboxFailed  OutboxStatus = "FAILED"
+)
+
+type OutboxEmail struct {
+	gorm.Model
+	Recipient     string       `gorm:"not null" json:"recipient"`
+	Template      string       `gorm:"not null;size:60" json:"template"`
+	Locale        string       `gorm:"not null;size:5" json:"locale"`
+	Subject       string       `gorm:"not null" json:"subject"`
+	TextBody      string       `gorm:"type:text;not null" json:"-"`
+	HTMLBody      string       `gorm:"type:text" json:"-"`
+	Status        OutboxStatus `gorm:"type:varchar(20);default:'PENDING';index:idx_outbox_dispatch" json:"status"`
+	Attempts      int          `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time    `gorm:"index:idx_outbox_dispatch" json:"next_attempt_at"`
+	LastError     string       `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time   `json:"sent_at,omitempty"`
+}
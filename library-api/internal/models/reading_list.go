@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type ListVisibility string
+
+const (
+	ListPrivate ListVisibility = "PRIVATE"
+	ListShared  ListVisibility = "SHARED"
+)
+
+type ReadingList struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	UserID      uint              `gorm:"not null;index;uniqueIndex:idx_reading_lists_favorites,where:is_favorites" json:"user_id"`
+	Name        string            `gorm:"not null" json:"name"`
+	IsFavorites bool              `gorm:"not null;default:false" json:"is_favorites"`
+	Visibility  ListVisibility    `gorm:"type:varchar(10);not null;default:'PRIVATE'" json:"visibility"`
+	ShareToken  *string           `gorm:"size:64;uniqueIndex" json:"share_token,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	User        User              `gorm:"foreignKey:UserID" json:"-"`
+	Items       []ReadingListItem `gorm:"foreignKey:ListID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+}
+
+type ReadingListItem struct {
+	ListID    uint      `gorm:"primaryKey" json:"list_id"`
+	BookID    uint      `gorm:"primaryKey;index" json:"book_id"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	Book      Book      `gorm:"foreignKey:BookID" json:"book"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type RegistrationInvite struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	CodeHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Email       string     `gorm:"size:255" json:"email,omitempty"`
+	MaxUses     int        `gorm:"not null;default:1" json:"max_uses"`
+	Uses        int        `gorm:"not null;default:0" json:"uses"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedByID uint       `gorm:"not null" json:"created_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type PendingRegistration struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	DNI          string    `gorm:"size:20;not null;uniqueIndex" json:"dni"`
+	FullName     string    `gorm:"not null" json:"full_name"`
+	Email        string    `gorm:"size:255;not null" json:"email"`
+	Locale       string    `gorm:"size:5" json:"locale"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+	InviteID     *uint     `json:"invite_id,omitempty"`
+	CodeHash     string    `gorm:"size:64;not null" json:"-"`
+	Attempts     int       `gorm:"not null;default:0" json:"attempts"`
+	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
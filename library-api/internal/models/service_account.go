@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type ServiceAccount struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Description string    `gorm:"size:500" json:"description,omitempty"`
+	Role        Role      `gorm:"type:varchar(20);not null;default:'STUDENT'" json:"role"`
+	IsActive    bool      `gorm:"not null;default:true" json:"is_active"`
+	CreatedByID uint      `gorm:"not null" json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Keys        []APIKey  `gorm:"foreignKey:ServiceAccountID" json:"keys,omitempty"`
+}
+
+type APIKey struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	ServiceAccountID uint           `gorm:"not null;index" json:"service_account_id"`
+	Name             string         `gorm:"size:100" json:"name,omitempty"`
+	Prefix           string         `gorm:"size:16;not null;uniqueIndex" json:"prefix"`
+	KeyHash          string         `gorm:"size:64;not null" json:"-"`
+	Scopes           []string       `gorm:"serializer:json;type:text;not null" json:"scopes"`
+	ExpiresAt        *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time     `json:"last_used_at,omitempty"`
+	LastUsedIP       string         `gorm:"size:64" json:"last_used_ip,omitempty"`
+	RevokedAt        *time.Time     `json:"revoked_at,omitempty"`
+	RotatedFromID    *uint          `json:"rotated_from_id,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	ServiceAccount   ServiceAccount `gorm:"foreignKey:ServiceAccountID" json:"-"`
+}
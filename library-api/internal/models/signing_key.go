@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type SigningKeyStatus string
+
+const (
+	SigningKeyPending  SigningKeyStatus = "PENDING"
+	SigningKeyActive   SigningKeyStatus = "ACTIVE"
+	SigningKeyRetiring SigningKeyStatus = "RETIRING"
+	SigningKeyExpired  SigningKeyStatus = "EXPIRED"
+	SigningKeyRevoked  SigningKeyStatus = "REVOKED"
+)
+
+type SigningKey struct {
+	ID         string           `gorm:"primaryKey;size:32" json:"kid"`
+	Algorithm  string           `gorm:"size:16;not null" json:"alg"`
+	PrivateKey string           `gorm:"type:text;not null" json:"-"`
+	ActiveFrom time.Time        `gorm:"not null;index" json:"active_from"`
+	ExpiresAt  *time.Time       `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time       `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Status     SigningKeyStatus `gorm:"-" json:"status"`
+}
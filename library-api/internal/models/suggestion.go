@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SuggestionStatus string
+
+const (
+	SuggestionReceived  SuggestionStatus = "RECEIVED"
+	SuggestionApproved  SuggestionStatus = "APPROVED"
+	SuggestionOrdered   SuggestionStatus = "ORDERED"
+	SuggestionRejected  SuggestionStatus = "REJECTED"
+	SuggestionAvailable SuggestionStatus = "AVAILABLE"
+)
+
+type Suggestion struct {
+	gorm.Model
+	UserID        uint             `gorm:"not null;index" json:"user_id"`
+	EnrollmentID  uint             `gorm:"not null;index" json:"enrollment_id"`
+	Title         string           `gorm:"not null" json:"title"`
+	TitleKey      string           `gorm:"not null;index" json:"-"`
+	Author        string           `json:"author,omitempty"`
+	ISBN          string           `gorm:"size:13;index" json:"isbn,omitempty"`
+	Justification string           `gorm:"type:text;not null" json:"justification"`
+	Status        SuggestionStatus `gorm:"type:varchar(20);not null;default:'RECEIVED';index" json:"status"`
+	StatusNote    string           `gorm:"type:text" json:"status_note,omitempty"`
+	VoteCount     int              `gorm:"not null;default:0" json:"vote_count"`
+	BookID        *uint            `gorm:"index" json:"book_id,omitempty"`
+	MergedIntoID  *uint            `gorm:"index" json:"merged_into_id,omitempty"`
+	HasVoted      bool             `gorm:"-" json:"has_voted"`
+	User          User             `gorm:"foreignKey:UserID" json:"-"`
+	Enrollment    Enrollment       `gorm:"foreignKey:EnrollmentID" json:"-"`
+	Book          *Book            `gorm:"foreignKey:BookID" json:"book,omitempty"`
+}
+
+type SuggestionVote struct {
+	SuggestionID uint      `gorm:"primaryKey" json:"suggestion_id"`
+	UserID       uint      `gorm:"primaryKey;index" json:"user_id"`
+	EnrollmentID uint      `gorm:"not null" json:"enrollment_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -1,21 +1,41 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Role string
 
 const (
 	RoleAdmin   Role = "ADMIN"
 	RoleStudent Role = "STUDENT"
+	RoleTeacher Role = "TEACHER"
+)
+
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	AuthSourceOIDC  = "oidc"
 )
 
 type User struct {
 	gorm.Model
-	DNI          string       `gorm:"uniqueIndex;not null;size:20" json:"dni"`
-	FullName     string       `gorm:"not null" json:"full_name"`
-	PasswordHash string       `gorm:"not null" json:"-"`
-	Role         Role         `gorm:"type:varchar(20);default:'STUDENT'" json:"role"`
-	IsActive     bool         `gorm:"default:true" json:"is_active"`
-	Enrollments  []Enrollment `json:"-"`
-	Reviews      []Review     `json:"-"`
+	DNI               string       `gorm:"uniqueIndex;not null;size:20" json:"dni"`
+	FullName          string       `gorm:"not null" json:"full_name"`
+	Email             string       `gorm:"size:255" json:"email,omitempty"`
+	Locale            string       `gorm:"size:5;default:'es'" json:"locale"`
+	PasswordHash      string       `gorm:"not null" json:"-"`
+	Role              Role         `gorm:"type:varchar(20);default:'STUDENT'" json:"role"`
+	IsActive          bool         `gorm:"default:true" json:"is_active"`
+	SessionVersion    uint         `gorm:"not null;default:0" json:"-"`
+	PasswordChangedAt *time.Time   `json:"-"`
+	TOTPSecret        string       `gorm:"size:128" json:"-"`
+	TOTPLastStep      int64        `gorm:"not null;default:0" json:"-"`
+	TwoFactorEnabled  bool         `gorm:"not null;default:false" json:"two_factor_enabled"`
+	OIDCSubject       *string      `gorm:"column:oidc_subject;size:255;uniqueIndex" json:"-"`
+	AuthSource        string       `gorm:"size:20;not null;default:'local'" json:"auth_source"`
+	Enrollments       []Enrollment `json:"-"`
+	Reviews           []Review     `json:"-"`
 }
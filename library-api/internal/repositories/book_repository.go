@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"strings"
+
 	"gorm.io/gorm"
 
 	"github.com/jos3lo89/library-api/internal/models"
@@ -20,32 +22,299 @@ func (r *BookRepository) Create(book *models.Book) error {
 
 func (r *BookRepository) FindByID(id uint) (*models.Book, error) {
 	var book models.Book
-	if err := r.db.Preload("Category").First(&book, id).Error; err != nil {
+	if err := r.db.Preload("Category").Preload("Assets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("is_primary DESC, created_at ASC")
+	}).Preload("Authors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Preload("Authors.Author").Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name ASC")
+	}).First(&book, id).Error; err != nil {
 		return nil, err
 	}
 	return &book, nil
 }
 
-func (r *BookRepository) List(query string, categoryID *uint, offset int, limit int) ([]models.Book, int64, error) {
-	var books []models.Book
-	var total int64
+type BookFilter struct {
+	Query        string
+	CategoryID   *uint
+	CategoryIDs  []uint
+	AuthorID     *uint
+	ISBN         string
+	Publisher    string
+	Languages    []string
+	Edition      string
+	YearFrom     *int
+	YearTo       *int
+	Tags         []string
+	MatchAllTags bool
+	Downloadable *bool
+	Sort         string
+	Order        string
+	Offset       int
+	Limit        int
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+type BookFacets struct {
+	Tags         []FacetCount `json:"tags"`
+	Categories   []FacetCount `json:"categories"`
+	Languages    []FacetCount `json:"languages"`
+	Years        []FacetCount `json:"years"`
+	Downloadable []FacetCount `json:"downloadable"`
+}
+
+const (
+	facetTags         = "tags"
+	facetCategories   = "categories"
+	facetLanguages    = "languages"
+	facetYears        = "years"
+	facetDownloadable = "downloadable"
+	facetTagLimit     = 30
+)
+
+const CategorySubtreeCondition = `books.category_id IN (
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE id IN ?
+		UNION ALL
+		SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id WHERE c.deleted_at IS NULL
+	)
+	SELECT id FROM subtree)`
+
+var bookSortColumns = map[string]string{
+	"created_at": "books.created_at",
+	"title":      "books.title",
+	"author":     "books.author",
+	"year":       "books.year",
+	"publisher":  "books.publisher",
+	"pages":      "books.pages",
+	"rating":     "books.rating",
+}
+
+var BookCursorColumns = map[string]string{
+	"created_at": "books.created_at",
+	"title":      "books.title",
+	"author":     "books.author",
+	"rating":     "books.rating",
+}
+
+type BookCursor struct {
+	Value  any
+	ID     uint
+	Before bool
+}
+
+type BookPage struct {
+	Items   []models.Book
+	Total   *int64
+	HasNext bool
+	HasPrev bool
+}
 
-	q := r.db.Model(&models.Book{}).Preload("Category")
-	if query != "" {
-		like := "%" + query + "%"
-		q = q.Where("title ILIKE ? OR author ILIKE ?", like, like)
+func (r *BookRepository) Update(book *models.Book) error {
+	return r.db.Omit("Category", "Assets", "Authors", "Tags", "Reviews").Save(book).Error
+}
+
+func (r *BookRepository) ExistsISBN(isbn string, edition string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Book{}).
+		Where("isbn = ? AND edition = ? AND id <> ?", isbn, edition, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (f BookFilter) categoryIDs() []uint {
+	ids := append([]uint{}, f.CategoryIDs...)
+	if f.CategoryID != nil {
+		ids = append(ids, *f.CategoryID)
+	}
+	return ids
+}
+
+func applyBookFilter(q *gorm.DB, filter BookFilter, skip string) *gorm.DB {
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		q = q.Where("books.title ILIKE ? OR books.author ILIKE ? OR books.isbn = ?", like, like, filter.Query)
+	}
+	if ids := filter.categoryIDs(); len(ids) > 0 && skip != facetCategories {
+		q = q.Where(CategorySubtreeCondition, ids)
+	}
+	if filter.AuthorID != nil {
+		q = q.Where("books.id IN (SELECT book_id FROM book_authors WHERE author_id = ?)", *filter.AuthorID)
+	}
+	if filter.ISBN != "" {
+		q = q.Where("books.isbn = ?", filter.ISBN)
 	}
-	if categoryID != nil {
-		q = q.Where("category_id = ?", *categoryID)
+	if filter.Publisher != "" {
+		q = q.Where("books.publisher ILIKE ?", "%"+filter.Publisher+"%")
 	}
+	if len(filter.Languages) > 0 && skip != facetLanguages {
+		languages := make([]string, 0, len(filter.Languages))
+		for _, language := range filter.Languages {
+			languages = append(languages, strings.ToLower(language))
+		}
+		q = q.Where("LOWER(books.language) IN ?", languages)
+	}
+	if filter.Edition != "" {
+		q = q.Where("books.edition ILIKE ?", filter.Edition)
+	}
+	if skip != facetYears {
+		if filter.YearFrom != nil {
+			q = q.Where("books.year >= ?", *filter.YearFrom)
+		}
+		if filter.YearTo != nil {
+			q = q.Where("books.year <= ?", *filter.YearTo)
+		}
+	}
+	if len(filter.Tags) > 0 && skip != facetTags {
+		if filter.MatchAllTags {
+			q = q.Where(`books.id IN (
+				SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+				WHERE t.slug IN ? GROUP BY bt.book_id HAVING COUNT(DISTINCT t.id) = ?)`, filter.Tags, len(filter.Tags))
+		} else {
+			q = q.Where("books.id IN (SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id WHERE t.slug IN ?)", filter.Tags)
+		}
+	}
+	if filter.Downloadable != nil && skip != facetDownloadable {
+		q = q.Where("books.is_downloadable = ?", *filter.Downloadable)
+	}
+	return q
+}
+
+func (r *BookRepository) List(filter BookFilter) ([]models.Book, int64, error) {
+	var books []models.Book
+	var total int64
+
+	q := applyBookFilter(r.db.Model(&models.Book{}).Preload("Category").Preload("Tags"), filter, "")
 
 	if err := q.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	if err := q.Order("created_at DESC").Offset(offset).Limit(limit).Find(&books).Error; err != nil {
+	column, ok := bookSortColumns[filter.Sort]
+	if !ok {
+		column = "books.created_at"
+	}
+	direction := "DESC"
+	if strings.EqualFold(filter.Order, "asc") {
+		direction = "ASC"
+	}
+
+	if err := q.Order(column + " " + direction).Order("books.id " + direction).Offset(filter.Offset).Limit(filter.Limit).Find(&books).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return books, total, nil
 }
+
+func (r *BookRepository) ListKeyset(filter BookFilter, cursor *BookCursor, withTotal bool) (*BookPage, error) {
+	page := &BookPage{}
+	if withTotal {
+		var total int64
+		if err := applyBookFilter(r.db.Model(&models.Book{}), filter, "").Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	column, ok := BookCursorColumns[filter.Sort]
+	if !ok {
+		column = "books.created_at"
+	}
+	descending := !strings.EqualFold(filter.Order, "asc")
+	backward := cursor != nil && cursor.Before
+	if backward {
+		descending = !descending
+	}
+	direction, operator := "ASC", ">"
+	if descending {
+		direction, operator = "DESC", "<"
+	}
+
+	q := applyBookFilter(r.db.Model(&models.Book{}).Preload("Category").Preload("Tags"), filter, "")
+	if cursor != nil {
+		q = q.Where("("+column+", books.id) "+operator+" (?, ?)", cursor.Value, cursor.ID)
+	}
+	if err := q.Order(column + " " + direction).Order("books.id " + direction).Limit(filter.Limit + 1).Find(&page.Items).Error; err != nil {
+		return nil, err
+	}
+
+	more := len(page.Items) > filter.Limit
+	if more {
+		page.Items = page.Items[:filter.Limit]
+	}
+	if backward {
+		for i, j := 0, len(page.Items)-1; i < j; i, j = i+1, j-1 {
+			page.Items[i], page.Items[j] = page.Items[j], page.Items[i]
+		}
+		page.HasPrev, page.HasNext = more, true
+	} else {
+		page.HasPrev, page.HasNext = cursor != nil, more
+	}
+	return page, nil
+}
+
+func (r *BookRepository) Facets(filter BookFilter) (*BookFacets, error) {
+	facets := &BookFacets{
+		Tags:         []FacetCount{},
+		Categories:   []FacetCount{},
+		Languages:    []FacetCount{},
+		Years:        []FacetCount{},
+		Downloadable: []FacetCount{},
+	}
+	base := func(skip string) *gorm.DB {
+		return applyBookFilter(r.db.Model(&models.Book{}), filter, skip)
+	}
+
+	if err := base(facetTags).
+		Select("t.slug AS value, t.name AS label, COUNT(DISTINCT books.id) AS count").
+		Joins("JOIN book_tags bt ON bt.book_id = books.id").
+		Joins("JOIN tags t ON t.id = bt.tag_id").
+		Group("t.slug, t.name").
+		Order("count DESC, t.name ASC").
+		Limit(facetTagLimit).
+		Scan(&facets.Tags).Error; err != nil {
+		return nil, err
+	}
+
+	if err := base(facetCategories).
+		Select("CAST(c.id AS TEXT) AS value, c.name AS label, COUNT(books.id) AS count").
+		Joins("JOIN categories c ON c.id = books.category_id").
+		Group("c.id, c.name").
+		Order("count DESC, c.name ASC").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+
+	if err := base(facetLanguages).
+		Select("LOWER(books.language) AS value, LOWER(books.language) AS label, COUNT(books.id) AS count").
+		Where("books.language <> ''").
+		Group("LOWER(books.language)").
+		Order("count DESC").
+		Scan(&facets.Languages).Error; err != nil {
+		return nil, err
+	}
+
+	if err := base(facetYears).
+		Select("CAST(books.year AS TEXT) AS value, CAST(books.year AS TEXT) AS label, COUNT(books.id) AS count").
+		Where("books.year > 0").
+		Group("books.year").
+		Order("books.year DESC").
+		Scan(&facets.Years).Error; err != nil {
+		return nil, err
+	}
+
+	if err := base(facetDownloadable).
+		Select("CASE WHEN books.is_downloadable THEN 'true' ELSE 'false' END AS value, CASE WHEN books.is_downloadable THEN 'true' ELSE 'false' END AS label, COUNT(books.id) AS count").
+		Group("books.is_downloadable").
+		Order("value DESC").
+		Scan(&facets.Downloadable).Error; err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
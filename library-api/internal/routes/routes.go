@@ -6,6 +6,7 @@ import (
 	"github.com/jos3lo89/library-api/internal/handlers"
 	"github.com/jos3lo89/library-api/internal/middleware"
 	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
 )
 
 type Dependencies struct {
@@ -15,39 +16,178 @@ type Dependencies struct {
 	Categories  *handlers.CategoryHandler
 	Enrollments *handlers.EnrollmentHandler
 	Periods     *handlers.PeriodHandler
-	JWTSecret   string
+	Mail        *handlers.MailHandler
+	Courses     *handlers.CourseHandler
+	Policies    *handlers.PolicyHandler
+	OPDS        *handlers.OPDSHandler
+	Catalog     *handlers.CatalogHandler
+	Metadata    *handlers.MetadataHandler
+	Authors     *handlers.AuthorHandler
+	Tags        *handlers.TagHandler
+	Lists       *handlers.ReadingListHandler
+	Suggestions *handlers.SuggestionHandler
+	Services    *handlers.ServiceAccountHandler
+	LoginGuard  *handlers.LoginGuardHandler
+	Keys        *handlers.SigningKeyHandler
+	Invites     *handlers.RegistrationHandler
+	Tokens      *utils.TokenSettings
+	CSRFSecret  string
+	Origins     []string
+	Sessions    middleware.SessionChecker
+	APIKeys     middleware.APIKeyChecker
+	Credentials middleware.CredentialChecker
 }
 
 func RegisterRoutes(app *fiber.App, deps *Dependencies) {
-	api := app.Group("/api")
+	app.Get("/.well-known/jwks.json", deps.Keys.JWKS)
+
+	api := app.Group("/api", middleware.OriginCheck(deps.Origins))
+	authRequired := middleware.AuthRequired(deps.Tokens, deps.CSRFSecret, deps.Sessions, deps.APIKeys)
+	optionalAuth := middleware.OptionalAuth(deps.Tokens, deps.CSRFSecret, deps.Sessions)
 
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
 	auth := api.Group("/auth")
+	auth.Get("/register", deps.Auth.RegistrationMode)
 	auth.Post("/register", deps.Auth.Register)
+	auth.Post("/register/verify", deps.Auth.VerifyRegistration)
 	auth.Post("/login", deps.Auth.Login)
-	auth.Get("/me", middleware.AuthRequired(deps.JWTSecret), deps.Auth.Me)
-	auth.Post("/logout", middleware.AuthRequired(deps.JWTSecret), deps.Auth.Logout)
+	auth.Get("/me", authRequired, deps.Auth.Me)
+	auth.Get("/csrf", authRequired, deps.Auth.CSRFToken)
+	auth.Post("/logout", authRequired, deps.Auth.Logout)
+	auth.Post("/password/forgot", deps.Auth.ForgotPassword)
+	auth.Post("/password/reset", deps.Auth.ResetPassword)
+	auth.Post("/password/change", authRequired, deps.Auth.ChangePassword)
+	auth.Get("/oidc/login", deps.Auth.OIDCLogin)
+	auth.Get("/oidc/callback", deps.Auth.OIDCCallback)
+	auth.Post("/2fa/verify", deps.Auth.VerifyTwoFactor)
+	auth.Get("/2fa", authRequired, deps.Auth.TwoFactorStatus)
+	auth.Post("/2fa/setup", optionalAuth, deps.Auth.SetupTwoFactor)
+	auth.Post("/2fa/enable", optionalAuth, deps.Auth.EnableTwoFactor)
+	auth.Post("/2fa/disable", authRequired, deps.Auth.DisableTwoFactor)
+	auth.Post("/2fa/recovery-codes", authRequired, deps.Auth.RegenerateRecoveryCodes)
 
-	admin := api.Group("/admin", middleware.AuthRequired(deps.JWTSecret), middleware.RequireRole(string(models.RoleAdmin)))
+	admin := api.Group("/admin", authRequired, middleware.RequireRole(string(models.RoleAdmin)))
 
 	admin.Post("/users", deps.Users.Create)
+	admin.Delete("/users/:id/2fa", deps.Auth.ResetTwoFactor)
+	admin.Put("/users/:id/oidc", deps.Auth.LinkOIDC)
+	admin.Delete("/users/:id/oidc", deps.Auth.UnlinkOIDC)
+	admin.Get("/login-locks", deps.LoginGuard.ListLocks)
+	admin.Delete("/login-locks/:scope/:subject", deps.LoginGuard.Unlock)
+	admin.Get("/auth-audit", deps.LoginGuard.ListAudit)
+	admin.Get("/signing-keys", deps.Keys.List)
+	admin.Post("/signing-keys/rotate", deps.Keys.Rotate)
+	admin.Delete("/signing-keys/:kid", deps.Keys.Revoke)
+	admin.Get("/service-accounts", deps.Services.List)
+	admin.Post("/service-accounts", deps.Services.Create)
+	admin.Get("/service-accounts/:id", deps.Services.GetByID)
+	admin.Delete("/service-accounts/:id", deps.Services.Deactivate)
+	admin.Post("/service-accounts/:id/keys", deps.Services.CreateKey)
+	admin.Post("/service-accounts/:id/keys/:keyId/rotate", deps.Services.RotateKey)
+	admin.Delete("/service-accounts/:id/keys/:keyId", deps.Services.RevokeKey)
 	admin.Post("/categories", deps.Categories.Create)
+	admin.Patch("/categories/:id", deps.Categories.Update)
+	admin.Delete("/categories/:id", deps.Categories.Delete)
+	admin.Patch("/categories/:id/move", deps.Categories.Move)
+	admin.Put("/categories/order", deps.Categories.Reorder)
 	admin.Post("/books", deps.Books.Create)
+	admin.Patch("/books/:id", deps.Books.Update)
+	admin.Put("/books/:id/authors", deps.Authors.SetBookAuthors)
+	admin.Put("/books/:id/tags", deps.Tags.SetBookTags)
+	admin.Delete("/tags/:id", deps.Tags.Delete)
+	admin.Patch("/suggestions/:id/status", deps.Suggestions.SetStatus)
+	admin.Post("/suggestions/:id/merge", deps.Suggestions.Merge)
+	admin.Post("/authors", deps.Authors.Create)
+	admin.Patch("/authors/:id", deps.Authors.Rename)
+	admin.Post("/authors/:id/variants", deps.Authors.AddVariant)
+	admin.Post("/authors/:id/merge", deps.Authors.Merge)
+	admin.Get("/metadata/isbn/:isbn", deps.Metadata.LookupISBN)
+	admin.Post("/books/:id/assets", deps.Books.UploadAsset)
+	admin.Patch("/books/:id/assets/:assetId/primary", deps.Books.SetPrimaryAsset)
+	admin.Delete("/books/:id/assets/:assetId", deps.Books.DeleteAsset)
+	admin.Post("/catalog/import", deps.Catalog.Import)
+	admin.Get("/catalog/export", deps.Catalog.Export)
 	admin.Post("/enrollments", deps.Enrollments.Create)
 	admin.Get("/enrollments", deps.Enrollments.List)
+	admin.Post("/enrollments/import", deps.Enrollments.Import)
+	admin.Get("/enrollments/pending", deps.Enrollments.ListPending)
+	admin.Get("/registration-invites", deps.Invites.ListInvites)
+	admin.Post("/registration-invites", deps.Invites.CreateInvite)
+	admin.Delete("/registration-invites/:id", deps.Invites.RevokeInvite)
 	admin.Post("/periods", deps.Periods.Create)
 	admin.Patch("/periods/:id/current", deps.Periods.SetCurrent)
+	admin.Post("/courses", deps.Courses.Create)
+	admin.Get("/courses", deps.Courses.List)
+	admin.Put("/courses/:id/teachers", deps.Courses.SetTeachers)
+	admin.Post("/policies", deps.Policies.Create)
+	admin.Get("/policies", deps.Policies.List)
+	admin.Delete("/policies/:id", deps.Policies.Delete)
+	admin.Post("/policies/simulate", deps.Policies.Simulate)
+	admin.Patch("/reviews/:id/hidden", deps.Books.SetReviewHidden)
+	admin.Get("/mail/outbox", deps.Mail.ListOutbox)
+	admin.Post("/mail/outbox/:id/retry", deps.Mail.Retry)
 
 	api.Get("/categories", deps.Categories.List)
-	api.Get("/books", deps.Books.List)
-	api.Get("/books/:id", deps.Books.GetByID)
+	api.Get("/categories/tree", deps.Categories.Tree)
+	api.Get("/categories/slug/:slug", deps.Categories.GetBySlug)
+	api.Get("/categories/:id/breadcrumb", deps.Categories.Breadcrumb)
+	api.Get("/authors", deps.Authors.List)
+	api.Get("/authors/:id", deps.Authors.GetByID)
+	api.Get("/tags", deps.Tags.List)
+	api.Get("/books", optionalAuth, deps.Books.List)
+	api.Get("/books/:id", optionalAuth, deps.Books.GetByID)
+	api.Get("/lists/shared/:token", deps.Lists.GetShared)
+	api.Get("/books/:id/assets", deps.Books.ListAssets)
 
 	api.Get("/periods", deps.Periods.List)
 
-	api.Get("/books/:id/reviews", middleware.AuthRequired(deps.JWTSecret), deps.Books.ListReviews)
-	api.Post("/books/:id/reviews", middleware.AuthRequired(deps.JWTSecret), deps.Books.CreateReview)
-	api.Get("/books/:id/read", middleware.AuthRequired(deps.JWTSecret), deps.Books.Read)
+	opds := api.Group("/opds")
+	opds.Get("/", deps.OPDS.Root)
+	opds.Get("/books", deps.OPDS.Books)
+	opds.Get("/categories/:id", deps.OPDS.Category)
+	opds.Get("/search", deps.OPDS.Search)
+	opds.Get("/opensearch.xml", deps.OPDS.OpenSearch)
+	opds.Get("/v2/catalog", deps.OPDS.RootV2)
+	opds.Get("/v2/books", deps.OPDS.BooksV2)
+	opds.Get("/v2/categories/:id", deps.OPDS.CategoryV2)
+	opds.Get("/v2/search", deps.OPDS.SearchV2)
+	opds.Get("/books/:id/assets/:assetId/acquire", middleware.BasicOrCookieAuth(deps.Tokens, deps.Sessions, "Biblioteca", deps.Credentials), deps.OPDS.Acquire)
+
+	teacher := api.Group("/teacher", authRequired, middleware.RequireAnyRole(string(models.RoleTeacher), string(models.RoleAdmin)))
+	teacher.Get("/courses", deps.Courses.ListTeaching)
+	teacher.Get("/courses/:id/reserves", deps.Courses.ListReserves)
+	teacher.Post("/courses/:id/reserves", deps.Courses.AddReserve)
+	teacher.Put("/courses/:id/reserves/order", deps.Courses.ReorderReserves)
+	teacher.Delete("/courses/:id/reserves/:bookId", deps.Courses.RemoveReserve)
+
+	api.Get("/me/courses", authRequired, deps.Courses.MyCourses)
+
+	me := api.Group("/me", authRequired)
+	me.Put("/favorites/:bookId", deps.Lists.AddFavorite)
+	me.Delete("/favorites/:bookId", deps.Lists.RemoveFavorite)
+	me.Get("/lists", deps.Lists.List)
+	me.Post("/lists", deps.Lists.Create)
+	me.Get("/lists/:id", deps.Lists.GetByID)
+	me.Patch("/lists/:id", deps.Lists.Update)
+	me.Delete("/lists/:id", deps.Lists.Delete)
+	me.Post("/lists/:id/books", deps.Lists.AddBook)
+	me.Delete("/lists/:id/books/:bookId", deps.Lists.RemoveBook)
+	me.Put("/lists/:id/order", deps.Lists.Reorder)
+
+	suggestions := api.Group("/suggestions", authRequired)
+	suggestions.Get("/", deps.Suggestions.List)
+	suggestions.Post("/", deps.Suggestions.Create)
+	suggestions.Get("/:id", deps.Suggestions.GetByID)
+	suggestions.Post("/:id/vote", deps.Suggestions.Vote)
+	suggestions.Delete("/:id/vote", deps.Suggestions.Unvote)
+
+	api.Get("/books/:id/reviews", authRequired, deps.Books.ListReviews)
+	api.Post("/books/:id/reviews", authRequired, deps.Books.CreateReview)
+	api.Patch("/books/:id/reviews/:reviewId", authRequired, deps.Books.UpdateReview)
+	api.Get("/books/:id/reviews/stream", authRequired, deps.Books.StreamReviews)
+	api.Get("/books/:id/read", authRequired, deps.Books.Read)
+	api.Get("/books/:id/access", authRequired, deps.Books.Access)
 }
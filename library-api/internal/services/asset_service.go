@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+var assetFormats = map[string]string{
+	".pdf":  "PDF",
+	".epub": "EPUB",
+	".mobi": "MOBI",
+	".djvu": "DJVU",
+	".mp3":  "MP3",
+}
+
+var assetContentTypes = map[string]string{
+	"PDF":  "application/pdf",
+	"EPUB": "application/epub+zip",
+	"MOBI": "application/x-mobipocket-ebook",
+	"DJVU": "image/vnd.djvu",
+	"MP3":  "audio/mpeg",
+}
+
+type AssetService struct {
+	db *gorm.DB
+}
+
+func NewAssetService(db *gorm.DB) *AssetService {
+	return &AssetService{db: db}
+}
+
+func DetectAssetFormat(filename string) string {
+	if format, ok := assetFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		return format
+	}
+	return ""
+}
+
+func NormalizeAssetFormat(value string) (string, error) {
+	format := strings.ToUpper(strings.TrimSpace(value))
+	for _, known := range assetFormats {
+		if known == format {
+			return format, nil
+		}
+	}
+	return "", errors.New("unsupported format")
+}
+
+func AssetContentType(format string) string {
+	return assetContentTypes[format]
+}
+
+func (s *AssetService) MigrateLegacy() error {
+	if err := s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_book_assets_primary ON book_assets (book_id) WHERE is_primary AND deleted_at IS NULL`).Error; err != nil {
+		return err
+	}
+	return s.db.Exec(`
+		INSERT INTO book_assets (created_at, updated_at, book_id, format, language, content_type, storage_key, is_primary)
+		SELECT NOW(), NOW(), b.id,
+			CASE WHEN LOWER(b.s3_key) LIKE '%.epub' THEN 'EPUB' ELSE 'PDF' END,
+			'es',
+			CASE WHEN LOWER(b.s3_key) LIKE '%.epub' THEN 'application/epub+zip' ELSE 'application/pdf' END,
+			b.s3_key, TRUE
+		FROM books b
+		WHERE b.s3_key <> '' AND b.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM book_assets a WHERE a.book_id = b.id)`).Error
+}
+
+func (s *AssetService) Create(asset *models.BookAsset) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.BookAsset{}).Where("book_id = ?", asset.BookID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			asset.IsPrimary = true
+		}
+		if asset.IsPrimary {
+			if err := tx.Model(&models.BookAsset{}).Where("book_id = ? AND is_primary = ?", asset.BookID, true).Update("is_primary", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(asset).Error; err != nil {
+			return err
+		}
+		if asset.IsPrimary {
+			return tx.Model(&models.Book{}).Where("id = ?", asset.BookID).Update("s3_key", asset.StorageKey).Error
+		}
+		return nil
+	})
+}
+
+func (s *AssetService) ListByBook(bookID uint) ([]models.BookAsset, error) {
+	var assets []models.BookAsset
+	if err := s.db.Where("book_id = ?", bookID).Order("is_primary DESC, created_at ASC").Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (s *AssetService) ListByBooks(bookIDs []uint) (map[uint][]models.BookAsset, error) {
+	result := make(map[uint][]models.BookAsset, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return result, nil
+	}
+	var assets []models.BookAsset
+	if err := s.db.Where("book_id IN ?", bookIDs).Order("is_primary DESC, created_at ASC").Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		result[asset.BookID] = append(result[asset.BookID], asset)
+	}
+	return result, nil
+}
+
+func (s *AssetService) Resolve(book *models.Book, assetID *uint, format string) (*models.BookAsset, error) {
+	var asset models.BookAsset
+	q := s.db.Where("book_id = ?", book.ID)
+	switch {
+	case assetID != nil:
+		q = q.Where("id = ?", *assetID)
+	case format != "":
+		q = q.Where("format = ?", strings.ToUpper(format)).Order("is_primary DESC, created_at DESC")
+	default:
+		q = q.Order("is_primary DESC, created_at ASC")
+	}
+	err := q.First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && assetID == nil && format == "" && book.S3Key != "" {
+		return &models.BookAsset{BookID: book.ID, StorageKey: book.S3Key, Format: DetectAssetFormat(book.S3Key), IsPrimary: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *AssetService) SetPrimary(bookID uint, assetID uint) (*models.BookAsset, error) {
+	var asset models.BookAsset
+	if err := s.db.Where("id = ? AND book_id = ?", assetID, bookID).First(&asset).Error; err != nil {
+		return nil, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.BookAsset{}).Where("book_id = ? AND is_primary = ?", bookID, true).Update("is_primary", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&asset).Update("is_primary", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Book{}).Where("id = ?", bookID).Update("s3_key", asset.StorageKey).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (s *AssetService) Delete(bookID uint, assetID uint) (*models.BookAsset, error) {
+	var asset models.BookAsset
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND book_id = ?", assetID, bookID).First(&asset).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.BookAsset{}).Where("book_id = ?", bookID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return errors.New("cannot delete the only asset of a book")
+		}
+		if err := tx.Unscoped().Delete(&asset).Error; err != nil {
+			return err
+		}
+		if !asset.IsPrimary {
+			return nil
+		}
+		var next models.BookAsset
+		if err := tx.Where("book_id = ?", bookID).Order("created_at DESC").First(&next).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&next).Update("is_primary", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Book{}).Where("id = ?", bookID).Update("s3_key", next.StorageKey).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
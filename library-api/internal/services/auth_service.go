@@ -2,66 +2,319 @@ package services
 
 import (
 	"errors"
+	"log"
+	"strings"
 	"time"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
 	"github.com/jos3lo89/library-api/internal/models"
 	"github.com/jos3lo89/library-api/internal/repositories"
 	"github.com/jos3lo89/library-api/pkg/utils"
 )
 
+const (
+	minPasswordLength = 8
+	dummyPasswordHash = "$2a$10$y/SxT/vlgiBEILj3yWGTCelTVAGH98eKDX2F8Qir0q73h6omAwZeu"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrUserInactive       = errors.New("user is inactive")
+	ErrTwoFactorRequired  = errors.New("two-factor authentication required")
+	ErrInvalidPreAuth     = errors.New("invalid or expired pre-auth token")
+)
+
+const (
+	TwoFactorVerify = "verify"
+	TwoFactorSetup  = "setup"
+)
+
+type LoginResult struct {
+	User          *models.User
+	Token         string
+	TwoFactorStep string
+	PreAuthToken  string
+}
+
 type AuthService struct {
 	users     *repositories.UserRepository
-	jwtSecret string
+	mail      *MailService
+	resets    ResetDelivery
+	guard     *LoginGuard
+	twoFactor *TwoFactorService
+	verifiers []CredentialVerifier
+	tokens    *utils.TokenSettings
 	tokenTTL  time.Duration
+	resetTTL  time.Duration
+	preAuth   time.Duration
 }
 
-func NewAuthService(users *repositories.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(users *repositories.UserRepository, mail *MailService, resets ResetDelivery, guard *LoginGuard, twoFactor *TwoFactorService, verifiers []CredentialVerifier, tokens *utils.TokenSettings, cfg *config.Config) *AuthService {
+	resetTTL := cfg.PasswordResetTTL
+	if resetTTL <= 0 {
+		resetTTL = 30 * time.Minute
+	}
+	preAuth := cfg.TwoFactorPreAuthTTL
+	if preAuth <= 0 {
+		preAuth = 5 * time.Minute
+	}
 	return &AuthService{
 		users:     users,
-		jwtSecret: jwtSecret,
+		mail:      mail,
+		resets:    resets,
+		guard:     guard,
+		twoFactor: twoFactor,
+		verifiers: verifiers,
+		tokens:    tokens,
 		tokenTTL:  24 * time.Hour,
+		resetTTL:  resetTTL,
+		preAuth:   preAuth,
 	}
 }
 
-func (s *AuthService) Register(dni, fullName, password string) (*models.User, error) {
-	hashed, err := utils.HashPassword(password)
+func (s *AuthService) Login(dni, password, ip string) (*LoginResult, error) {
+	user, err := s.verifyPassword(dni, password, ip)
 	if err != nil {
 		return nil, err
 	}
+	return s.StartSession(user)
+}
 
-	user := &models.User{
-		DNI:          dni,
-		FullName:     fullName,
-		PasswordHash: hashed,
-		Role:         models.RoleStudent,
-		IsActive:     true,
+func (s *AuthService) StartSession(user *models.User) (*LoginResult, error) {
+	if s.twoFactor.Required(user) {
+		step := TwoFactorVerify
+		if !user.TwoFactorEnabled {
+			step = TwoFactorSetup
+		}
+		preAuth, err := utils.GenerateScopedToken(user.ID, string(user.Role), user.SessionVersion, preAuthScope(step), s.tokens, s.preAuth)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, TwoFactorStep: step, PreAuthToken: preAuth}, nil
 	}
 
-	if err := s.users.Create(user); err != nil {
+	if err := s.guard.RecordSuccess(user.DNI); err != nil {
 		return nil, err
 	}
+	token, err := s.IssueToken(user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user, Token: token}, nil
+}
+
+func (s *AuthService) CompleteTwoFactor(preAuth, code, ip string) (string, *models.User, error) {
+	user, err := s.PreAuthUser(preAuth, TwoFactorVerify)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.guard.Check(user.DNI, ip); err != nil {
+		return "", nil, err
+	}
+
+	if err := s.twoFactor.Verify(user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if err := s.guard.RecordFailure(user.DNI, ip); err != nil {
+				return "", nil, err
+			}
+		}
+		return "", nil, err
+	}
 
+	if err := s.guard.RecordSuccess(user.DNI); err != nil {
+		return "", nil, err
+	}
+	token, err := s.IssueToken(user)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, user, nil
+}
+
+func (s *AuthService) PreAuthUser(preAuth string, step string) (*models.User, error) {
+	claims, err := utils.ParseToken(preAuth, s.tokens)
+	if err != nil || claims.Scope != preAuthScope(step) {
+		return nil, ErrInvalidPreAuth
+	}
+	user, err := s.users.FindByID(claims.UserID)
+	if err != nil || !user.IsActive || user.SessionVersion != claims.SessionVersion {
+		return nil, ErrInvalidPreAuth
+	}
 	return user, nil
 }
 
-func (s *AuthService) Login(dni, password string) (string, *models.User, error) {
-	user, err := s.users.FindByDNI(dni)
+func (s *AuthService) IssueToken(user *models.User) (string, error) {
+	return utils.GenerateToken(user.ID, string(user.Role), user.SessionVersion, s.tokens, s.tokenTTL)
+}
+
+func (s *AuthService) VerifyCredentials(dni, password, ip string) (*models.User, error) {
+	user, err := s.verifyPassword(dni, password, ip)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	if s.twoFactor.Required(user) {
+		return nil, ErrTwoFactorRequired
+	}
+	if err := s.guard.RecordSuccess(user.DNI); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthService) verifyPassword(dni, password, ip string) (*models.User, error) {
+	dni = strings.TrimSpace(dni)
+	if err := s.guard.Check(dni, ip); err != nil {
+		return nil, err
+	}
+
+	user, err := s.checkCredentials(dni, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := s.guard.RecordFailure(dni, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if !user.IsActive {
-		return "", nil, errors.New("user is inactive")
+		return nil, ErrUserInactive
 	}
+	return user, nil
+}
 
-	if !utils.CheckPassword(password, user.PasswordHash) {
-		return "", nil, errors.New("invalid credentials")
+func (s *AuthService) checkCredentials(dni, password string) (*models.User, error) {
+	for _, verifier := range s.verifiers {
+		user, err := verifier.Verify(dni, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("credential verifier %s: %v", verifier.Name(), err)
+		}
 	}
+	return nil, ErrInvalidCredentials
+}
 
-	token, err := utils.GenerateToken(user.ID, string(user.Role), s.jwtSecret, s.tokenTTL)
+func (s *AuthService) CheckSession(userID uint, sessionVersion uint) error {
+	user, err := s.users.FindByID(userID)
+	if err != nil || !user.IsActive || user.SessionVersion != sessionVersion {
+		return ErrSessionExpired
+	}
+	if s.twoFactor.Required(user) && !user.TwoFactorEnabled {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+func (s *AuthService) RequestPasswordReset(dni string) error {
+	user, err := s.users.FindByDNI(dni)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive || user.AuthSource != models.AuthSourceLocal {
+		return nil
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	reset := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(s.resetTTL),
+	}
+
+	return s.users.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(reset).Error; err != nil {
+			return err
+		}
+		return s.resets.Deliver(tx, user, token, reset.ExpiresAt)
+	})
+}
+
+func (s *AuthService) ResetPassword(token string, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	hashed, err := utils.HashPassword(password)
 	if err != nil {
+		return err
+	}
+
+	return s.users.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+			First(&reset).Error
+		if err != nil {
+			return ErrInvalidResetToken
+		}
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return s.users.WithTx(tx).UpdatePassword(reset.UserID, hashed)
+	})
+}
+
+func (s *AuthService) ChangePassword(userID uint, oldPassword string, newPassword string, ip string) (string, *models.User, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.guard.Check(user.DNI, ip); err != nil {
+		return "", nil, err
+	}
+	if !utils.CheckPassword(oldPassword, user.PasswordHash) {
+		if err := s.guard.RecordFailure(user.DNI, ip); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrInvalidCredentials
+	}
+	if err := s.guard.RecordSuccess(user.DNI); err != nil {
+		return "", nil, err
+	}
+	if len(newPassword) < minPasswordLength {
+		return "", nil, ErrWeakPassword
+	}
+	hashed, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.users.UpdatePassword(user.ID, hashed); err != nil {
 		return "", nil, err
 	}
 
+	user, err = s.users.FindByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := s.IssueToken(user)
+	if err != nil {
+		return "", nil, err
+	}
 	return token, user, nil
 }
+
+func preAuthScope(step string) string {
+	return "2fa_" + step
+}
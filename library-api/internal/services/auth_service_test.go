@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const testPassword = "contrasena-segura"
+
+var resetLinkPattern = regexp.MustCompile(`https://\S+`)
+
+type capturedReset struct {
+	userID    uint
+	token     string
+	expiresAt time.Time
+}
+
+type captureResets struct {
+	sent []capturedReset
+}
+
+func (c *captureResets) Deliver(tx *gorm.DB, user *models.User, token string, expiresAt time.Time) error {
+	c.sent = append(c.sent, capturedReset{userID: user.ID, token: token, expiresAt: expiresAt})
+	return nil
+}
+
+func (c *captureResets) last(t *testing.T) capturedReset {
+	t.Helper()
+	if len(c.sent) == 0 {
+		t.Fatal("no reset delivered")
+	}
+	return c.sent[len(c.sent)-1]
+}
+
+type authFixture struct {
+	db      *gorm.DB
+	cfg     *config.Config
+	mail    *MailService
+	resets  *captureResets
+	service *AuthService
+}
+
+func newAuthFixture(t *testing.T, configure func(*config.Config)) *authFixture {
+	t.Helper()
+	db := newTestDB(t, &models.User{}, &models.PasswordResetToken{}, &models.LoginThrottle{}, &models.AuthAuditLog{},
+		&models.RecoveryCode{}, &models.SigningKey{}, &models.OutboxEmail{})
+	cfg := &config.Config{
+		MailFrom:           "Biblioteca <no-reply@biblioteca.local>",
+		MailLocale:         "es",
+		PasswordResetURL:   "https://biblioteca.example.edu/reset-password?lang=es",
+		PasswordResetTTL:   30 * time.Minute,
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginFailureWindow: 15 * time.Minute,
+		LoginLockout:       15 * time.Minute,
+		TOTPEncryptionKey:  testTOTPKey,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	mail, err := NewMailService(db, NewMemoryTransport(), cfg)
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	keys := newTestSigningKeys(t, db, utils.AlgorithmEdDSA, testSigningSecret)
+	addSigningKey(t, keys, time.Now())
+
+	users := repositories.NewUserRepository(db)
+	resets := &captureResets{}
+	service := NewAuthService(users, mail, resets, NewLoginGuard(db, cfg), NewTwoFactorService(db, cfg),
+		[]CredentialVerifier{&LocalVerifier{users: users}}, testTokenSettings(keys), cfg)
+	return &authFixture{db: db, cfg: cfg, mail: mail, resets: resets, service: service}
+}
+
+func (f *authFixture) createUser(t *testing.T, dni string, source string) *models.User {
+	t.Helper()
+	hashed, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := &models.User{
+		DNI:          dni,
+		FullName:     "Ana Torres",
+		Email:        "ana.torres@universidad.edu.pe",
+		PasswordHash: hashed,
+		Role:         models.RoleStudent,
+		IsActive:     true,
+		AuthSource:   source,
+	}
+	if err := f.db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func (f *authFixture) reload(t *testing.T, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := f.db.First(&user, id).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return &user
+}
+
+func (f *authFixture) requestReset(t *testing.T, dni string) string {
+	t.Helper()
+	if err := f.service.RequestPasswordReset(dni); err != nil {
+		t.Fatalf("request reset: %v", err)
+	}
+	return f.resets.last(t).token
+}
+
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	user := f.createUser(t, "12345678", models.AuthSourceLocal)
+	session, err := f.service.Login("12345678", testPassword, testGuardIP)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	before := time.Now()
+	token := f.requestReset(t, "12345678")
+	delivered := f.resets.last(t)
+	if delivered.userID != user.ID || delivered.expiresAt.Before(before.Add(29*time.Minute)) || delivered.expiresAt.After(time.Now().Add(30*time.Minute)) {
+		t.Fatalf("unexpected delivery: %+v", delivered)
+	}
+	var stored models.PasswordResetToken
+	if err := f.db.Where("user_id = ?", user.ID).First(&stored).Error; err != nil {
+		t.Fatalf("load reset token: %v", err)
+	}
+	if stored.TokenHash != utils.HashToken(token) || stored.UsedAt != nil {
+		t.Fatalf("reset token must be stored hashed and unused: %+v", stored)
+	}
+
+	if err := f.service.ResetPassword(token, "nueva-clave-2026"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := f.service.ResetPassword(token, "otra-clave-2026"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken on reuse, got %v", err)
+	}
+
+	updated := f.reload(t, user.ID)
+	if updated.SessionVersion != user.SessionVersion+1 || updated.PasswordChangedAt == nil {
+		t.Fatalf("reset must end existing sessions: %+v", updated)
+	}
+	if err := f.service.CheckSession(user.ID, session.User.SessionVersion); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired for the old session, got %v", err)
+	}
+	if err := f.service.CheckSession(user.ID, updated.SessionVersion); err != nil {
+		t.Fatalf("current session version: %v", err)
+	}
+	if _, err := f.service.Login("12345678", testPassword, testGuardIP); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("old password must stop working, got %v", err)
+	}
+	if _, err := f.service.Login("12345678", "nueva-clave-2026", testGuardIP); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+}
+
+func TestPasswordResetInvalidatesEarlierTokens(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	f.createUser(t, "12345678", models.AuthSourceLocal)
+
+	first := f.requestReset(t, "12345678")
+	second := f.requestReset(t, "12345678")
+	if first == second {
+		t.Fatal("each request must issue a new token")
+	}
+	if err := f.service.ResetPassword(first, "nueva-clave-2026"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("earlier token must be invalidated, got %v", err)
+	}
+	if err := f.service.ResetPassword(second, "nueva-clave-2026"); err != nil {
+		t.Fatalf("latest token: %v", err)
+	}
+}
+
+func TestPasswordResetRejectsExpiredAndWeak(t *testing.T) {
+	f := newAuthFixture(t, func(cfg *config.Config) { cfg.PasswordResetTTL = 0 })
+	user := f.createUser(t, "12345678", models.AuthSourceLocal)
+
+	token := f.requestReset(t, "12345678")
+	if remaining := time.Until(f.resets.last(t).expiresAt); remaining < 29*time.Minute || remaining > 30*time.Minute {
+		t.Fatalf("expected the default 30 minute ttl, got %s", remaining)
+	}
+
+	if err := f.service.ResetPassword(token, "corta"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if err := f.service.ResetPassword("not-a-token", "nueva-clave-2026"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken, got %v", err)
+	}
+
+	f.db.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Second))
+	if err := f.service.ResetPassword(token, "nueva-clave-2026"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken for an expired token, got %v", err)
+	}
+	if updated := f.reload(t, user.ID); updated.SessionVersion != user.SessionVersion || updated.PasswordHash != user.PasswordHash {
+		t.Fatalf("rejected resets must not change the account: %+v", updated)
+	}
+}
+
+func TestPasswordResetIgnoresUnknownAndExternalAccounts(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	f.createUser(t, "10000001", models.AuthSourceLDAP)
+	f.createUser(t, "10000002", models.AuthSourceOIDC)
+	inactive := f.createUser(t, "10000003", models.AuthSourceLocal)
+	f.db.Model(&models.User{}).Where("id = ?", inactive.ID).Update("is_active", false)
+
+	for _, dni := range []string{"99999999", "10000001", "10000002", "10000003"} {
+		if err := f.service.RequestPasswordReset(dni); err != nil {
+			t.Fatalf("%s: requests must not reveal account state, got %v", dni, err)
+		}
+	}
+	if len(f.resets.sent) != 0 {
+		t.Fatalf("expected no deliveries, got %d", len(f.resets.sent))
+	}
+	var tokens int64
+	f.db.Model(&models.PasswordResetToken{}).Count(&tokens)
+	if tokens != 0 {
+		t.Fatalf("expected no reset tokens, got %d", tokens)
+	}
+}
+
+func TestMailResetDeliverySendsLink(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	user := f.createUser(t, "12345678", models.AuthSourceLocal)
+	delivery, err := NewResetDelivery(f.cfg, f.mail)
+	if err != nil {
+		t.Fatalf("reset delivery: %v", err)
+	}
+	f.service.resets = delivery
+
+	if err := f.service.RequestPasswordReset("12345678"); err != nil {
+		t.Fatalf("request reset: %v", err)
+	}
+	var email models.OutboxEmail
+	if err := f.db.Where("template = ?", "password_reset").First(&email).Error; err != nil {
+		t.Fatalf("no reset email queued: %v", err)
+	}
+	if email.Recipient != user.Email {
+		t.Fatalf("unexpected recipient %s", email.Recipient)
+	}
+	link, err := url.Parse(resetLinkPattern.FindString(email.TextBody))
+	if err != nil || link.Host != "biblioteca.example.edu" || link.Query().Get("lang") != "es" {
+		t.Fatalf("unexpected reset link in %q: %v", email.TextBody, err)
+	}
+	if err := f.service.ResetPassword(link.Query().Get("token"), "nueva-clave-2026"); err != nil {
+		t.Fatalf("reset with the mailed token: %v", err)
+	}
+
+	f.db.Model(&models.User{}).Where("id = ?", user.ID).Update("email", "")
+	if err := f.service.RequestPasswordReset("12345678"); err != nil {
+		t.Fatalf("request reset without email: %v", err)
+	}
+	var queued int64
+	f.db.Model(&models.OutboxEmail{}).Count(&queued)
+	if queued != 1 {
+		t.Fatalf("expected no email for accounts without an address, got %d", queued)
+	}
+
+	f.cfg.PasswordResetChannel = "sms"
+	if _, err := NewResetDelivery(f.cfg, f.mail); err == nil {
+		t.Fatal("expected error for an unknown reset channel")
+	}
+}
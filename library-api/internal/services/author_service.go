@@ -0,0 +1,377 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+var (
+	ErrAuthorNotFound   = errors.New("author not found")
+	ErrAuthorName       = errors.New("author name required")
+	ErrBookNotFound     = errors.New("book not found")
+	ErrInvalidRole      = errors.New("role must be AUTHOR, EDITOR or TRANSLATOR")
+	ErrVariantInUse     = errors.New("name variant already belongs to another author")
+	ErrInvalidMergeList = errors.New("source_ids must list other existing authors")
+)
+
+type AuthorCredit struct {
+	AuthorID uint              `json:"author_id"`
+	Name     string            `json:"name"`
+	Role     models.AuthorRole `json:"role"`
+}
+
+type AuthorSummary struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	BookCount int64  `json:"book_count"`
+}
+
+type AuthorBook struct {
+	Role models.AuthorRole `json:"role"`
+	Book models.Book       `json:"book"`
+}
+
+type AuthorService struct {
+	db *gorm.DB
+}
+
+func NewAuthorService(db *gorm.DB) *AuthorService {
+	return &AuthorService{db: db}
+}
+
+func AuthorKey(name string) string {
+	return Slugify(name)
+}
+
+func ValidAuthorRole(role models.AuthorRole) bool {
+	switch role {
+	case models.AuthorRoleAuthor, models.AuthorRoleEditor, models.AuthorRoleTranslator:
+		return true
+	}
+	return false
+}
+
+func (s *AuthorService) MigrateLegacy() error {
+	var books []models.Book
+	err := s.db.Where("author <> '' AND NOT EXISTS (SELECT 1 FROM book_authors ba WHERE ba.book_id = books.id)").Find(&books).Error
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		credits := CreditsFromString(book.Author)
+		if err := s.LinkBook(book.ID, credits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CreditsFromString(value string) []AuthorCredit {
+	var credits []AuthorCredit
+	for _, name := range splitAuthors(value) {
+		credits = append(credits, AuthorCredit{Name: name, Role: models.AuthorRoleAuthor})
+	}
+	return credits
+}
+
+func (s *AuthorService) Create(name string, variants []string) (*models.Author, error) {
+	var author *models.Author
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		author, err = s.findOrCreate(tx, name)
+		if err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			if err := addVariant(tx, author.ID, variant); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(author.ID)
+}
+
+func (s *AuthorService) findOrCreate(tx *gorm.DB, name string) (*models.Author, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	key := AuthorKey(name)
+	if key == "" {
+		return nil, ErrAuthorName
+	}
+
+	var variant models.AuthorVariant
+	err := tx.Where("name_key = ?", key).First(&variant).Error
+	if err == nil {
+		var author models.Author
+		if err := tx.First(&author, variant.AuthorID).Error; err != nil {
+			return nil, err
+		}
+		return &author, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	author := &models.Author{Name: name}
+	if err := tx.Create(author).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.AuthorVariant{AuthorID: author.ID, Name: name, NameKey: key}).Error; err != nil {
+		return nil, err
+	}
+	return author, nil
+}
+
+func addVariant(tx *gorm.DB, authorID uint, name string) error {
+	name = strings.Join(strings.Fields(name), " ")
+	key := AuthorKey(name)
+	if key == "" {
+		return nil
+	}
+	var existing models.AuthorVariant
+	err := tx.Where("name_key = ?", key).First(&existing).Error
+	if err == nil {
+		if existing.AuthorID != authorID {
+			return ErrVariantInUse
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return tx.Create(&models.AuthorVariant{AuthorID: authorID, Name: name, NameKey: key}).Error
+}
+
+func (s *AuthorService) AddVariant(authorID uint, name string) (*models.Author, error) {
+	if _, err := s.FindByID(authorID); err != nil {
+		return nil, err
+	}
+	if err := addVariant(s.db, authorID, name); err != nil {
+		return nil, err
+	}
+	return s.FindByID(authorID)
+}
+
+func (s *AuthorService) Rename(authorID uint, name string) (*models.Author, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return nil, ErrAuthorName
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var author models.Author
+		if err := tx.First(&author, authorID).Error; err != nil {
+			return ErrAuthorNotFound
+		}
+		if err := addVariant(tx, authorID, name); err != nil {
+			return err
+		}
+		if err := tx.Model(&author).Update("name", name).Error; err != nil {
+			return err
+		}
+		return refreshAuthorStrings(tx, []uint{authorID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(authorID)
+}
+
+func (s *AuthorService) FindByID(id uint) (*models.Author, error) {
+	var author models.Author
+	if err := s.db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name ASC")
+	}).First(&author, id).Error; err != nil {
+		return nil, ErrAuthorNotFound
+	}
+	return &author, nil
+}
+
+func (s *AuthorService) Search(query string, offset int, limit int) ([]AuthorSummary, int64, error) {
+	var total int64
+	q := s.db.Model(&models.Author{})
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + query + "%"
+		keyLike := "%" + AuthorKey(query) + "%"
+		q = q.Where("authors.id IN (SELECT author_id FROM author_variants WHERE name ILIKE ? OR name_key LIKE ?)", like, keyLike)
+	}
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []AuthorSummary
+	err := q.Select("authors.id, authors.name, (SELECT COUNT(DISTINCT ba.book_id) FROM book_authors ba JOIN books b ON b.id = ba.book_id AND b.deleted_at IS NULL WHERE ba.author_id = authors.id) AS book_count").
+		Order("authors.name ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *AuthorService) ListBooks(authorID uint) ([]AuthorBook, error) {
+	var links []models.BookAuthor
+	err := s.db.InnerJoins("Book").Preload("Book.Category").
+		Where("book_authors.author_id = ?", authorID).
+		Order(`"Book".title ASC`).
+		Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	books := make([]AuthorBook, 0, len(links))
+	for _, link := range links {
+		books = append(books, AuthorBook{Role: link.Role, Book: link.Book})
+	}
+	return books, nil
+}
+
+func (s *AuthorService) LinkBook(bookID uint, credits []AuthorCredit) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Book{}).Where("id = ?", bookID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrBookNotFound
+		}
+		return s.SetBookAuthors(tx, bookID, credits)
+	})
+}
+
+func (s *AuthorService) BookCredits(bookID uint) ([]models.BookAuthor, error) {
+	var credits []models.BookAuthor
+	err := s.db.Preload("Author").Where("book_id = ?", bookID).Order("position ASC").Find(&credits).Error
+	return credits, err
+}
+
+func (s *AuthorService) SetBookAuthors(tx *gorm.DB, bookID uint, credits []AuthorCredit) error {
+	if err := tx.Where("book_id = ?", bookID).Delete(&models.BookAuthor{}).Error; err != nil {
+		return err
+	}
+
+	for position, credit := range credits {
+		if credit.Role == "" {
+			credit.Role = models.AuthorRoleAuthor
+		}
+		if !ValidAuthorRole(credit.Role) {
+			return ErrInvalidRole
+		}
+
+		var author *models.Author
+		if credit.AuthorID != 0 {
+			author = &models.Author{}
+			if err := tx.First(author, credit.AuthorID).Error; err != nil {
+				return ErrAuthorNotFound
+			}
+		} else {
+			var err error
+			if author, err = s.findOrCreate(tx, credit.Name); err != nil {
+				return err
+			}
+		}
+
+		link := models.BookAuthor{BookID: bookID, AuthorID: author.ID, Role: credit.Role, Position: position}
+		if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error; err != nil {
+			return err
+		}
+	}
+
+	return refreshBookAuthorString(tx, bookID)
+}
+
+func (s *AuthorService) Merge(targetID uint, sourceIDs []uint) (*models.Author, error) {
+	sourceIDs = uniqueIDs(sourceIDs)
+	if len(sourceIDs) == 0 {
+		return nil, ErrInvalidMergeList
+	}
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return nil, ErrInvalidMergeList
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var target models.Author
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return ErrAuthorNotFound
+		}
+		var count int64
+		if err := tx.Model(&models.Author{}).Where("id IN ?", sourceIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(sourceIDs) {
+			return ErrInvalidMergeList
+		}
+
+		if err := tx.Model(&models.AuthorVariant{}).Where("author_id IN ?", sourceIDs).Update("author_id", targetID).Error; err != nil {
+			return err
+		}
+
+		var bookIDs []uint
+		if err := tx.Model(&models.BookAuthor{}).Where("author_id IN ?", sourceIDs).Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+			INSERT INTO book_authors (book_id, author_id, role, position)
+			SELECT book_id, ?, role, MIN(position) FROM book_authors WHERE author_id IN ?
+			GROUP BY book_id, role
+			ON CONFLICT DO NOTHING`, targetID, sourceIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("author_id IN ?", sourceIDs).Delete(&models.BookAuthor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Author{}, sourceIDs).Error; err != nil {
+			return err
+		}
+
+		for _, bookID := range bookIDs {
+			if err := refreshBookAuthorString(tx, bookID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(targetID)
+}
+
+func refreshAuthorStrings(tx *gorm.DB, authorIDs []uint) error {
+	var bookIDs []uint
+	if err := tx.Model(&models.BookAuthor{}).Where("author_id IN ?", authorIDs).Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+		return err
+	}
+	for _, bookID := range bookIDs {
+		if err := refreshBookAuthorString(tx, bookID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refreshBookAuthorString(tx *gorm.DB, bookID uint) error {
+	var names []string
+	err := tx.Model(&models.BookAuthor{}).
+		Joins("JOIN authors ON authors.id = book_authors.author_id").
+		Where("book_authors.book_id = ? AND book_authors.role = ?", bookID, models.AuthorRoleAuthor).
+		Order("book_authors.position ASC").
+		Pluck("authors.name", &names).Error
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Book{}).Where("id = ?", bookID).Update("author", strings.Join(names, "; ")).Error
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorSort    = errors.New("cursor pagination supports sort=created_at|title|author|rating")
+)
+
+type BookPage struct {
+	Items      []models.Book `json:"items"`
+	Total      *int64        `json:"total,omitempty"`
+	Limit      int           `json:"limit"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
+}
+
+type bookCursorPayload struct {
+	Sort   string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     uint   `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+func (s *BookService) ListCursor(filter BookFilter, cursor string, withTotal bool) (*BookPage, error) {
+	var position *repositories.BookCursor
+	if cursor != "" {
+		payload, err := decodeBookCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.Sort, filter.Order = payload.Sort, payload.Order
+		value, err := parseCursorValue(payload.Sort, payload.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		position = &repositories.BookCursor{Value: value, ID: payload.ID, Before: payload.Before}
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "created_at"
+	}
+	if _, ok := repositories.BookCursorColumns[filter.Sort]; !ok {
+		return nil, ErrCursorSort
+	}
+	if strings.EqualFold(filter.Order, "asc") {
+		filter.Order = "asc"
+	} else {
+		filter.Order = "desc"
+	}
+
+	result, err := s.books.ListKeyset(filter, position, withTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &BookPage{Items: result.Items, Total: result.Total, Limit: filter.Limit}
+	if len(page.Items) == 0 {
+		return page, nil
+	}
+	if result.HasNext {
+		page.NextCursor = encodeBookCursor(filter, &page.Items[len(page.Items)-1], false)
+	}
+	if result.HasPrev {
+		page.PrevCursor = encodeBookCursor(filter, &page.Items[0], true)
+	}
+	return page, nil
+}
+
+func encodeBookCursor(filter BookFilter, book *models.Book, before bool) string {
+	payload := bookCursorPayload{Sort: filter.Sort, Order: filter.Order, ID: book.ID, Before: before}
+	switch filter.Sort {
+	case "title":
+		payload.Value = book.Title
+	case "author":
+		payload.Value = book.Author
+	case "rating":
+		payload.Value = strconv.FormatFloat(book.Rating, 'f', 2, 64)
+	default:
+		payload.Value = book.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeBookCursor(cursor string) (*bookCursorPayload, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload bookCursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if _, ok := repositories.BookCursorColumns[payload.Sort]; !ok {
+		return nil, ErrInvalidCursor
+	}
+	if payload.Order != "asc" && payload.Order != "desc" {
+		return nil, ErrInvalidCursor
+	}
+	return &payload, nil
+}
+
+func parseCursorValue(sort string, value string) (any, error) {
+	switch sort {
+	case "title", "author":
+		return value, nil
+	case "rating":
+		return strconv.ParseFloat(value, 64)
+	default:
+		return time.Parse(time.RFC3339Nano, value)
+	}
+}
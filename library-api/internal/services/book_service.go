@@ -1,10 +1,25 @@
 package services
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/jos3lo89/library-api/internal/models"
 	"github.com/jos3lo89/library-api/internal/repositories"
 )
 
+var (
+	ErrDuplicateISBN = errors.New("isbn already registered for this edition")
+	ErrInvalidYear   = errors.New("invalid publication year")
+	ErrInvalidPages  = errors.New("invalid page count")
+)
+
+type (
+	BookFilter = repositories.BookFilter
+	BookFacets = repositories.BookFacets
+)
+
 type BookService struct {
 	books *repositories.BookRepository
 }
@@ -14,13 +29,66 @@ func NewBookService(books *repositories.BookRepository) *BookService {
 }
 
 func (s *BookService) Create(book *models.Book) error {
-	return s.books.Create(book)
+	if err := s.prepare(book); err != nil {
+		return err
+	}
+	return translateBookError(s.books.Create(book))
+}
+
+func (s *BookService) Update(book *models.Book) error {
+	if err := s.prepare(book); err != nil {
+		return err
+	}
+	return translateBookError(s.books.Update(book))
 }
 
 func (s *BookService) FindByID(id uint) (*models.Book, error) {
 	return s.books.FindByID(id)
 }
 
-func (s *BookService) List(query string, categoryID *uint, offset int, limit int) ([]models.Book, int64, error) {
-	return s.books.List(query, categoryID, offset, limit)
+func (s *BookService) List(filter BookFilter) ([]models.Book, int64, error) {
+	return s.books.List(filter)
+}
+
+func (s *BookService) Facets(filter BookFilter) (*BookFacets, error) {
+	return s.books.Facets(filter)
+}
+
+func (s *BookService) prepare(book *models.Book) error {
+	book.Publisher = strings.TrimSpace(book.Publisher)
+	book.Language = strings.ToLower(strings.TrimSpace(book.Language))
+	book.Edition = strings.TrimSpace(book.Edition)
+
+	if book.Year != 0 && (book.Year < 1000 || book.Year > time.Now().Year()+1) {
+		return ErrInvalidYear
+	}
+	if book.Pages < 0 {
+		return ErrInvalidPages
+	}
+
+	if strings.TrimSpace(book.ISBN) == "" {
+		book.ISBN = ""
+		return nil
+	}
+	isbn, err := NormalizeISBN(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = isbn
+
+	exists, err := s.books.ExistsISBN(book.ISBN, book.Edition, book.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateISBN
+	}
+	return nil
+}
+
+func translateBookError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "idx_books_isbn_edition") {
+		return ErrDuplicateISBN
+	}
+	return err
 }
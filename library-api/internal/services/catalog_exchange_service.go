@@ -0,0 +1,563 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+)
+
+const (
+	CatalogFormatMARCXML  = "marcxml"
+	CatalogFormatISO2709  = "iso2709"
+	CatalogFormatDC       = "dc"
+	defaultImportCategory = "Sin clasificar"
+)
+
+var errDryRun = errors.New("dry run")
+
+type CatalogRecord struct {
+	Identifier  string
+	Title       string
+	Authors     []string
+	Description string
+	Subjects    []string
+	Language    string
+	ISBN        string
+	Publisher   string
+	Year        int
+	Pages       int
+	Edition     string
+}
+
+type ImportOptions struct {
+	Format      string
+	DryRun      bool
+	OnDuplicate string
+	CategoryID  *uint
+}
+
+type ImportItem struct {
+	Index    int    `json:"index"`
+	Title    string `json:"title"`
+	Action   string `json:"action"`
+	BookID   uint   `json:"book_id,omitempty"`
+	Category string `json:"category,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	categoryCreated bool
+}
+
+type ImportReport struct {
+	Format            string       `json:"format"`
+	DryRun            bool         `json:"dry_run"`
+	Total             int          `json:"total"`
+	Created           int          `json:"created"`
+	Updated           int          `json:"updated"`
+	Skipped           int          `json:"skipped"`
+	Failed            int          `json:"failed"`
+	CategoriesCreated []string     `json:"categories_created"`
+	Items             []ImportItem `json:"items"`
+}
+
+type ExportFilter struct {
+	Query      string
+	CategoryID *uint
+	IDs        []uint
+}
+
+type CatalogExchangeService struct {
+	db          *gorm.DB
+	authors     *AuthorService
+	suggestions *SuggestionService
+}
+
+func NewCatalogExchangeService(db *gorm.DB, authors *AuthorService, suggestions *SuggestionService) *CatalogExchangeService {
+	return &CatalogExchangeService{db: db, authors: authors, suggestions: suggestions}
+}
+
+func DetectCatalogFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.Contains(trimmed, []byte("loc.gov/MARC21/slim")) || bytes.Contains(trimmed, []byte("<collection")):
+		return CatalogFormatMARCXML
+	case bytes.Contains(trimmed, []byte("purl.org/dc/elements")):
+		return CatalogFormatDC
+	case len(trimmed) >= 5:
+		if _, err := strconv.Atoi(string(trimmed[:5])); err == nil {
+			return CatalogFormatISO2709
+		}
+	}
+	return ""
+}
+
+func ParseCatalogRecords(format string, data []byte) ([]CatalogRecord, error) {
+	switch format {
+	case CatalogFormatMARCXML, CatalogFormatISO2709:
+		var marcRecords []MARCRecord
+		var err error
+		if format == CatalogFormatMARCXML {
+			marcRecords, err = ParseMARCXML(data)
+		} else {
+			marcRecords, err = ParseISO2709(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		records := make([]CatalogRecord, 0, len(marcRecords))
+		for i := range marcRecords {
+			records = append(records, marcToCatalogRecord(&marcRecords[i]))
+		}
+		return records, nil
+	case CatalogFormatDC:
+		dcRecords, err := ParseDublinCore(data)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]CatalogRecord, 0, len(dcRecords))
+		for _, record := range dcRecords {
+			records = append(records, dcToCatalogRecord(record))
+		}
+		return records, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func (s *CatalogExchangeService) Import(data []byte, options ImportOptions) (*ImportReport, error) {
+	records, err := ParseCatalogRecords(options.Format, data)
+	if err != nil {
+		return nil, err
+	}
+	if options.OnDuplicate == "" {
+		options.OnDuplicate = "skip"
+	}
+	if options.OnDuplicate != "skip" && options.OnDuplicate != "update" {
+		return nil, errors.New("on_duplicate must be skip or update")
+	}
+
+	report := &ImportReport{
+		Format:            options.Format,
+		DryRun:            options.DryRun,
+		Total:             len(records),
+		CategoriesCreated: []string{},
+		Items:             make([]ImportItem, 0, len(records)),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if options.CategoryID != nil {
+			var category models.Category
+			if err := tx.First(&category, *options.CategoryID).Error; err != nil {
+				return errors.New("category not found")
+			}
+		}
+		for i, record := range records {
+			savepoint := fmt.Sprintf("import_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			item, err := s.importRecord(tx, record, options, report)
+			item.Index = i + 1
+			item.Title = record.Title
+			if err != nil {
+				if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+					return rollbackErr
+				}
+				item.Action = "error"
+				item.Error = err.Error()
+				report.Failed++
+			} else if item.categoryCreated {
+				report.CategoriesCreated = append(report.CategoriesCreated, item.Category)
+			}
+			report.Items = append(report.Items, item)
+		}
+		if options.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *CatalogExchangeService) importRecord(tx *gorm.DB, record CatalogRecord, options ImportOptions, report *ImportReport) (ImportItem, error) {
+	item := ImportItem{}
+	if strings.TrimSpace(record.Title) == "" {
+		return item, errors.New("record has no title")
+	}
+	author := strings.Join(record.Authors, "; ")
+	if author == "" {
+		return item, errors.New("record has no author")
+	}
+
+	category, created, err := s.resolveCategory(tx, record, options)
+	if err != nil {
+		return item, err
+	}
+	item.Category = category.Name
+	item.categoryCreated = created
+
+	var existing models.Book
+	if record.ISBN != "" {
+		err = tx.Where("isbn = ? AND edition = ?", record.ISBN, record.Edition).First(&existing).Error
+	} else {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Where("LOWER(title) = LOWER(?) AND LOWER(author) = LOWER(?)", record.Title, author).First(&existing).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return item, err
+	}
+
+	if err == nil {
+		item.BookID = existing.ID
+		if options.OnDuplicate == "skip" {
+			item.Action = "skip"
+			report.Skipped++
+			return item, nil
+		}
+		updates := map[string]any{"category_id": category.ID}
+		for column, value := range map[string]string{
+			"description": record.Description,
+			"isbn":        record.ISBN,
+			"publisher":   record.Publisher,
+			"language":    record.Language,
+			"edition":     record.Edition,
+		} {
+			if value != "" {
+				updates[column] = value
+			}
+		}
+		if record.Year != 0 {
+			updates["year"] = record.Year
+		}
+		if record.Pages != 0 {
+			updates["pages"] = record.Pages
+		}
+		if err := tx.Model(&existing).Updates(updates).Error; err != nil {
+			return item, err
+		}
+		if err := s.authors.SetBookAuthors(tx, existing.ID, CreditsFromString(author)); err != nil {
+			return item, err
+		}
+		if tags := recordTags(record, category.Name); len(tags) > 0 {
+			if _, err := setBookTags(tx, &existing, tags); err != nil {
+				return item, err
+			}
+		}
+		item.Action = "update"
+		report.Updated++
+		return item, nil
+	}
+
+	book := &models.Book{
+		Title:       record.Title,
+		Author:      author,
+		Description: record.Description,
+		ISBN:        record.ISBN,
+		Publisher:   record.Publisher,
+		Year:        record.Year,
+		Language:    record.Language,
+		Pages:       record.Pages,
+		Edition:     record.Edition,
+		CategoryID:  category.ID,
+	}
+	if err := tx.Create(book).Error; err != nil {
+		return item, err
+	}
+	if err := s.authors.SetBookAuthors(tx, book.ID, CreditsFromString(author)); err != nil {
+		return item, err
+	}
+	if tags := recordTags(record, category.Name); len(tags) > 0 {
+		if _, err := setBookTags(tx, book, tags); err != nil {
+			return item, err
+		}
+	}
+	if err := s.suggestions.MatchBook(tx, book); err != nil {
+		return item, err
+	}
+	item.BookID = book.ID
+	item.Action = "create"
+	report.Created++
+	return item, nil
+}
+
+func recordTags(record CatalogRecord, category string) []string {
+	var tags []string
+	for _, subject := range record.Subjects {
+		if !strings.EqualFold(subject, category) {
+			tags = append(tags, subject)
+		}
+	}
+	return tags
+}
+
+func (s *CatalogExchangeService) resolveCategory(tx *gorm.DB, record CatalogRecord, options ImportOptions) (*models.Category, bool, error) {
+	var category models.Category
+	if options.CategoryID != nil {
+		if err := tx.First(&category, *options.CategoryID).Error; err != nil {
+			return nil, false, err
+		}
+		return &category, false, nil
+	}
+
+	name := defaultImportCategory
+	if len(record.Subjects) > 0 {
+		name = record.Subjects[0]
+	}
+
+	err := tx.Where("LOWER(name) = LOWER(?)", name).First(&category).Error
+	if err == nil {
+		return &category, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	category = models.Category{Name: name}
+	if err := createCategory(tx, &category); err != nil {
+		return nil, false, err
+	}
+	return &category, true, nil
+}
+
+func (s *CatalogExchangeService) Export(format string, filter ExportFilter) ([]byte, error) {
+	var books []models.Book
+	q := s.db.Preload("Category").Preload("Tags").Order("id ASC")
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		q = q.Where("title ILIKE ? OR author ILIKE ?", like, like)
+	}
+	if filter.CategoryID != nil {
+		q = q.Where(repositories.CategorySubtreeCondition, []uint{*filter.CategoryID})
+	}
+	if len(filter.IDs) > 0 {
+		q = q.Where("id IN ?", filter.IDs)
+	}
+	if err := q.Find(&books).Error; err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case CatalogFormatMARCXML, CatalogFormatISO2709:
+		records := make([]MARCRecord, 0, len(books))
+		for i := range books {
+			records = append(records, bookToMARC(&books[i]))
+		}
+		if format == CatalogFormatMARCXML {
+			return WriteMARCXML(records)
+		}
+		return WriteISO2709(records)
+	case CatalogFormatDC:
+		records := make([]DCRecord, 0, len(books))
+		for i := range books {
+			records = append(records, bookToDC(&books[i]))
+		}
+		return WriteDublinCore(records)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func marcToCatalogRecord(marc *MARCRecord) CatalogRecord {
+	record := CatalogRecord{
+		Identifier:  strings.TrimSpace(marc.Control("001")),
+		Description: strings.TrimSpace(marc.Subfield("520", "a")),
+		Language:    strings.TrimSpace(marc.Subfield("041", "a")),
+	}
+
+	title := cleanMARCValue(marc.Subfield("245", "a"))
+	if subtitle := cleanMARCValue(marc.Subfield("245", "b")); subtitle != "" {
+		title += ": " + subtitle
+	}
+	record.Title = title
+
+	for _, tag := range []string{"100", "110", "700", "710"} {
+		for _, name := range marc.Subfields(tag, "a") {
+			if name = cleanMARCValue(name); name != "" {
+				record.Authors = append(record.Authors, name)
+			}
+		}
+	}
+	for _, tag := range []string{"650", "653"} {
+		for _, subject := range marc.Subfields(tag, "a") {
+			if subject = cleanMARCValue(subject); subject != "" {
+				record.Subjects = append(record.Subjects, subject)
+			}
+		}
+	}
+	if record.Language == "" {
+		if fixed := marc.Control("008"); len(fixed) >= 38 {
+			record.Language = strings.TrimSpace(fixed[35:38])
+		}
+	}
+	for _, value := range marc.Subfields("020", "a") {
+		if isbn := catalogISBN(value); isbn != "" {
+			record.ISBN = isbn
+			break
+		}
+	}
+	record.Edition = cleanMARCValue(marc.Subfield("250", "a"))
+	for _, tag := range []string{"264", "260"} {
+		if record.Publisher == "" {
+			record.Publisher = cleanMARCValue(marc.Subfield(tag, "b"))
+		}
+		if record.Year == 0 {
+			record.Year = marcYear(marc.Subfield(tag, "c"))
+		}
+	}
+	record.Pages = leadingNumber(marc.Subfield("300", "a"))
+	return record
+}
+
+func dcToCatalogRecord(dc DCRecord) CatalogRecord {
+	record := CatalogRecord{
+		Title:    strings.TrimSpace(firstValue(dc.Titles)),
+		Language: strings.TrimSpace(firstValue(dc.Languages)),
+	}
+	record.Identifier = strings.TrimSpace(firstValue(dc.Identifiers))
+	record.Description = strings.TrimSpace(firstValue(dc.Descriptions))
+	record.Publisher = strings.TrimSpace(firstValue(dc.Publishers))
+	record.Year = parseYear(firstValue(dc.Dates))
+	for _, identifier := range dc.Identifiers {
+		lower := strings.ToLower(strings.TrimSpace(identifier))
+		if strings.HasPrefix(lower, "urn:isbn:") || strings.HasPrefix(lower, "isbn") {
+			if isbn := catalogISBN(identifier); isbn != "" {
+				record.ISBN = isbn
+				break
+			}
+		}
+	}
+	for _, name := range append(append([]string{}, dc.Creators...), dc.Contributors...) {
+		if name = strings.TrimSpace(name); name != "" {
+			record.Authors = append(record.Authors, name)
+		}
+	}
+	for _, subject := range dc.Subjects {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			record.Subjects = append(record.Subjects, subject)
+		}
+	}
+	return record
+}
+
+func bookToMARC(book *models.Book) MARCRecord {
+	record := MARCRecord{Leader: marcDefaultLeader}
+	record.AddControl("001", strconv.FormatUint(uint64(book.ID), 10))
+	record.AddControl("005", book.UpdatedAt.UTC().Format("20060102150405.0"))
+
+	authors := splitAuthors(book.Author)
+	for i, name := range authors {
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+		}
+		record.AddData(tag, "1", " ", MARCSubfield{Code: "a", Value: name})
+	}
+	if book.ISBN != "" {
+		record.AddData("020", " ", " ", MARCSubfield{Code: "a", Value: book.ISBN})
+	}
+	record.AddData("041", "0", " ", MARCSubfield{Code: "a", Value: book.Language})
+	record.AddData("245", "1", "0", MARCSubfield{Code: "a", Value: book.Title})
+	record.AddData("250", " ", " ", MARCSubfield{Code: "a", Value: book.Edition})
+	var year string
+	if book.Year != 0 {
+		year = strconv.Itoa(book.Year)
+	}
+	record.AddData("264", " ", "1", MARCSubfield{Code: "b", Value: book.Publisher}, MARCSubfield{Code: "c", Value: year})
+	if book.Pages > 0 {
+		record.AddData("300", " ", " ", MARCSubfield{Code: "a", Value: fmt.Sprintf("%d p.", book.Pages)})
+	}
+	record.AddData("520", " ", " ", MARCSubfield{Code: "a", Value: book.Description})
+	record.AddData("650", " ", "4", MARCSubfield{Code: "a", Value: book.Category.Name})
+	for _, tag := range book.Tags {
+		record.AddData("653", " ", " ", MARCSubfield{Code: "a", Value: tag.Name})
+	}
+	record.AddData("856", "4", "2", MARCSubfield{Code: "3", Value: "Portada"}, MARCSubfield{Code: "u", Value: book.CoverURL})
+	return record
+}
+
+func bookToDC(book *models.Book) DCRecord {
+	record := DCRecord{
+		Titles:      []string{book.Title},
+		Creators:    splitAuthors(book.Author),
+		Types:       []string{"Text"},
+		Identifiers: []string{fmt.Sprintf("urn:library:book:%d", book.ID)},
+	}
+	if book.Category.Name != "" {
+		record.Subjects = []string{book.Category.Name}
+	}
+	for _, tag := range book.Tags {
+		record.Subjects = append(record.Subjects, tag.Name)
+	}
+	if book.Description != "" {
+		record.Descriptions = []string{book.Description}
+	}
+	if book.ISBN != "" {
+		record.Identifiers = append(record.Identifiers, "urn:isbn:"+book.ISBN)
+	}
+	if book.Publisher != "" {
+		record.Publishers = []string{book.Publisher}
+	}
+	if book.Year != 0 {
+		record.Dates = []string{strconv.Itoa(book.Year)}
+	}
+	if book.Language != "" {
+		record.Languages = []string{book.Language}
+	}
+	return record
+}
+
+func splitAuthors(value string) []string {
+	var authors []string
+	for _, name := range strings.Split(value, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func catalogISBN(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(value), "urn:isbn:"), "isbn")
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	isbn, err := NormalizeISBN(fields[0])
+	if err != nil {
+		return ""
+	}
+	return isbn
+}
+
+func marcYear(value string) int {
+	return parseYear(strings.TrimLeft(strings.TrimSpace(value), "[©cp"))
+}
+
+func leadingNumber(value string) int {
+	digits := strings.TrimLeftFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		digits = digits[:end]
+	}
+	number, _ := strconv.Atoi(digits)
+	return number
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+func newCatalogExchange(t *testing.T) (*CatalogExchangeService, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t, &models.User{}, &models.Category{}, &models.CategorySlugRedirect{}, &models.Book{},
+		&models.Author{}, &models.AuthorVariant{}, &models.BookAuthor{}, &models.Tag{},
+		&models.Suggestion{}, &models.SuggestionVote{}, &models.OutboxEmail{})
+	mail, err := NewMailService(db, NewMemoryTransport(), &config.Config{MailFrom: "Biblioteca <no-reply@biblioteca.local>", MailLocale: "es"})
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	return NewCatalogExchangeService(db, NewAuthorService(db), NewSuggestionService(db, mail)), db
+}
+
+func catalogMARC(title string, author string, isbn string, subjects ...string) MARCRecord {
+	record := MARCRecord{Leader: marcDefaultLeader}
+	record.AddControl("001", "REC-"+title)
+	record.AddControl("008", "190301s2019    pe            000 0 spa d")
+	record.AddData("020", " ", " ", MARCSubfield{Code: "a", Value: isbn})
+	record.AddData("100", "1", " ", MARCSubfield{Code: "a", Value: author})
+	record.AddData("245", "1", "0", MARCSubfield{Code: "a", Value: title + " /"})
+	record.AddData("250", " ", " ", MARCSubfield{Code: "a", Value: "2a ed."})
+	record.AddData("264", " ", "1", MARCSubfield{Code: "b", Value: "Fondo Editorial,"}, MARCSubfield{Code: "c", Value: "c2019."})
+	record.AddData("300", " ", " ", MARCSubfield{Code: "a", Value: "xii, 320 p. :"})
+	record.AddData("520", " ", " ", MARCSubfield{Code: "a", Value: "Resumen de " + title})
+	for _, subject := range subjects {
+		record.AddData("650", " ", "0", MARCSubfield{Code: "a", Value: subject + "."})
+	}
+	return record
+}
+
+func importMARC(t *testing.T, service *CatalogExchangeService, options ImportOptions, records ...MARCRecord) *ImportReport {
+	t.Helper()
+	data, err := WriteMARCXML(records)
+	if err != nil {
+		t.Fatalf("write MARCXML: %v", err)
+	}
+	options.Format = DetectCatalogFormat(data)
+	report, err := service.Import(data, options)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return report
+}
+
+func loadBook(t *testing.T, db *gorm.DB, title string) *models.Book {
+	t.Helper()
+	var book models.Book
+	if err := db.Preload("Category").Preload("Tags").Where("title = ?", title).First(&book).Error; err != nil {
+		t.Fatalf("load book %q: %v", title, err)
+	}
+	return &book
+}
+
+func TestCatalogImportCreatesBooksFromMARCXML(t *testing.T) {
+	service, db := newCatalogExchange(t)
+
+	report := importMARC(t, service, ImportOptions{},
+		catalogMARC("Ciencia de datos", "Torres, Ana", "978-0-306-40615-7 (rustica)", "Estadistica", "Programacion"),
+		catalogMARC("Sin materia", "Quispe, Luis", ""),
+	)
+	if report.Format != CatalogFormatMARCXML || report.Total != 2 || report.Created != 2 || report.Failed != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	sort.Strings(report.CategoriesCreated)
+	if !reflect.DeepEqual(report.CategoriesCreated, []string{"Estadistica", defaultImportCategory}) {
+		t.Fatalf("unexpected categories created: %v", report.CategoriesCreated)
+	}
+	for _, item := range report.Items {
+		if item.Action != "create" || item.BookID == 0 {
+			t.Fatalf("unexpected item: %+v", item)
+		}
+	}
+
+	book := loadBook(t, db, "Ciencia de datos")
+	if book.Author != "Torres, Ana" || book.ISBN != testISBN || book.Publisher != "Fondo Editorial" || book.Year != 2019 {
+		t.Fatalf("unexpected book: %+v", book)
+	}
+	if book.Pages != 320 || book.Language != "spa" || book.Edition != "2a ed" || book.Description != "Resumen de Ciencia de datos" {
+		t.Fatalf("unexpected book: %+v", book)
+	}
+	if book.Category.Name != "Estadistica" || len(book.Tags) != 1 || book.Tags[0].Name != "Programacion" {
+		t.Fatalf("unexpected category or tags: %+v %+v", book.Category, book.Tags)
+	}
+	var credits int64
+	db.Model(&models.BookAuthor{}).Where("book_id = ?", book.ID).Count(&credits)
+	if credits != 1 {
+		t.Fatalf("expected 1 author credit, got %d", credits)
+	}
+	if other := loadBook(t, db, "Sin materia"); other.Category.Name != defaultImportCategory {
+		t.Fatalf("expected default category, got %q", other.Category.Name)
+	}
+}
+
+func TestCatalogImportDryRunWritesNothing(t *testing.T) {
+	service, db := newCatalogExchange(t)
+
+	report := importMARC(t, service, ImportOptions{DryRun: true},
+		catalogMARC("Ciencia de datos", "Torres, Ana", testISBN, "Estadistica"),
+	)
+	if !report.DryRun || report.Created != 1 || !reflect.DeepEqual(report.CategoriesCreated, []string{"Estadistica"}) {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+	for _, model := range []any{&models.Book{}, &models.Category{}, &models.Author{}, &models.Tag{}} {
+		var count int64
+		db.Model(model).Count(&count)
+		if count != 0 {
+			t.Fatalf("dry run wrote %T rows: %d", model, count)
+		}
+	}
+}
+
+func TestCatalogImportMatchesDuplicates(t *testing.T) {
+	service, db := newCatalogExchange(t)
+	importMARC(t, service, ImportOptions{},
+		catalogMARC("Ciencia de datos", "Torres, Ana", testISBN, "Estadistica"),
+		catalogMARC("Sin ISBN", "Quispe, Luis", "", "Historia"),
+	)
+	original := loadBook(t, db, "Ciencia de datos")
+
+	renamed := catalogMARC("Ciencia de datos aplicada", "Torres, Ana", testISBN, "Estadistica")
+	byTitle := catalogMARC("SIN ISBN", "QUISPE, LUIS", "", "Historia")
+	report := importMARC(t, service, ImportOptions{}, renamed, byTitle)
+	if report.Skipped != 2 || report.Created != 0 || len(report.CategoriesCreated) != 0 {
+		t.Fatalf("expected both records skipped, got %+v", report)
+	}
+	if report.Items[0].BookID != original.ID || report.Items[0].Action != "skip" {
+		t.Fatalf("expected ISBN match, got %+v", report.Items[0])
+	}
+
+	updated := catalogMARC("Ciencia de datos", "Torres, Ana; Rojas, Eva", testISBN, "Matematicas")
+	updated.DataFields = append(updated.DataFields, MARCDataField{Tag: "041", Ind1: "0", Ind2: " ", Subfields: []MARCSubfield{{Code: "a", Value: "eng"}}})
+	report = importMARC(t, service, ImportOptions{OnDuplicate: "update"}, updated)
+	if report.Updated != 1 || report.Items[0].BookID != original.ID || !reflect.DeepEqual(report.CategoriesCreated, []string{"Matematicas"}) {
+		t.Fatalf("unexpected update report: %+v", report)
+	}
+	book := loadBook(t, db, "Ciencia de datos")
+	if book.Category.Name != "Matematicas" || book.Language != "eng" {
+		t.Fatalf("book not updated: %+v", book)
+	}
+	var credits int64
+	db.Model(&models.BookAuthor{}).Where("book_id = ?", book.ID).Count(&credits)
+	if credits != 2 {
+		t.Fatalf("expected authors replaced, got %d credits", credits)
+	}
+}
+
+func TestCatalogImportReportsFailedRecords(t *testing.T) {
+	service, db := newCatalogExchange(t)
+
+	report := importMARC(t, service, ImportOptions{},
+		catalogMARC("Sin autor", "", testISBN, "Huerfana"),
+		catalogMARC("", "Torres, Ana", "", "Vacia"),
+		catalogMARC("Valido", "Torres, Ana", "", "Valida"),
+	)
+	if report.Failed != 2 || report.Created != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Items[0].Action != "error" || !strings.Contains(report.Items[0].Error, "author") || report.Items[1].Action != "error" {
+		t.Fatalf("unexpected items: %+v", report.Items)
+	}
+	if !reflect.DeepEqual(report.CategoriesCreated, []string{"Valida"}) {
+		t.Fatalf("failed records must not report categories: %v", report.CategoriesCreated)
+	}
+	var categories int64
+	db.Model(&models.Category{}).Count(&categories)
+	if categories != 1 {
+		t.Fatalf("failed records must roll back their categories, got %d", categories)
+	}
+
+	if _, err := service.Import([]byte("<collection"), ImportOptions{Format: CatalogFormatMARCXML}); err == nil {
+		t.Fatal("expected error for malformed MARCXML")
+	}
+	if _, err := service.Import([]byte("00010nam"), ImportOptions{Format: CatalogFormatISO2709}); err == nil {
+		t.Fatal("expected error for malformed ISO 2709")
+	}
+	if _, err := service.Import([]byte("{}"), ImportOptions{Format: "json"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	data, _ := WriteMARCXML([]MARCRecord{catalogMARC("Valido", "Torres, Ana", "")})
+	if _, err := service.Import(data, ImportOptions{Format: CatalogFormatMARCXML, OnDuplicate: "merge"}); err == nil {
+		t.Fatal("expected error for invalid on_duplicate")
+	}
+}
+
+func TestCatalogExportRoundTrip(t *testing.T) {
+	service, db := newCatalogExchange(t)
+	importMARC(t, service, ImportOptions{},
+		catalogMARC("Ciencia de datos", "Torres, Ana; Rojas, Eva", testISBN, "Estadistica", "Programacion"),
+	)
+	book := loadBook(t, db, "Ciencia de datos")
+
+	for _, format := range []string{CatalogFormatMARCXML, CatalogFormatISO2709, CatalogFormatDC} {
+		t.Run(format, func(t *testing.T) {
+			data, err := service.Export(format, ExportFilter{IDs: []uint{book.ID}})
+			if err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			if detected := DetectCatalogFormat(data); detected != format {
+				t.Fatalf("detected %q", detected)
+			}
+			records, err := ParseCatalogRecords(format, data)
+			if err != nil {
+				t.Fatalf("parse export: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(records))
+			}
+			record := records[0]
+			if record.Title != book.Title || !reflect.DeepEqual(record.Authors, []string{"Torres, Ana", "Rojas, Eva"}) {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+			if record.ISBN != testISBN || record.Publisher != "Fondo Editorial" || record.Year != 2019 || record.Language != "spa" {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+			if !reflect.DeepEqual(record.Subjects, []string{"Estadistica", "Programacion"}) {
+				t.Fatalf("unexpected subjects: %v", record.Subjects)
+			}
+			if format != CatalogFormatDC && (record.Pages != 320 || record.Edition != "2a ed") {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+		})
+	}
+
+	if _, err := service.Export("json", ExportFilter{}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestParseDublinCore(t *testing.T) {
+	single := `<oai_dc:dc xmlns:oai_dc="` + oaiDCNamespace + `" xmlns:dc="` + dcElementsNamespace + `">
+		<dc:title>Ciencia de datos</dc:title>
+		<dc:creator>Torres, Ana</dc:creator>
+		<dc:contributor>Rojas, Eva</dc:contributor>
+		<dc:subject>Estadistica</dc:subject>
+		<dc:identifier>urn:library:book:7</dc:identifier>
+		<dc:identifier>URN:ISBN:0-306-40615-2</dc:identifier>
+		<dc:date>2019-03-01</dc:date>
+	</oai_dc:dc>`
+	records, err := ParseCatalogRecords(CatalogFormatDC, []byte(single))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	record := records[0]
+	if record.Title != "Ciencia de datos" || !reflect.DeepEqual(record.Authors, []string{"Torres, Ana", "Rojas, Eva"}) {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if record.ISBN != testISBN || record.Year != 2019 || record.Identifier != "urn:library:book:7" {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+
+	many := `<records xmlns:dc="` + dcElementsNamespace + `">
+		<record><dc:title>Uno</dc:title></record>
+		<record><dc:description>Sin titulo ni identificador</dc:description></record>
+		<record><dc:title>Dos</dc:title></record>
+	</records>`
+	records, err = ParseCatalogRecords(CatalogFormatDC, []byte(many))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(records) != 2 || records[0].Title != "Uno" || records[1].Title != "Dos" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	if _, err := ParseCatalogRecords(CatalogFormatDC, []byte(`<records><dc:title>`)); err == nil {
+		t.Fatal("expected error for malformed Dublin Core")
+	}
+}
@@ -1,11 +1,36 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 
 	"github.com/jos3lo89/library-api/internal/models"
 )
 
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrParentNotFound   = errors.New("parent category not found")
+	ErrCategoryCycle    = errors.New("category cannot be moved under itself or its descendants")
+	ErrInvalidOrder     = errors.New("ids must list every child of the parent exactly once")
+	ErrCategoryName     = errors.New("category name required")
+	ErrCategoryNameUsed = errors.New("category name already exists")
+	ErrCategorySlugUsed = errors.New("category slug already exists")
+	ErrInvalidSlug      = errors.New("invalid slug")
+	ErrCategoryInUse    = errors.New("category has books; pass reassign_to to move them")
+	ErrCategoryHasRules = errors.New("category has access rules; pass reassign_to to move them")
+	ErrInvalidReassign  = errors.New("reassign_to must be another existing category")
+)
+
+type CategoryDeleteResult struct {
+	BooksMoved    int64 `json:"books_moved"`
+	ChildrenMoved int64 `json:"children_moved"`
+	RulesMoved    int64 `json:"rules_moved"`
+}
+
 type CategoryService struct {
 	db *gorm.DB
 }
@@ -15,7 +40,192 @@ func NewCategoryService(db *gorm.DB) *CategoryService {
 }
 
 func (s *CategoryService) Create(category *models.Category) error {
-	return s.db.Create(category).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return createCategory(tx, category)
+	})
+}
+
+func createCategory(tx *gorm.DB, category *models.Category) error {
+	category.Name = strings.Join(strings.Fields(category.Name), " ")
+	if category.Name == "" {
+		return ErrCategoryName
+	}
+	if category.ParentID != nil {
+		if err := tx.First(&models.Category{}, *category.ParentID).Error; err != nil {
+			return ErrParentNotFound
+		}
+	}
+	if err := checkCategoryName(tx, category.Name, 0); err != nil {
+		return err
+	}
+
+	slug, err := resolveCategorySlug(tx, category.Name, category.Slug, 0)
+	if err != nil {
+		return err
+	}
+	category.Slug = slug
+
+	position, err := nextCategoryPosition(tx, category.ParentID)
+	if err != nil {
+		return err
+	}
+	category.Position = position
+
+	if err := tx.Create(category).Error; err != nil {
+		return translateCategoryError(err)
+	}
+	return tx.Where("slug = ?", category.Slug).Delete(&models.CategorySlugRedirect{}).Error
+}
+
+func (s *CategoryService) Update(id uint, name *string, slug *string) (*models.Category, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			return ErrCategoryNotFound
+		}
+
+		newName := category.Name
+		if name != nil {
+			newName = strings.Join(strings.Fields(*name), " ")
+			if newName == "" {
+				return ErrCategoryName
+			}
+			if err := checkCategoryName(tx, newName, id); err != nil {
+				return err
+			}
+		}
+
+		newSlug := category.Slug
+		switch {
+		case slug != nil:
+			resolved, err := resolveCategorySlug(tx, newName, *slug, id)
+			if err != nil {
+				return err
+			}
+			newSlug = resolved
+		case newName != category.Name && Slugify(newName) != Slugify(category.Name):
+			resolved, err := resolveCategorySlug(tx, newName, "", id)
+			if err != nil {
+				return err
+			}
+			newSlug = resolved
+		}
+
+		if newSlug != category.Slug {
+			if err := tx.Where("slug = ?", newSlug).Delete(&models.CategorySlugRedirect{}).Error; err != nil {
+				return err
+			}
+			redirect := models.CategorySlugRedirect{Slug: category.Slug, CategoryID: id}
+			if err := tx.Create(&redirect).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(&category).Updates(map[string]any{"name": newName, "slug": newSlug}).Error
+		return translateCategoryError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(id)
+}
+
+func (s *CategoryService) Delete(id uint, reassignTo *uint) (*CategoryDeleteResult, error) {
+	result := &CategoryDeleteResult{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			return ErrCategoryNotFound
+		}
+
+		var books int64
+		if err := tx.Model(&models.Book{}).Where("category_id = ?", id).Count(&books).Error; err != nil {
+			return err
+		}
+
+		if reassignTo != nil {
+			if *reassignTo == id {
+				return ErrInvalidReassign
+			}
+			if err := tx.First(&models.Category{}, *reassignTo).Error; err != nil {
+				return ErrInvalidReassign
+			}
+			update := tx.Unscoped().Model(&models.Book{}).Where("category_id = ?", id).Update("category_id", *reassignTo)
+			if update.Error != nil {
+				return update.Error
+			}
+			result.BooksMoved = books
+			if err := tx.Model(&models.CategorySlugRedirect{}).Where("category_id = ?", id).Update("category_id", *reassignTo).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.CategorySlugRedirect{Slug: category.Slug, CategoryID: *reassignTo}).Error; err != nil {
+				return err
+			}
+			rules := tx.Model(&models.AccessRule{}).Where("category_id = ?", id).Update("category_id", *reassignTo)
+			if rules.Error != nil {
+				return rules.Error
+			}
+			result.RulesMoved = rules.RowsAffected
+		} else {
+			if books > 0 {
+				return ErrCategoryInUse
+			}
+			var rules int64
+			if err := tx.Model(&models.AccessRule{}).Where("category_id = ?", id).Count(&rules).Error; err != nil {
+				return err
+			}
+			if rules > 0 {
+				return ErrCategoryHasRules
+			}
+			if err := tx.Unscoped().Model(&models.Book{}).Where("category_id = ?", id).Update("category_id", nil).Error; err != nil {
+				return err
+			}
+		}
+
+		children, err := categoryChildIDs(tx, &id, 0)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			siblings, err := categoryChildIDs(tx, category.ParentID, id)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Category{}).Where("id IN ?", children).Update("parent_id", category.ParentID).Error; err != nil {
+				return err
+			}
+			if err := applyCategoryOrder(tx, append(siblings, children...)); err != nil {
+				return err
+			}
+			result.ChildrenMoved = int64(len(children))
+		}
+
+		return tx.Unscoped().Delete(&category).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *CategoryService) FindBySlug(slug string) (*models.Category, bool, error) {
+	var category models.Category
+	err := s.db.Where("slug = ?", slug).First(&category).Error
+	if err == nil {
+		return &category, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	var redirect models.CategorySlugRedirect
+	if err := s.db.Where("slug = ?", slug).First(&redirect).Error; err != nil {
+		return nil, false, ErrCategoryNotFound
+	}
+	if err := s.db.First(&category, redirect.CategoryID).Error; err != nil {
+		return nil, false, ErrCategoryNotFound
+	}
+	return &category, true, nil
 }
 
 func (s *CategoryService) List() ([]models.Category, error) {
@@ -25,3 +235,279 @@ func (s *CategoryService) List() ([]models.Category, error) {
 	}
 	return categories, nil
 }
+
+func (s *CategoryService) FindByID(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := s.db.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (s *CategoryService) Tree() ([]models.Category, error) {
+	var categories []models.Category
+	if err := s.db.Order("position ASC, name ASC").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+			continue
+		}
+		children[*category.ParentID] = append(children[*category.ParentID], category)
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	if roots == nil {
+		roots = []models.Category{}
+	}
+	return attach(roots), nil
+}
+
+func (s *CategoryService) Breadcrumb(id uint) ([]models.Category, error) {
+	ancestors, err := categoryAncestors(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ancestors) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	path := make([]models.Category, len(ancestors))
+	for i, category := range ancestors {
+		path[len(ancestors)-1-i] = category
+	}
+	return path, nil
+}
+
+func (s *CategoryService) DescendantIDs(id uint) ([]uint, error) {
+	return categorySubtreeIDs(s.db, id)
+}
+
+func (s *CategoryService) Move(id uint, parentID *uint, position *int) (*models.Category, error) {
+	var category models.Category
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, id).Error; err != nil {
+			return ErrCategoryNotFound
+		}
+
+		if parentID != nil {
+			if err := tx.First(&models.Category{}, *parentID).Error; err != nil {
+				return ErrParentNotFound
+			}
+			subtree, err := categorySubtreeIDs(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, descendant := range subtree {
+				if descendant == *parentID {
+					return ErrCategoryCycle
+				}
+			}
+		}
+
+		oldParentID := category.ParentID
+		siblings, err := categoryChildIDs(tx, parentID, id)
+		if err != nil {
+			return err
+		}
+		index := len(siblings)
+		if position != nil && *position >= 0 && *position < index {
+			index = *position
+		}
+		ordered := append(append(append([]uint{}, siblings[:index]...), id), siblings[index:]...)
+
+		if err := tx.Model(&category).Update("parent_id", parentID).Error; err != nil {
+			return err
+		}
+		category.ParentID = parentID
+		if err := applyCategoryOrder(tx, ordered); err != nil {
+			return err
+		}
+
+		if !sameParent(oldParentID, parentID) {
+			remaining, err := categoryChildIDs(tx, oldParentID, 0)
+			if err != nil {
+				return err
+			}
+			return applyCategoryOrder(tx, remaining)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(category.ID)
+}
+
+func (s *CategoryService) Reorder(parentID *uint, ids []uint) ([]models.Category, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		current, err := categoryChildIDs(tx, parentID, 0)
+		if err != nil {
+			return err
+		}
+		if len(current) != len(ids) || len(uniqueIDs(ids)) != len(ids) {
+			return ErrInvalidOrder
+		}
+		known := make(map[uint]bool, len(current))
+		for _, id := range current {
+			known[id] = true
+		}
+		for _, id := range ids {
+			if !known[id] {
+				return ErrInvalidOrder
+			}
+		}
+		return applyCategoryOrder(tx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var children []models.Category
+	q := s.db.Order("position ASC")
+	if parentID == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", *parentID)
+	}
+	if err := q.Find(&children).Error; err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+func categoryAncestors(db *gorm.DB, id uint) ([]models.Category, error) {
+	var ancestors []models.Category
+	err := db.Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT c.*, 0 AS depth FROM categories c WHERE c.id = ? AND c.deleted_at IS NULL
+			UNION ALL
+			SELECT p.*, a.depth + 1 FROM categories p JOIN ancestors a ON p.id = a.parent_id
+			WHERE p.deleted_at IS NULL AND a.depth < 64
+		)
+		SELECT id, created_at, updated_at, deleted_at, name, slug, parent_id, position
+		FROM ancestors ORDER BY depth ASC`, id).Scan(&ancestors).Error
+	return ancestors, err
+}
+
+func categorySubtreeIDs(db *gorm.DB, id uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM subtree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+func categoryChildIDs(tx *gorm.DB, parentID *uint, excludeID uint) ([]uint, error) {
+	var ids []uint
+	q := tx.Model(&models.Category{}).Where("id <> ?", excludeID).Order("position ASC, name ASC")
+	if parentID == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", *parentID)
+	}
+	err := q.Pluck("id", &ids).Error
+	return ids, err
+}
+
+func nextCategoryPosition(tx *gorm.DB, parentID *uint) (int, error) {
+	var position int
+	q := tx.Model(&models.Category{}).Select("COALESCE(MAX(position) + 1, 0)")
+	if parentID == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", *parentID)
+	}
+	err := q.Scan(&position).Error
+	return position, err
+}
+
+func applyCategoryOrder(tx *gorm.DB, ids []uint) error {
+	for position, id := range ids {
+		if err := tx.Model(&models.Category{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameParent(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func checkCategoryName(tx *gorm.DB, name string, excludeID uint) error {
+	var count int64
+	if err := tx.Model(&models.Category{}).Where("LOWER(name) = LOWER(?) AND id <> ?", name, excludeID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategoryNameUsed
+	}
+	return nil
+}
+
+func resolveCategorySlug(tx *gorm.DB, name string, requested string, excludeID uint) (string, error) {
+	if strings.TrimSpace(requested) != "" {
+		slug := Slugify(requested)
+		if slug == "" {
+			return "", ErrInvalidSlug
+		}
+		taken, err := categorySlugTaken(tx, slug, excludeID)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", ErrCategorySlugUsed
+		}
+		return slug, nil
+	}
+
+	base := Slugify(name)
+	if base == "" {
+		base = "categoria"
+	}
+	slug := base
+	for n := 2; ; n++ {
+		taken, err := categorySlugTaken(tx, slug, excludeID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func categorySlugTaken(tx *gorm.DB, slug string, excludeID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Category{}).Unscoped().Where("slug = ? AND id <> ?", slug, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+func translateCategoryError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if strings.Contains(pgErr.ConstraintName, "slug") {
+			return ErrCategorySlugUsed
+		}
+		return ErrCategoryNameUsed
+	}
+	return err
+}
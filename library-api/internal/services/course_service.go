@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+type CourseService struct {
+	db *gorm.DB
+}
+
+func NewCourseService(db *gorm.DB) *CourseService {
+	return &CourseService{db: db}
+}
+
+func (s *CourseService) Create(course *models.Course, teacherIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(course).Error; err != nil {
+			return err
+		}
+		return setCourseTeachers(tx, course, teacherIDs)
+	})
+}
+
+func (s *CourseService) SetTeachers(courseID uint, teacherIDs []uint) (*models.Course, error) {
+	var course models.Course
+	if err := s.db.First(&course, courseID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return setCourseTeachers(tx, &course, teacherIDs)
+	}); err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func setCourseTeachers(tx *gorm.DB, course *models.Course, teacherIDs []uint) error {
+	teachers := []models.User{}
+	if len(teacherIDs) > 0 {
+		if err := tx.Where("id IN ? AND role IN ?", teacherIDs, []models.Role{models.RoleTeacher, models.RoleAdmin}).Find(&teachers).Error; err != nil {
+			return err
+		}
+		if len(teachers) != len(uniqueIDs(teacherIDs)) {
+			return errors.New("teachers must be existing TEACHER or ADMIN users")
+		}
+	}
+	course.Teachers = teachers
+	return tx.Model(course).Association("Teachers").Replace(teachers)
+}
+
+func (s *CourseService) List(periodID *uint) ([]models.Course, error) {
+	var courses []models.Course
+	q := s.db.Preload("Teachers").Order("code ASC")
+	if periodID != nil {
+		q = q.Where("period_id = ?", *periodID)
+	}
+	if err := q.Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (s *CourseService) ListForTeacher(userID uint, periodID *uint) ([]models.Course, error) {
+	var courses []models.Course
+	q := s.db.Joins("JOIN course_teachers ON course_teachers.course_id = courses.id").
+		Where("course_teachers.user_id = ?", userID).
+		Preload("Reserves", reserveOrder).
+		Preload("Reserves.Book").
+		Order("courses.code ASC")
+	if periodID != nil {
+		q = q.Where("courses.period_id = ?", *periodID)
+	}
+	if err := q.Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (s *CourseService) ListForEnrollment(enrollment *models.Enrollment) ([]models.Course, error) {
+	var courses []models.Course
+	if strings.TrimSpace(enrollment.Career) == "" {
+		return courses, nil
+	}
+	q := s.db.Where("period_id = ? AND LOWER(TRIM(career)) = LOWER(TRIM(?))", enrollment.PeriodID, enrollment.Career)
+	if strings.TrimSpace(enrollment.Semester) != "" {
+		q = q.Where("(semester = '' OR LOWER(TRIM(semester)) = LOWER(TRIM(?)))", enrollment.Semester)
+	}
+	if err := q.Preload("Teachers").
+		Preload("Reserves", reserveOrder).
+		Preload("Reserves.Book").
+		Preload("Reserves.Book.Category").
+		Order("code ASC").
+		Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (s *CourseService) ListReserves(courseID uint) ([]models.CourseReserve, error) {
+	var reserves []models.CourseReserve
+	if err := reserveOrder(s.db.Where("course_id = ?", courseID)).Preload("Book").Find(&reserves).Error; err != nil {
+		return nil, err
+	}
+	return reserves, nil
+}
+
+func (s *CourseService) CanManage(courseID uint, userID uint, role string) (bool, error) {
+	if role == string(models.RoleAdmin) {
+		var count int64
+		err := s.db.Model(&models.Course{}).Where("id = ?", courseID).Count(&count).Error
+		return count > 0, err
+	}
+	var count int64
+	err := s.db.Table("course_teachers").Where("course_id = ? AND user_id = ?", courseID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *CourseService) AddReserve(reserve *models.CourseReserve) error {
+	if reserve.Kind == "" {
+		reserve.Kind = models.ReserveRequired
+	}
+	if reserve.Kind != models.ReserveRequired && reserve.Kind != models.ReserveRecommended {
+		return errors.New("kind must be REQUIRED or RECOMMENDED")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var course models.Course
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&course, reserve.CourseID).Error; err != nil {
+			return errors.New("course not found")
+		}
+		var book models.Book
+		if err := tx.First(&book, reserve.BookID).Error; err != nil {
+			return errors.New("book not found")
+		}
+		var maxPosition *int
+		if err := tx.Model(&models.CourseReserve{}).Where("course_id = ?", reserve.CourseID).Select("MAX(position)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		reserve.Position = 1
+		if maxPosition != nil {
+			reserve.Position = *maxPosition + 1
+		}
+		if err := tx.Create(reserve).Error; err != nil {
+			return err
+		}
+		reserve.Book = book
+		return nil
+	})
+}
+
+func (s *CourseService) RemoveReserve(courseID uint, bookID uint) error {
+	result := s.db.Unscoped().Where("course_id = ? AND book_id = ?", courseID, bookID).Delete(&models.CourseReserve{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("reserve not found")
+	}
+	return nil
+}
+
+func (s *CourseService) ReorderReserves(courseID uint, bookIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var course models.Course
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&course, courseID).Error; err != nil {
+			return errors.New("course not found")
+		}
+		var count int64
+		if err := tx.Model(&models.CourseReserve{}).Where("course_id = ?", courseID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(bookIDs) || len(uniqueIDs(bookIDs)) != len(bookIDs) {
+			return errors.New("book_ids must list every reserve exactly once")
+		}
+		for i, bookID := range bookIDs {
+			result := tx.Model(&models.CourseReserve{}).Where("course_id = ? AND book_id = ?", courseID, bookID).Update("position", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("book is not reserved for this course")
+			}
+		}
+		return nil
+	})
+}
+
+func reserveOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]struct{}, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
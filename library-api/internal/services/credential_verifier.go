@@ -0,0 +1,303 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+type CredentialVerifier interface {
+	Name() string
+	Verify(dni, password string) (*models.User, error)
+}
+
+func NewCredentialVerifiers(cfg *config.Config, users *repositories.UserRepository, mail *MailService) ([]CredentialVerifier, error) {
+	verifiers := make([]CredentialVerifier, 0, len(cfg.AuthVerifiers))
+	for _, name := range cfg.AuthVerifiers {
+		switch strings.ToLower(name) {
+		case "local":
+			verifiers = append(verifiers, &LocalVerifier{users: users})
+		case "ldap":
+			verifier, err := NewLDAPVerifier(cfg, users, mail)
+			if err != nil {
+				return nil, err
+			}
+			verifiers = append(verifiers, verifier)
+		default:
+			return nil, fmt.Errorf("unknown credential verifier %q", name)
+		}
+	}
+	if len(verifiers) == 0 {
+		return nil, errors.New("at least one credential verifier is required")
+	}
+	return verifiers, nil
+}
+
+type LocalVerifier struct {
+	users *repositories.UserRepository
+}
+
+func (v *LocalVerifier) Name() string {
+	return "local"
+}
+
+func (v *LocalVerifier) Verify(dni, password string) (*models.User, error) {
+	user, err := v.users.FindByDNI(dni)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.CheckPassword(password, dummyPasswordHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPassword(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+type ldapRoleGroup struct {
+	role  models.Role
+	group string
+}
+
+type LDAPVerifier struct {
+	users          *repositories.UserRepository
+	mail           *MailService
+	url            string
+	startTLS       bool
+	tlsConfig      *tls.Config
+	bindDN         string
+	bindPassword   string
+	baseDN         string
+	userFilter     string
+	nameAttribute  string
+	emailAttribute string
+	groupAttribute string
+	roleGroups     []ldapRoleGroup
+	provision      bool
+	locale         string
+	timeout        time.Duration
+}
+
+func NewLDAPVerifier(cfg *config.Config, users *repositories.UserRepository, mail *MailService) (*LDAPVerifier, error) {
+	if strings.TrimSpace(cfg.LDAPURL) == "" || strings.TrimSpace(cfg.LDAPBaseDN) == "" {
+		return nil, errors.New("LDAP_URL and LDAP_BASE_DN are required for the ldap verifier")
+	}
+	if strings.Count(cfg.LDAPUserFilter, "%s") != 1 {
+		return nil, errors.New("LDAP_USER_FILTER must contain exactly one %s")
+	}
+	roleGroups, err := parseRoleGroups(cfg.LDAPRoleGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(strings.TrimSpace(cfg.LDAPURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP_URL: %w", err)
+	}
+	startTLS := false
+	switch strings.ToLower(endpoint.Scheme) {
+	case "ldaps":
+	case "ldap":
+		startTLS = cfg.LDAPStartTLS
+		if !startTLS && !cfg.LDAPAllowCleartext {
+			return nil, errors.New("LDAP_URL uses ldap:// with LDAP_START_TLS=false; set LDAP_ALLOW_CLEARTEXT=true to send passwords unencrypted")
+		}
+	default:
+		return nil, errors.New("LDAP_URL must use ldap:// or ldaps://")
+	}
+
+	timeout := cfg.LDAPTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &LDAPVerifier{
+		users:          users,
+		mail:           mail,
+		url:            endpoint.String(),
+		startTLS:       startTLS,
+		tlsConfig:      &tls.Config{ServerName: endpoint.Hostname(), InsecureSkipVerify: cfg.LDAPInsecureSkipVerify},
+		bindDN:         cfg.LDAPBindDN,
+		bindPassword:   cfg.LDAPBindPassword,
+		baseDN:         cfg.LDAPBaseDN,
+		userFilter:     cfg.LDAPUserFilter,
+		nameAttribute:  cfg.LDAPNameAttribute,
+		emailAttribute: cfg.LDAPEmailAttribute,
+		groupAttribute: cfg.LDAPGroupAttribute,
+		roleGroups:     roleGroups,
+		provision:      cfg.LDAPProvision,
+		locale:         cfg.MailLocale,
+		timeout:        timeout,
+	}, nil
+}
+
+func (v *LDAPVerifier) Name() string {
+	return "ldap"
+}
+
+func (v *LDAPVerifier) Verify(dni, password string) (*models.User, error) {
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := ldap.DialURL(v.url, ldap.DialWithDialer(&net.Dialer{Timeout: v.timeout}), ldap.DialWithTLSConfig(v.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(v.timeout)
+
+	if v.startTLS {
+		if err := conn.StartTLS(v.tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	if v.bindDN != "" {
+		if err := conn.Bind(v.bindDN, v.bindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		v.baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(v.timeout.Seconds()), false,
+		fmt.Sprintf(v.userFilter, ldap.EscapeFilter(dni)),
+		[]string{"dn", v.nameAttribute, v.emailAttribute, v.groupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return v.syncUser(dni, entry)
+}
+
+func (v *LDAPVerifier) syncUser(dni string, entry *ldap.Entry) (*models.User, error) {
+	role, mapped := v.mapRole(entry.GetAttributeValues(v.groupAttribute))
+
+	var user *models.User
+	err := v.users.Transaction(func(tx *gorm.DB) error {
+		repo := v.users.WithTx(tx)
+		existing, err := repo.FindByDNI(dni)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !v.provision {
+				return ErrInvalidCredentials
+			}
+			user, err = v.provisionUser(tx, dni, role, entry)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if existing.AuthSource != models.AuthSourceLDAP {
+			return ErrInvalidCredentials
+		}
+		user = existing
+		if mapped && user.Role != role {
+			user.Role = role
+			return tx.Model(user).Update("role", role).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (v *LDAPVerifier) provisionUser(tx *gorm.DB, dni string, role models.Role, entry *ldap.Entry) (*models.User, error) {
+	password, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := strings.TrimSpace(entry.GetAttributeValue(v.nameAttribute))
+	if fullName == "" {
+		fullName = dni
+	}
+	user := &models.User{
+		DNI:          dni,
+		FullName:     fullName,
+		Email:        strings.TrimSpace(entry.GetAttributeValue(v.emailAttribute)),
+		Locale:       v.locale,
+		PasswordHash: hashed,
+		Role:         role,
+		IsActive:     true,
+		AuthSource:   models.AuthSourceLDAP,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return nil, err
+	}
+	if user.Email == "" {
+		return user, nil
+	}
+	return user, v.mail.Enqueue(tx, user.Email, "welcome", user.Locale, user)
+}
+
+func (v *LDAPVerifier) mapRole(groups []string) (models.Role, bool) {
+	for _, candidate := range []models.Role{models.RoleAdmin, models.RoleTeacher, models.RoleStudent} {
+		for _, mapping := range v.roleGroups {
+			if mapping.role != candidate {
+				continue
+			}
+			for _, group := range groups {
+				if strings.EqualFold(strings.TrimSpace(group), mapping.group) {
+					return candidate, true
+				}
+			}
+		}
+	}
+	return models.RoleStudent, len(v.roleGroups) > 0
+}
+
+func parseRoleGroups(value string) ([]ldapRoleGroup, error) {
+	var mappings []ldapRoleGroup
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, group, found := strings.Cut(item, "=")
+		role := models.Role(strings.ToUpper(strings.TrimSpace(name)))
+		if !found || strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("invalid LDAP_ROLE_GROUPS entry %q", item)
+		}
+		switch role {
+		case models.RoleAdmin, models.RoleTeacher, models.RoleStudent:
+		default:
+			return nil, fmt.Errorf("unknown role %q in LDAP_ROLE_GROUPS", name)
+		}
+		mappings = append(mappings, ldapRoleGroup{role: role, group: strings.TrimSpace(group)})
+	}
+	return mappings, nil
+}
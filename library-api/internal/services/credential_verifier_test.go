@@ -0,0 +1,475 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jimlambrt/gldap"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+)
+
+const (
+	testLDAPBindDN   = "cn=biblioteca,ou=services,dc=test"
+	testLDAPBindPass = "service-secret"
+	testLDAPBaseDN   = "ou=people,dc=test"
+	testLDAPAdmins   = "cn=bib-admins,ou=groups,dc=test"
+	testLDAPTeachers = "cn=docentes,ou=groups,dc=test"
+)
+
+type ldapTestEntry struct {
+	dn         string
+	uid        string
+	password   string
+	attributes map[string][]string
+}
+
+type ldapTestServer struct {
+	addr       string
+	tlsConfig  *tls.Config
+	rootCAs    *x509.CertPool
+	mu         sync.Mutex
+	entries    []ldapTestEntry
+	filters    []string
+	secured    map[int]bool
+	requireTLS bool
+}
+
+func startLDAPTestServer(t *testing.T, entries ...ldapTestEntry) *ldapTestServer {
+	t.Helper()
+	serverTLS, rootCAs := newTestTLSConfig(t)
+	s := &ldapTestServer{tlsConfig: serverTLS, rootCAs: rootCAs, entries: entries, secured: map[int]bool{}}
+
+	mux, err := gldap.NewMux()
+	if err != nil {
+		t.Fatalf("ldap mux: %v", err)
+	}
+	if err := mux.Bind(s.bind); err != nil {
+		t.Fatalf("ldap bind route: %v", err)
+	}
+	if err := mux.Search(s.search); err != nil {
+		t.Fatalf("ldap search route: %v", err)
+	}
+	if err := mux.ExtendedOperation(s.startTLS, gldap.ExtendedOperationStartTLS); err != nil {
+		t.Fatalf("ldap starttls route: %v", err)
+	}
+
+	server, err := gldap.NewServer()
+	if err != nil {
+		t.Fatalf("ldap server: %v", err)
+	}
+	if err := server.Router(mux); err != nil {
+		t.Fatalf("ldap router: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	s.addr = listener.Addr().String()
+	listener.Close()
+
+	go server.Run(s.addr)
+	t.Cleanup(func() { server.Stop() })
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("ldap server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s
+}
+
+func (s *ldapTestServer) bind(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewBindResponse(gldap.WithResponseCode(gldap.ResultInvalidCredentials))
+	defer w.Write(resp)
+
+	message, err := r.GetSimpleBindMessage()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.requireTLS && !s.secured[r.ConnectionID()] {
+		resp.SetResultCode(gldap.ResultConfidentialityRequired)
+		return
+	}
+	if message.UserName == testLDAPBindDN && string(message.Password) == testLDAPBindPass {
+		resp.SetResultCode(gldap.ResultSuccess)
+		return
+	}
+	for _, entry := range s.entries {
+		if entry.dn == message.UserName && entry.password != "" && string(message.Password) == entry.password {
+			resp.SetResultCode(gldap.ResultSuccess)
+			return
+		}
+	}
+}
+
+func (s *ldapTestServer) search(w *gldap.ResponseWriter, r *gldap.Request) {
+	done := r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+	defer w.Write(done)
+
+	message, err := r.GetSearchMessage()
+	if err != nil {
+		done.SetResultCode(gldap.ResultOperationsError)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, message.Filter)
+	if message.BaseDN != testLDAPBaseDN {
+		done.SetResultCode(gldap.ResultNoSuchObject)
+		return
+	}
+	for _, entry := range s.entries {
+		if message.Filter != "(uid="+entry.uid+")" {
+			continue
+		}
+		result := r.NewSearchResponseEntry(entry.dn)
+		for name, values := range entry.attributes {
+			result.AddAttribute(name, values)
+		}
+		w.Write(result)
+	}
+}
+
+func (s *ldapTestServer) startTLS(w *gldap.ResponseWriter, r *gldap.Request) {
+	resp := r.NewExtendedResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+	resp.SetResponseName(gldap.ExtendedOperationStartTLS)
+	if err := w.Write(resp); err != nil {
+		return
+	}
+	if err := r.StartTLS(s.tlsConfig); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.secured[r.ConnectionID()] = true
+	s.mu.Unlock()
+}
+
+func (s *ldapTestServer) receivedFilters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+func newTestTLSConfig(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate tls key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+type ldapFixture struct {
+	server *ldapTestServer
+	users  *repositories.UserRepository
+	cfg    *config.Config
+	mail   *MailService
+}
+
+func newLDAPFixture(t *testing.T, entries ...ldapTestEntry) *ldapFixture {
+	t.Helper()
+	server := startLDAPTestServer(t, entries...)
+	db := newTestDB(t, &models.User{}, &models.OutboxEmail{})
+	cfg := &config.Config{
+		LDAPURL:            "ldap://" + server.addr,
+		LDAPStartTLS:       true,
+		LDAPBindDN:         testLDAPBindDN,
+		LDAPBindPassword:   testLDAPBindPass,
+		LDAPBaseDN:         testLDAPBaseDN,
+		LDAPUserFilter:     "(uid=%s)",
+		LDAPNameAttribute:  "cn",
+		LDAPEmailAttribute: "mail",
+		LDAPGroupAttribute: "memberOf",
+		LDAPRoleGroups:     "ADMIN=" + testLDAPAdmins + ";TEACHER=" + testLDAPTeachers,
+		LDAPProvision:      true,
+		LDAPTimeout:        2 * time.Second,
+		MailFrom:           "Biblioteca <no-reply@biblioteca.local>",
+		MailLocale:         "es",
+	}
+	mail, err := NewMailService(db, NewMemoryTransport(), cfg)
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	return &ldapFixture{server: server, users: repositories.NewUserRepository(db), cfg: cfg, mail: mail}
+}
+
+func (f *ldapFixture) verifier(t *testing.T) *LDAPVerifier {
+	t.Helper()
+	verifier, err := NewLDAPVerifier(f.cfg, f.users, f.mail)
+	if err != nil {
+		t.Fatalf("ldap verifier: %v", err)
+	}
+	verifier.tlsConfig.RootCAs = f.server.rootCAs
+	return verifier
+}
+
+func ldapPerson(uid string, groups ...string) ldapTestEntry {
+	return ldapTestEntry{
+		dn:       "uid=" + uid + "," + testLDAPBaseDN,
+		uid:      uid,
+		password: "pw-" + uid,
+		attributes: map[string][]string{
+			"cn":       {"Persona " + uid},
+			"mail":     {uid + "@universidad.edu.pe"},
+			"memberOf": groups,
+		},
+	}
+}
+
+func TestLDAPVerifierBindProvisionsUser(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("12345678", testLDAPTeachers))
+	f.server.requireTLS = true
+
+	user, err := f.verifier(t).Verify("12345678", "pw-12345678")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if user.ID == 0 || user.FullName != "Persona 12345678" || user.Email != "12345678@universidad.edu.pe" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if user.Role != models.RoleTeacher || user.AuthSource != models.AuthSourceLDAP {
+		t.Fatalf("unexpected role or source: %s %s", user.Role, user.AuthSource)
+	}
+
+	again, err := f.verifier(t).Verify("12345678", "pw-12345678")
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("second login: %+v, %v", again, err)
+	}
+}
+
+func TestLDAPVerifierRejectsBadCredentials(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("12345678"))
+	verifier := f.verifier(t)
+
+	for name, attempt := range map[string][2]string{
+		"wrong password": {"12345678", "wrong"},
+		"empty password": {"12345678", ""},
+		"unknown dni":    {"87654321", "pw-87654321"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := verifier.Verify(attempt[0], attempt[1]); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLDAPVerifierServiceBindFailure(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("12345678"))
+	f.cfg.LDAPBindPassword = "wrong"
+
+	_, err := f.verifier(t).Verify("12345678", "pw-12345678")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+}
+
+func TestLDAPVerifierEscapesFilter(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("12345678"), ldapPerson("*"))
+	verifier := f.verifier(t)
+
+	for _, dni := range []string{"*", "*)(uid=*", "1234567*"} {
+		if _, err := verifier.Verify(dni, "pw-12345678"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("dni %q: expected ErrInvalidCredentials, got %v", dni, err)
+		}
+	}
+
+	want := []string{`(uid=\2a)`, `(uid=\2a\29\28uid=\2a)`, `(uid=1234567\2a)`}
+	got := f.server.receivedFilters()
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("unexpected filters:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestLDAPVerifierRejectsAmbiguousSearch(t *testing.T) {
+	first := ldapPerson("11111111")
+	second := ldapPerson("11111111")
+	second.dn = "uid=11111111,ou=alumni," + testLDAPBaseDN
+	f := newLDAPFixture(t, first, second)
+
+	if _, err := f.verifier(t).Verify("11111111", "pw-11111111"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestLDAPVerifierMapsGroupsToRoles(t *testing.T) {
+	cases := []struct {
+		uid    string
+		groups []string
+		role   models.Role
+	}{
+		{"10000001", []string{testLDAPAdmins}, models.RoleAdmin},
+		{"10000002", []string{testLDAPTeachers, strings.ToUpper(testLDAPAdmins)}, models.RoleAdmin},
+		{"10000003", []string{testLDAPTeachers}, models.RoleTeacher},
+		{"10000004", []string{"cn=otros,ou=groups,dc=test"}, models.RoleStudent},
+		{"10000005", nil, models.RoleStudent},
+	}
+	entries := make([]ldapTestEntry, 0, len(cases))
+	for _, tc := range cases {
+		entries = append(entries, ldapPerson(tc.uid, tc.groups...))
+	}
+	f := newLDAPFixture(t, entries...)
+	verifier := f.verifier(t)
+
+	for _, tc := range cases {
+		user, err := verifier.Verify(tc.uid, "pw-"+tc.uid)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.uid, err)
+		}
+		if user.Role != tc.role {
+			t.Fatalf("%s: expected %s, got %s", tc.uid, tc.role, user.Role)
+		}
+	}
+}
+
+func TestLDAPVerifierUpdatesExistingUsers(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("20000001", testLDAPAdmins))
+	ldapUser := &models.User{DNI: "20000001", FullName: "LDAP", PasswordHash: "x", Role: models.RoleStudent, AuthSource: models.AuthSourceLDAP}
+	if err := f.users.Create(ldapUser); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	updated, err := f.verifier(t).Verify("20000001", "pw-20000001")
+	if err != nil {
+		t.Fatalf("verify ldap user: %v", err)
+	}
+	if updated.ID != ldapUser.ID || updated.Role != models.RoleAdmin {
+		t.Fatalf("expected ldap user promoted to ADMIN, got %+v", updated)
+	}
+	stored, err := f.users.FindByID(ldapUser.ID)
+	if err != nil || stored.Role != models.RoleAdmin {
+		t.Fatalf("role not persisted: %+v, %v", stored, err)
+	}
+}
+
+func TestLDAPVerifierRejectsAccountsFromOtherSources(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("20000002"), ldapPerson("20000003", testLDAPAdmins), ldapPerson("20000004"))
+	accounts := []*models.User{
+		{DNI: "20000002", FullName: "Local admin", PasswordHash: "x", Role: models.RoleAdmin, AuthSource: models.AuthSourceLocal},
+		{DNI: "20000003", FullName: "Local", PasswordHash: "x", Role: models.RoleStudent, AuthSource: models.AuthSourceLocal},
+		{DNI: "20000004", FullName: "OIDC", PasswordHash: "x", Role: models.RoleStudent, AuthSource: models.AuthSourceOIDC},
+	}
+	for _, user := range accounts {
+		if err := f.users.Create(user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	verifier := f.verifier(t)
+
+	for _, user := range accounts {
+		if _, err := verifier.Verify(user.DNI, "pw-"+user.DNI); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s account %s: expected ErrInvalidCredentials, got %v", user.AuthSource, user.DNI, err)
+		}
+		stored, err := f.users.FindByID(user.ID)
+		if err != nil || stored.Role != user.Role || stored.AuthSource != user.AuthSource {
+			t.Fatalf("account must not change: %+v, %v", stored, err)
+		}
+	}
+}
+
+func TestLDAPVerifierWithoutProvisioning(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("30000001"))
+	f.cfg.LDAPProvision = false
+
+	if _, err := f.verifier(t).Verify("30000001", "pw-30000001"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := f.users.FindByDNI("30000001"); err == nil {
+		t.Fatal("user must not be created")
+	}
+}
+
+func TestLDAPVerifierCleartextBind(t *testing.T) {
+	f := newLDAPFixture(t, ldapPerson("40000001"))
+	f.cfg.LDAPStartTLS = false
+	f.cfg.LDAPAllowCleartext = true
+
+	if _, err := f.verifier(t).Verify("40000001", "pw-40000001"); err != nil {
+		t.Fatalf("verify over cleartext: %v", err)
+	}
+
+	f.server.requireTLS = true
+	if _, err := f.verifier(t).Verify("40000001", "pw-40000001"); err == nil {
+		t.Fatal("expected the server to refuse a cleartext bind")
+	}
+}
+
+func TestNewLDAPVerifierTransportSecurity(t *testing.T) {
+	cases := []struct {
+		url       string
+		startTLS  bool
+		cleartext bool
+		ok        bool
+		useTLS    bool
+	}{
+		{url: "ldaps://ldap.test:636", ok: true},
+		{url: "ldap://ldap.test:389", startTLS: true, ok: true, useTLS: true},
+		{url: "ldap://ldap.test:389", ok: false},
+		{url: "ldap://ldap.test:389", cleartext: true, ok: true},
+		{url: "http://ldap.test", startTLS: true, ok: false},
+	}
+	for i, tc := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			cfg := &config.Config{
+				LDAPURL:            tc.url,
+				LDAPStartTLS:       tc.startTLS,
+				LDAPAllowCleartext: tc.cleartext,
+				LDAPBaseDN:         testLDAPBaseDN,
+				LDAPUserFilter:     "(uid=%s)",
+			}
+			verifier, err := NewLDAPVerifier(cfg, nil, nil)
+			if (err == nil) != tc.ok {
+				t.Fatalf("%s: expected ok=%v, got %v", tc.url, tc.ok, err)
+			}
+			if err != nil {
+				return
+			}
+			if verifier.startTLS != tc.useTLS {
+				t.Fatalf("%s: expected startTLS=%v", tc.url, tc.useTLS)
+			}
+			if verifier.tlsConfig.ServerName != "ldap.test" {
+				t.Fatalf("%s: unexpected server name %q", tc.url, verifier.tlsConfig.ServerName)
+			}
+		})
+	}
+}
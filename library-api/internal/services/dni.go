@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidDNI = errors.New("invalid dni format")
+
+type DNIFormat struct {
+	pattern *regexp.Regexp
+}
+
+func NewDNIFormat(pattern string) (*DNIFormat, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNI_PATTERN: %w", err)
+	}
+	return &DNIFormat{pattern: compiled}, nil
+}
+
+func (f *DNIFormat) Normalize(dni string) (string, error) {
+	dni = strings.ToUpper(strings.TrimSpace(dni))
+	if dni == "" || len(dni) > 20 || !f.pattern.MatchString(dni) {
+		return "", ErrInvalidDNI
+	}
+	return dni, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	dcElementsNamespace = "http://purl.org/dc/elements/1.1/"
+	oaiDCNamespace      = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+)
+
+type DCRecord struct {
+	Titles       []string `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Creators     []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Contributors []string `xml:"http://purl.org/dc/elements/1.1/ contributor"`
+	Subjects     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Descriptions []string `xml:"http://purl.org/dc/elements/1.1/ description"`
+	Publishers   []string `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+	Dates        []string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Types        []string `xml:"http://purl.org/dc/elements/1.1/ type"`
+	Formats      []string `xml:"http://purl.org/dc/elements/1.1/ format"`
+	Identifiers  []string `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+	Languages    []string `xml:"http://purl.org/dc/elements/1.1/ language"`
+	Relations    []string `xml:"http://purl.org/dc/elements/1.1/ relation"`
+}
+
+type dcDocument struct {
+	Records []DCRecord `xml:",any"`
+}
+
+type dcOutputRecord struct {
+	XMLName      xml.Name `xml:"oai_dc:dc"`
+	Titles       []string `xml:"dc:title"`
+	Creators     []string `xml:"dc:creator"`
+	Contributors []string `xml:"dc:contributor"`
+	Subjects     []string `xml:"dc:subject"`
+	Descriptions []string `xml:"dc:description"`
+	Publishers   []string `xml:"dc:publisher"`
+	Dates        []string `xml:"dc:date"`
+	Types        []string `xml:"dc:type"`
+	Formats      []string `xml:"dc:format"`
+	Identifiers  []string `xml:"dc:identifier"`
+	Languages    []string `xml:"dc:language"`
+	Relations    []string `xml:"dc:relation"`
+}
+
+type dcOutputDocument struct {
+	XMLName xml.Name         `xml:"records"`
+	XmlnsDC string           `xml:"xmlns:dc,attr"`
+	XmlnsOA string           `xml:"xmlns:oai_dc,attr"`
+	Records []dcOutputRecord `xml:"oai_dc:dc"`
+}
+
+func ParseDublinCore(data []byte) ([]DCRecord, error) {
+	var single DCRecord
+	if err := xml.Unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("invalid Dublin Core XML: %w", err)
+	}
+	if len(single.Titles) > 0 {
+		return []DCRecord{single}, nil
+	}
+
+	var document dcDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid Dublin Core XML: %w", err)
+	}
+	records := make([]DCRecord, 0, len(document.Records))
+	for _, record := range document.Records {
+		if len(record.Titles) > 0 || len(record.Identifiers) > 0 {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func WriteDublinCore(records []DCRecord) ([]byte, error) {
+	document := dcOutputDocument{XmlnsDC: dcElementsNamespace, XmlnsOA: oaiDCNamespace}
+	for _, record := range records {
+		document.Records = append(document.Records, dcOutputRecord{
+			Titles:       record.Titles,
+			Creators:     record.Creators,
+			Contributors: record.Contributors,
+			Subjects:     record.Subjects,
+			Descriptions: record.Descriptions,
+			Publishers:   record.Publishers,
+			Dates:        record.Dates,
+			Types:        record.Types,
+			Formats:      record.Formats,
+			Identifiers:  record.Identifiers,
+			Languages:    record.Languages,
+			Relations:    record.Relations,
+		})
+	}
+	payload, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), payload...), nil
+}
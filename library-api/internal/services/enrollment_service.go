@@ -1,19 +1,62 @@
 package services
 
 import (
+	"bytes"
+	"encoding/csv"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/jos3lo89/library-api/internal/models"
 )
 
+var (
+	ErrPeriodNotFound  = errors.New("period not found")
+	ErrInvalidRoster   = errors.New("roster must be a csv with at least dni and full_name columns")
+	ErrRosterDuplicate = errors.New("dni appears more than once in the file")
+)
+
+type EnrollmentImportItem struct {
+	Line         int    `json:"line"`
+	DNI          string `json:"dni"`
+	Action       string `json:"action"`
+	EnrollmentID uint   `json:"enrollment_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type EnrollmentImportReport struct {
+	PeriodID uint                   `json:"period_id"`
+	DryRun   bool                   `json:"dry_run"`
+	Total    int                    `json:"total"`
+	Enrolled int                    `json:"enrolled"`
+	Pending  int                    `json:"pending"`
+	Skipped  int                    `json:"skipped"`
+	Failed   int                    `json:"failed"`
+	Items    []EnrollmentImportItem `json:"items"`
+}
+
+type rosterRow struct {
+	line     int
+	raw      string
+	dni      string
+	fullName string
+	email    string
+	career   string
+	semester string
+}
+
 type EnrollmentService struct {
-	db *gorm.DB
+	db  *gorm.DB
+	dni *DNIFormat
 }
 
-func NewEnrollmentService(db *gorm.DB) *EnrollmentService {
-	return &EnrollmentService{db: db}
+func NewEnrollmentService(db *gorm.DB, dni *DNIFormat) *EnrollmentService {
+	return &EnrollmentService{db: db, dni: dni}
 }
 
 func (s *EnrollmentService) Create(enrollment *models.Enrollment) error {
@@ -39,3 +82,261 @@ func (s *EnrollmentService) List() ([]models.Enrollment, error) {
 	}
 	return enrollments, nil
 }
+
+func (s *EnrollmentService) ListPending(periodID *uint) ([]models.PendingEnrollment, error) {
+	query := s.db.Where("claimed_at IS NULL")
+	if periodID != nil {
+		query = query.Where("period_id = ?", *periodID)
+	}
+	var pending []models.PendingEnrollment
+	if err := query.Order("period_id DESC, dni ASC").Find(&pending).Error; err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+func (s *EnrollmentService) Import(periodID uint, data []byte, dryRun bool) (*EnrollmentImportReport, error) {
+	rows, err := s.parseRoster(data)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &EnrollmentImportReport{
+		PeriodID: periodID,
+		DryRun:   dryRun,
+		Total:    len(rows),
+		Items:    make([]EnrollmentImportItem, 0, len(rows)),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var period models.AcademicPeriod
+		if err := tx.First(&period, periodID).Error; err != nil {
+			return ErrPeriodNotFound
+		}
+
+		seen := map[string]bool{}
+		for i, row := range rows {
+			item := EnrollmentImportItem{Line: row.line, DNI: row.dni}
+			if row.dni == "" {
+				item.DNI = row.raw
+				item.Action = "error"
+				item.Error = ErrInvalidDNI.Error()
+				report.Failed++
+				report.Items = append(report.Items, item)
+				continue
+			}
+			if seen[row.dni] {
+				item.Action = "error"
+				item.Error = ErrRosterDuplicate.Error()
+				report.Failed++
+				report.Items = append(report.Items, item)
+				continue
+			}
+			seen[row.dni] = true
+
+			savepoint := fmt.Sprintf("roster_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			if err := s.importRow(tx, periodID, row, &item); err != nil {
+				if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+					return rollbackErr
+				}
+				item.Action = "error"
+				item.Error = err.Error()
+			}
+
+			switch item.Action {
+			case "enrolled":
+				report.Enrolled++
+			case "pending":
+				report.Pending++
+			case "skipped":
+				report.Skipped++
+			default:
+				report.Failed++
+			}
+			report.Items = append(report.Items, item)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *EnrollmentService) ClaimPending(tx *gorm.DB, user *models.User) (int, error) {
+	var pending []models.PendingEnrollment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("dni = ? AND claimed_at IS NULL", user.DNI).
+		Where("period_id IN (?)", tx.Model(&models.AcademicPeriod{}).Select("id").Where("end_date > ?", time.Now())).
+		Find(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, entry := range pending {
+		displayName := entry.FullName
+		if displayName == "" {
+			displayName = user.FullName
+		}
+		enrollment := &models.Enrollment{
+			UserID:      user.ID,
+			PeriodID:    entry.PeriodID,
+			DisplayName: displayName,
+			Career:      entry.Career,
+			Semester:    entry.Semester,
+			CanAccess:   true,
+			IsActive:    true,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(enrollment).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.PendingEnrollment{}).Where("id = ?", entry.ID).Updates(map[string]any{
+			"claimed_at": now,
+			"user_id":    user.ID,
+		}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+func (s *EnrollmentService) FindPendingByDNI(dni string) ([]models.PendingEnrollment, error) {
+	var pending []models.PendingEnrollment
+	err := s.db.Where("dni = ? AND claimed_at IS NULL", dni).
+		Where("period_id IN (?)", s.db.Model(&models.AcademicPeriod{}).Select("id").Where("end_date > ?", time.Now())).
+		Order("period_id DESC").
+		Find(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+func (s *EnrollmentService) importRow(tx *gorm.DB, periodID uint, row rosterRow, item *EnrollmentImportItem) error {
+	var user models.User
+	err := tx.Where("dni = ?", row.dni).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pending := models.PendingEnrollment{
+			PeriodID: periodID,
+			DNI:      row.dni,
+			FullName: row.fullName,
+			Email:    row.email,
+			Career:   row.career,
+			Semester: row.semester,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "period_id"}, {Name: "dni"}},
+			DoUpdates: clause.AssignmentColumns([]string{"full_name", "email", "career", "semester", "updated_at"}),
+			Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "pending_enrollments.claimed_at IS NULL"}}},
+		}).Create(&pending).Error; err != nil {
+			return err
+		}
+		item.Action = "pending"
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing models.Enrollment
+	err = tx.Where("user_id = ? AND period_id = ?", user.ID, periodID).First(&existing).Error
+	if err == nil {
+		item.Action = "skipped"
+		item.EnrollmentID = existing.ID
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	displayName := row.fullName
+	if displayName == "" {
+		displayName = user.FullName
+	}
+	enrollment := &models.Enrollment{
+		UserID:      user.ID,
+		PeriodID:    periodID,
+		DisplayName: displayName,
+		Career:      row.career,
+		Semester:    row.semester,
+		CanAccess:   true,
+		IsActive:    true,
+	}
+	if err := tx.Create(enrollment).Error; err != nil {
+		return err
+	}
+	item.Action = "enrolled"
+	item.EnrollmentID = enrollment.ID
+	return nil
+}
+
+func (s *EnrollmentService) parseRoster(data []byte) ([]rosterRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	names, err := reader.Read()
+	if err != nil {
+		return nil, ErrInvalidRoster
+	}
+	columns := map[string]int{}
+	for i, name := range names {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["dni"]; !ok {
+		return nil, ErrInvalidRoster
+	}
+	if _, ok := columns["full_name"]; !ok {
+		return nil, ErrInvalidRoster
+	}
+
+	field := func(record []string, name string) string {
+		index, ok := columns[name]
+		if !ok || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	var rows []rosterRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRoster, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		raw := field(record, "dni")
+		dni, err := s.dni.Normalize(raw)
+		if err != nil {
+			dni = ""
+		}
+		rows = append(rows, rosterRow{
+			line:     line,
+			raw:      raw,
+			dni:      dni,
+			fullName: field(record, "full_name"),
+			email:    strings.ToLower(field(record, "email")),
+			career:   field(record, "career"),
+			semester: field(record, "semester"),
+		})
+	}
+	return rows, nil
+}
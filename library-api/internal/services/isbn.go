@@ -0,0 +1,64 @@
+package services
+
+import "strings"
+
+func NormalizeISBN(raw string) (string, error) {
+	isbn := cleanISBN(raw)
+	switch len(isbn) {
+	case 10:
+		if !validISBN10(isbn) {
+			return "", ErrInvalidISBN
+		}
+		body := "978" + isbn[:9]
+		return body + isbn13CheckDigit(body), nil
+	case 13:
+		if strings.ContainsRune(isbn, 'X') || (!strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979")) {
+			return "", ErrInvalidISBN
+		}
+		if isbn13CheckDigit(isbn[:12]) != isbn[12:] {
+			return "", ErrInvalidISBN
+		}
+		return isbn, nil
+	default:
+		return "", ErrInvalidISBN
+	}
+}
+
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i, r := range isbn {
+		var digit int
+		switch {
+		case r >= '0' && r <= '9':
+			digit = int(r - '0')
+		case r == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += digit * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func isbn13CheckDigit(body string) string {
+	sum := 0
+	for i, r := range body {
+		digit := int(r - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return string(rune('0' + (10-sum%10)%10))
+}
+
+func cleanISBN(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(raw) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const maxThrottleSubject = 64
+
+var (
+	ErrTooManyAttempts = errors.New("too many login attempts")
+	ErrLockNotFound    = errors.New("lock not found")
+	ErrInvalidScope    = errors.New("scope must be DNI or IP")
+)
+
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+type AuthAuditFilter struct {
+	Event   models.AuthAuditEvent
+	Scope   models.ThrottleScope
+	Subject string
+	Offset  int
+	Limit   int
+}
+
+type throttleKey struct {
+	scope   models.ThrottleScope
+	subject string
+	limit   int
+}
+
+type LoginGuard struct {
+	db            *gorm.DB
+	maxFailures   int
+	ipMaxFailures int
+	window        time.Duration
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	lockout       time.Duration
+}
+
+func NewLoginGuard(db *gorm.DB, cfg *config.Config) *LoginGuard {
+	guard := &LoginGuard{
+		db:            db,
+		maxFailures:   cfg.LoginMaxFailures,
+		ipMaxFailures: cfg.LoginIPMaxFailures,
+		window:        cfg.LoginFailureWindow,
+		baseDelay:     cfg.LoginBaseDelay,
+		maxDelay:      cfg.LoginMaxDelay,
+		lockout:       cfg.LoginLockout,
+	}
+	if guard.maxFailures <= 0 {
+		guard.maxFailures = 5
+	}
+	if guard.ipMaxFailures <= 0 {
+		guard.ipMaxFailures = 30
+	}
+	if guard.window <= 0 {
+		guard.window = 15 * time.Minute
+	}
+	if guard.maxDelay < guard.baseDelay {
+		guard.maxDelay = guard.baseDelay
+	}
+	if guard.lockout <= 0 {
+		guard.lockout = 15 * time.Minute
+	}
+	return guard
+}
+
+func ValidThrottleScope(scope models.ThrottleScope) bool {
+	return scope == models.ThrottleScopeDNI || scope == models.ThrottleScopeIP
+}
+
+func (g *LoginGuard) Check(dni, ip string) error {
+	keys := g.keys(dni, ip)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var blocked []models.LoginThrottle
+	if err := g.db.Where(keysCondition(g.db, keys)).Where("blocked_until > ?", now).Find(&blocked).Error; err != nil {
+		return err
+	}
+
+	var wait time.Duration
+	for _, throttle := range blocked {
+		if remaining := throttle.BlockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (g *LoginGuard) RecordFailure(dni, ip string) error {
+	for _, key := range g.keys(dni, ip) {
+		err := g.db.Transaction(func(tx *gorm.DB) error {
+			return g.recordFailure(tx, key, ip)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *LoginGuard) RecordSuccess(dni string) error {
+	dni = strings.TrimSpace(dni)
+	if dni == "" || len(dni) > maxThrottleSubject {
+		return nil
+	}
+	return g.db.Where("scope = ? AND subject = ?", models.ThrottleScopeDNI, dni).Delete(&models.LoginThrottle{}).Error
+}
+
+func (g *LoginGuard) ListLocks(lockedOnly bool) ([]models.LoginThrottle, error) {
+	q := g.db.Where("blocked_until > ?", time.Now())
+	if lockedOnly {
+		q = q.Where("locked = ?", true)
+	}
+	var items []models.LoginThrottle
+	if err := q.Order("blocked_until DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (g *LoginGuard) Unlock(scope models.ThrottleScope, subject string, actorID uint) error {
+	if !ValidThrottleScope(scope) {
+		return ErrInvalidScope
+	}
+	subject = strings.TrimSpace(subject)
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var throttle models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND subject = ?", scope, subject).
+			First(&throttle).Error
+		if err != nil {
+			return ErrLockNotFound
+		}
+		if err := tx.Delete(&throttle).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AuthAuditLog{
+			Event:    models.AuthEventUnlock,
+			Scope:    scope,
+			Subject:  subject,
+			Failures: throttle.Failures,
+			ActorID:  &actorID,
+		}).Error
+	})
+}
+
+func (g *LoginGuard) ListAudit(filter AuthAuditFilter) ([]models.AuthAuditLog, int64, error) {
+	q := g.db.Model(&models.AuthAuditLog{})
+	if filter.Event != "" {
+		q = q.Where("event = ?", filter.Event)
+	}
+	if filter.Scope != "" {
+		q = q.Where("scope = ?", filter.Scope)
+	}
+	if subject := strings.TrimSpace(filter.Subject); subject != "" {
+		q = q.Where("subject = ?", subject)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []models.AuthAuditLog
+	if err := q.Order("created_at DESC").Order("id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (g *LoginGuard) recordFailure(tx *gorm.DB, key throttleKey, ip string) error {
+	now := time.Now()
+	throttle := models.LoginThrottle{Scope: key.scope, Subject: key.subject}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("scope = ? AND subject = ?", key.scope, key.subject).
+		First(&throttle).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	expired := throttle.Locked && !throttle.BlockedUntil.After(now)
+	if expired || now.Sub(throttle.LastFailureAt) > g.window {
+		throttle.Failures = 0
+		throttle.Locked = false
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	throttle.BlockedUntil = now.Add(g.delay(throttle.Failures))
+
+	if throttle.Failures >= key.limit && !throttle.Locked {
+		throttle.Locked = true
+		throttle.BlockedUntil = now.Add(g.lockout)
+		until := throttle.BlockedUntil
+		if err := tx.Create(&models.AuthAuditLog{
+			Event:    models.AuthEventLockout,
+			Scope:    key.scope,
+			Subject:  key.subject,
+			IP:       ip,
+			Failures: throttle.Failures,
+			Until:    &until,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&throttle).Error
+}
+
+func (g *LoginGuard) delay(failures int) time.Duration {
+	delay := g.baseDelay
+	for i := 1; i < failures && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		delay = g.maxDelay
+	}
+	return delay
+}
+
+func (g *LoginGuard) keys(dni, ip string) []throttleKey {
+	var keys []throttleKey
+	if dni = strings.TrimSpace(dni); dni != "" && len(dni) <= maxThrottleSubject {
+		keys = append(keys, throttleKey{scope: models.ThrottleScopeDNI, subject: dni, limit: g.maxFailures})
+	}
+	if ip = strings.TrimSpace(ip); ip != "" && len(ip) <= maxThrottleSubject {
+		keys = append(keys, throttleKey{scope: models.ThrottleScopeIP, subject: ip, limit: g.ipMaxFailures})
+	}
+	return keys
+}
+
+func keysCondition(db *gorm.DB, keys []throttleKey) *gorm.DB {
+	cond := db.Where("scope = ? AND subject = ?", keys[0].scope, keys[0].subject)
+	for _, key := range keys[1:] {
+		cond = cond.Or("scope = ? AND subject = ?", key.scope, key.subject)
+	}
+	return cond
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const testGuardIP = "203.0.113.7"
+
+func newTestLoginGuard(t *testing.T) (*LoginGuard, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t, &models.LoginThrottle{}, &models.AuthAuditLog{})
+	return NewLoginGuard(db, &config.Config{
+		LoginMaxFailures:   3,
+		LoginIPMaxFailures: 5,
+		LoginFailureWindow: 15 * time.Minute,
+		LoginBaseDelay:     time.Second,
+		LoginMaxDelay:      4 * time.Second,
+		LoginLockout:       15 * time.Minute,
+	}), db
+}
+
+func loadThrottle(t *testing.T, db *gorm.DB, scope models.ThrottleScope, subject string) *models.LoginThrottle {
+	t.Helper()
+	var throttle models.LoginThrottle
+	if err := db.Where("scope = ? AND subject = ?", scope, subject).First(&throttle).Error; err != nil {
+		t.Fatalf("load %s throttle for %s: %v", scope, subject, err)
+	}
+	return &throttle
+}
+
+func recordFailures(t *testing.T, guard *LoginGuard, dni string, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := guard.RecordFailure(dni, ip); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+}
+
+func expectThrottled(t *testing.T, err error, min time.Duration, max time.Duration) {
+	t.Helper()
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected LoginThrottledError, got %v", err)
+	}
+	if throttled.RetryAfter <= min || throttled.RetryAfter > max {
+		t.Fatalf("retry after %s, expected between %s and %s", throttled.RetryAfter, min, max)
+	}
+}
+
+func TestLoginGuardDelayBacksOffToMax(t *testing.T) {
+	guard, _ := newTestLoginGuard(t)
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, want := range expected {
+		if got := guard.delay(i + 1); got != want {
+			t.Fatalf("delay after %d failures: got %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestLoginGuardProgressiveDelay(t *testing.T) {
+	guard, db := newTestLoginGuard(t)
+	if err := guard.Check("12345678", testGuardIP); err != nil {
+		t.Fatalf("fresh subject must pass: %v", err)
+	}
+
+	recordFailures(t, guard, "12345678", testGuardIP, 1)
+	expectThrottled(t, guard.Check("12345678", ""), 0, time.Second)
+	expectThrottled(t, guard.Check("", testGuardIP), 0, time.Second)
+	if err := guard.Check("87654321", "198.51.100.1"); err != nil {
+		t.Fatalf("other subjects must not be throttled: %v", err)
+	}
+
+	recordFailures(t, guard, "12345678", testGuardIP, 1)
+	expectThrottled(t, guard.Check("12345678", testGuardIP), time.Second, 2*time.Second)
+	throttle := loadThrottle(t, db, models.ThrottleScopeDNI, "12345678")
+	if throttle.Failures != 2 || throttle.Locked {
+		t.Fatalf("unexpected throttle: %+v", throttle)
+	}
+
+	db.Model(&models.LoginThrottle{}).Where("1 = 1").Update("blocked_until", time.Now().Add(-time.Second))
+	if err := guard.Check("12345678", testGuardIP); err != nil {
+		t.Fatalf("expired delay must pass: %v", err)
+	}
+}
+
+func TestLoginGuardLocksOutAndAudits(t *testing.T) {
+	guard, db := newTestLoginGuard(t)
+
+	recordFailures(t, guard, "12345678", testGuardIP, 3)
+	expectThrottled(t, guard.Check("12345678", "198.51.100.1"), 14*time.Minute, 15*time.Minute)
+	throttle := loadThrottle(t, db, models.ThrottleScopeDNI, "12345678")
+	if !throttle.Locked || throttle.Failures != 3 {
+		t.Fatalf("expected lockout, got %+v", throttle)
+	}
+	if ip := loadThrottle(t, db, models.ThrottleScopeIP, testGuardIP); ip.Locked {
+		t.Fatalf("ip must not be locked yet: %+v", ip)
+	}
+
+	var audit []models.AuthAuditLog
+	db.Find(&audit)
+	if len(audit) != 1 || audit[0].Event != models.AuthEventLockout || audit[0].Subject != "12345678" || audit[0].IP != testGuardIP || audit[0].Until == nil {
+		t.Fatalf("unexpected audit log: %+v", audit)
+	}
+
+	recordFailures(t, guard, "12345678", testGuardIP, 1)
+	var lockouts int64
+	db.Model(&models.AuthAuditLog{}).Where("event = ?", models.AuthEventLockout).Count(&lockouts)
+	if lockouts != 1 {
+		t.Fatalf("locked subject must not be audited again, got %d lockouts", lockouts)
+	}
+
+	locks, err := guard.ListLocks(true)
+	if err != nil || len(locks) != 1 || locks[0].Subject != "12345678" {
+		t.Fatalf("unexpected locks: %+v, %v", locks, err)
+	}
+}
+
+func TestLoginGuardLocksOutIPAcrossAccounts(t *testing.T) {
+	guard, db := newTestLoginGuard(t)
+	for _, dni := range []string{"10000001", "10000002", "10000003", "10000004", "10000005"} {
+		recordFailures(t, guard, dni, testGuardIP, 1)
+	}
+	if ip := loadThrottle(t, db, models.ThrottleScopeIP, testGuardIP); !ip.Locked || ip.Failures != 5 {
+		t.Fatalf("expected ip lockout, got %+v", ip)
+	}
+	expectThrottled(t, guard.Check("10000009", testGuardIP), 14*time.Minute, 15*time.Minute)
+}
+
+func TestLoginGuardResetsCounters(t *testing.T) {
+	guard, db := newTestLoginGuard(t)
+
+	recordFailures(t, guard, "12345678", testGuardIP, 2)
+	db.Model(&models.LoginThrottle{}).Where("scope = ?", models.ThrottleScopeDNI).
+		Update("last_failure_at", time.Now().Add(-16*time.Minute))
+	recordFailures(t, guard, "12345678", testGuardIP, 1)
+	if throttle := loadThrottle(t, db, models.ThrottleScopeDNI, "12345678"); throttle.Failures != 1 {
+		t.Fatalf("failures outside the window must reset, got %+v", throttle)
+	}
+
+	recordFailures(t, guard, "12345678", testGuardIP, 2)
+	db.Model(&models.LoginThrottle{}).Where("scope = ?", models.ThrottleScopeDNI).
+		Update("blocked_until", time.Now().Add(-time.Second))
+	recordFailures(t, guard, "12345678", testGuardIP, 1)
+	if throttle := loadThrottle(t, db, models.ThrottleScopeDNI, "12345678"); throttle.Failures != 1 || throttle.Locked {
+		t.Fatalf("expired lockout must reset, got %+v", throttle)
+	}
+
+	if err := guard.RecordSuccess("12345678"); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+	var dniRows int64
+	db.Model(&models.LoginThrottle{}).Where("scope = ?", models.ThrottleScopeDNI).Count(&dniRows)
+	if dniRows != 0 {
+		t.Fatal("success must clear the dni throttle")
+	}
+	if ip := loadThrottle(t, db, models.ThrottleScopeIP, testGuardIP); ip.Failures != 6 {
+		t.Fatalf("success must not clear the ip throttle, got %+v", ip)
+	}
+}
+
+func TestLoginGuardIgnoresOversizedSubjects(t *testing.T) {
+	guard, db := newTestLoginGuard(t)
+	long := strings.Repeat("9", maxThrottleSubject+1)
+	recordFailures(t, guard, long, "", 5)
+	if err := guard.Check(long, ""); err != nil {
+		t.Fatalf("oversized subject: %v", err)
+	}
+	var rows int64
+	db.Model(&models.LoginThrottle{}).Count(&rows)
+	if rows != 0 {
+		t.Fatalf("expected no throttle rows, got %d", rows)
+	}
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	guard, _ := newTestLoginGuard(t)
+	recordFailures(t, guard, "12345678", testGuardIP, 3)
+
+	if err := guard.Unlock("USER", "12345678", 1); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope, got %v", err)
+	}
+	if err := guard.Unlock(models.ThrottleScopeDNI, "00000000", 1); !errors.Is(err, ErrLockNotFound) {
+		t.Fatalf("expected ErrLockNotFound, got %v", err)
+	}
+	if err := guard.Unlock(models.ThrottleScopeDNI, " 12345678 ", 42); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := guard.Check("12345678", ""); err != nil {
+		t.Fatalf("unlocked subject must pass: %v", err)
+	}
+
+	items, total, err := guard.ListAudit(AuthAuditFilter{Event: models.AuthEventUnlock, Limit: 10})
+	if err != nil || total != 1 || items[0].ActorID == nil || *items[0].ActorID != 42 || items[0].Failures != 3 {
+		t.Fatalf("unexpected unlock audit: %+v, %d, %v", items, total, err)
+	}
+	if _, total, _ := guard.ListAudit(AuthAuditFilter{Subject: "12345678", Limit: 10}); total != 2 {
+		t.Fatalf("expected lockout and unlock for subject, got %d", total)
+	}
+}
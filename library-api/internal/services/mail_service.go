@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const (
+	mailBatchSize = 20
+	mailLease     = 5 * time.Minute
+)
+
+var ErrInvalidRecipient = errors.New("invalid mail recipient")
+
+type MailService struct {
+	db            *gorm.DB
+	transport     MailTransport
+	templates     map[string]map[string]*mailTemplate
+	from          string
+	defaultLocale string
+	interval      time.Duration
+	maxAttempts   int
+}
+
+func NewMailService(db *gorm.DB, transport MailTransport, cfg *config.Config) (*MailService, error) {
+	templates, err := parseMailTemplates()
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(cfg.MailFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+	maxAttempts := cfg.MailMaxRetries
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	interval := cfg.MailInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &MailService{
+		db:            db,
+		transport:     transport,
+		templates:     templates,
+		from:          from.String(),
+		defaultLocale: cfg.MailLocale,
+		interval:      interval,
+		maxAttempts:   maxAttempts,
+	}, nil
+}
+
+func (s *MailService) Enqueue(tx *gorm.DB, to string, templateName string, locale string, data any) error {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return errors.New("mail recipient required")
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return ErrInvalidRecipient
+	}
+	address, err := mail.ParseAddress(to)
+	if err != nil {
+		return ErrInvalidRecipient
+	}
+	to = address.Address
+	locale = s.resolveLocale(templateName, locale)
+	tpl, ok := s.templates[templateName][locale]
+	if !ok {
+		return fmt.Errorf("unknown mail template %q", templateName)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tpl.subject.Execute(&subject, data); err != nil {
+		return err
+	}
+	if err := tpl.text.Execute(&text, data); err != nil {
+		return err
+	}
+	if tpl.html != nil {
+		if err := tpl.html.Execute(&html, data); err != nil {
+			return err
+		}
+	}
+
+	if tx == nil {
+		tx = s.db
+	}
+	return tx.Create(&models.OutboxEmail{
+		Recipient:     to,
+		Template:      templateName,
+		Locale:        locale,
+		Subject:       subject.String(),
+		TextBody:      text.String(),
+		HTMLBody:      html.String(),
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+func (s *MailService) resolveLocale(templateName string, locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if _, ok := s.templates[templateName][locale]; ok {
+		return locale
+	}
+	if _, ok := s.templates[templateName][s.defaultLocale]; ok {
+		return s.defaultLocale
+	}
+	return "es"
+}
+
+func (s *MailService) RunDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.DispatchPending(); err != nil {
+			log.Printf("mail dispatcher: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *MailService) DispatchPending() (int, error) {
+	batch, err := s.claimBatch()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range batch {
+		email := &batch[i]
+		sendErr := s.transport.Send(MailMessage{
+			From:     s.from,
+			To:       email.Recipient,
+			Subject:  email.Subject,
+			TextBody: email.TextBody,
+			HTMLBody: email.HTMLBody,
+		})
+
+		updates := map[string]any{}
+		if sendErr == nil {
+			updates["status"] = models.OutboxSent
+			updates["sent_at"] = time.Now()
+			updates["last_error"] = ""
+			sent++
+		} else {
+			updates["last_error"] = sendErr.Error()
+			if email.Attempts >= s.maxAttempts {
+				updates["status"] = models.OutboxFailed
+			} else {
+				updates["status"] = models.OutboxPending
+				updates["next_attempt_at"] = time.Now().Add(mailBackoff(email.Attempts))
+			}
+		}
+		if err := s.db.Model(&models.OutboxEmail{}).
+			Where("id = ? AND status = ?", email.ID, models.OutboxSending).
+			Updates(updates).Error; err != nil {
+			log.Printf("mail dispatcher: recording result of email %d: %v", email.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+func (s *MailService) claimBatch() ([]models.OutboxEmail, error) {
+	var batch []models.OutboxEmail
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var due []models.OutboxEmail
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []models.OutboxStatus{models.OutboxPending, models.OutboxSending}, now).
+			Order("next_attempt_at ASC").
+			Limit(mailBatchSize).
+			Find(&due).Error; err != nil {
+			return err
+		}
+
+		var claimed, exhausted []uint
+		for _, email := range due {
+			if email.Attempts >= s.maxAttempts {
+				exhausted = append(exhausted, email.ID)
+				continue
+			}
+			email.Attempts++
+			claimed = append(claimed, email.ID)
+			batch = append(batch, email)
+		}
+
+		if len(exhausted) > 0 {
+			if err := tx.Model(&models.OutboxEmail{}).Where("id IN ?", exhausted).Updates(map[string]any{
+				"status":     models.OutboxFailed,
+				"last_error": "delivery did not finish before the lease expired",
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if len(claimed) == 0 {
+			return nil
+		}
+		return tx.Model(&models.OutboxEmail{}).Where("id IN ?", claimed).Updates(map[string]any{
+			"status":          models.OutboxSending,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(mailLease),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func mailBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		attempts = 10
+	}
+	return time.Duration(1<<attempts) * 30 * time.Second
+}
+
+func (s *MailService) ListOutbox(status string) ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+	q := s.db.Order("created_at DESC").Limit(100)
+	if status != "" {
+		q = q.Where("status = ?", strings.ToUpper(status))
+	}
+	if err := q.Find(&emails).Error; err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+func (s *MailService) Retry(id uint) error {
+	result := s.db.Model(&models.OutboxEmail{}).
+		Where("id = ? AND status = ?", id, models.OutboxFailed).
+		Updates(map[string]any{"status": models.OutboxPending, "attempts": 0, "next_attempt_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("failed email not found")
+	}
+	return nil
+}
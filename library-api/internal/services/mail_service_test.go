@@ -0,0 +1,266 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+type flakyTransport struct {
+	*MemoryTransport
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (t *flakyTransport) Send(message MailMessage) error {
+	t.mu.Lock()
+	t.calls++
+	if t.failures > 0 {
+		t.failures--
+		t.mu.Unlock()
+		return errors.New("smtp: 451 try again later")
+	}
+	t.mu.Unlock()
+	return t.MemoryTransport.Send(message)
+}
+
+func (t *flakyTransport) Calls() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.calls
+}
+
+type mailFixture struct {
+	db        *gorm.DB
+	transport *flakyTransport
+	service   *MailService
+}
+
+func newMailFixture(t *testing.T, failures int, maxAttempts int) *mailFixture {
+	t.Helper()
+	db := newTestDB(t, &models.OutboxEmail{})
+	transport := &flakyTransport{MemoryTransport: NewMemoryTransport(), failures: failures}
+	service, err := NewMailService(db, transport, &config.Config{
+		MailFrom:       "Biblioteca <no-reply@biblioteca.local>",
+		MailLocale:     "es",
+		MailMaxRetries: maxAttempts,
+	})
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	return &mailFixture{db: db, transport: transport, service: service}
+}
+
+func (f *mailFixture) enqueue(t *testing.T, to string) *models.OutboxEmail {
+	t.Helper()
+	user := &models.User{FullName: "Ana Torres", DNI: "12345678"}
+	if err := f.service.Enqueue(nil, to, "welcome", "es", user); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	var email models.OutboxEmail
+	if err := f.db.Order("id DESC").First(&email).Error; err != nil {
+		t.Fatalf("load outbox: %v", err)
+	}
+	return &email
+}
+
+func (f *mailFixture) dispatch(t *testing.T) int {
+	t.Helper()
+	sent, err := f.service.DispatchPending()
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	return sent
+}
+
+func (f *mailFixture) reload(t *testing.T, email *models.OutboxEmail) *models.OutboxEmail {
+	t.Helper()
+	var stored models.OutboxEmail
+	if err := f.db.First(&stored, email.ID).Error; err != nil {
+		t.Fatalf("reload outbox: %v", err)
+	}
+	return &stored
+}
+
+func (f *mailFixture) makeDue(t *testing.T, email *models.OutboxEmail) {
+	t.Helper()
+	if err := f.db.Model(&models.OutboxEmail{}).Where("id = ?", email.ID).
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("make due: %v", err)
+	}
+}
+
+func TestMailDispatchSendsPendingEmail(t *testing.T) {
+	f := newMailFixture(t, 0, 3)
+	email := f.enqueue(t, "Ana Torres <Ana@Universidad.edu.pe>")
+	if email.Recipient != "Ana@Universidad.edu.pe" || email.Status != models.OutboxPending {
+		t.Fatalf("unexpected outbox row: %+v", email)
+	}
+
+	if sent := f.dispatch(t); sent != 1 {
+		t.Fatalf("expected 1 sent, got %d", sent)
+	}
+	stored := f.reload(t, email)
+	if stored.Status != models.OutboxSent || stored.Attempts != 1 || stored.SentAt == nil || stored.LastError != "" {
+		t.Fatalf("unexpected outbox row after send: %+v", stored)
+	}
+	messages := f.transport.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	message := messages[0]
+	if message.To != "Ana@Universidad.edu.pe" || message.From != `"Biblioteca" <no-reply@biblioteca.local>` {
+		t.Fatalf("unexpected addresses: %+v", message)
+	}
+	if !strings.Contains(message.Subject, "Ana Torres") || !strings.Contains(message.TextBody, "12345678") || message.HTMLBody == "" {
+		t.Fatalf("template not rendered: %+v", message)
+	}
+
+	if sent := f.dispatch(t); sent != 0 || f.transport.Calls() != 1 {
+		t.Fatalf("sent email dispatched again: sent=%d calls=%d", sent, f.transport.Calls())
+	}
+}
+
+func TestMailEnqueueRejectsInvalidRecipients(t *testing.T) {
+	f := newMailFixture(t, 0, 3)
+	for _, to := range []string{"not-an-address", "ana@universidad.edu.pe\r\nBcc: otro@example.com", "a@b.pe, c@d.pe"} {
+		if err := f.service.Enqueue(nil, to, "welcome", "es", &models.User{}); !errors.Is(err, ErrInvalidRecipient) {
+			t.Fatalf("%q: expected ErrInvalidRecipient, got %v", to, err)
+		}
+	}
+	if err := f.service.Enqueue(nil, "ana@universidad.edu.pe", "missing", "es", &models.User{}); err == nil {
+		t.Fatal("expected error for unknown template")
+	}
+	var count int64
+	f.db.Model(&models.OutboxEmail{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected empty outbox, got %d rows", count)
+	}
+}
+
+func TestMailDispatchRetriesWithBackoff(t *testing.T) {
+	f := newMailFixture(t, 1, 3)
+	email := f.enqueue(t, "ana@universidad.edu.pe")
+
+	before := time.Now()
+	if sent := f.dispatch(t); sent != 0 {
+		t.Fatalf("expected 0 sent, got %d", sent)
+	}
+	stored := f.reload(t, email)
+	if stored.Status != models.OutboxPending || stored.Attempts != 1 || !strings.Contains(stored.LastError, "451") {
+		t.Fatalf("unexpected outbox row after failure: %+v", stored)
+	}
+	if wait := stored.NextAttemptAt.Sub(before); wait < mailBackoff(1) || wait > mailBackoff(1)+time.Minute {
+		t.Fatalf("unexpected backoff %s", wait)
+	}
+
+	if sent := f.dispatch(t); sent != 0 || f.transport.Calls() != 1 {
+		t.Fatalf("email retried before backoff: sent=%d calls=%d", sent, f.transport.Calls())
+	}
+
+	f.makeDue(t, email)
+	if sent := f.dispatch(t); sent != 1 {
+		t.Fatalf("expected retry to send, got %d", sent)
+	}
+	stored = f.reload(t, email)
+	if stored.Status != models.OutboxSent || stored.Attempts != 2 || stored.LastError != "" {
+		t.Fatalf("unexpected outbox row after retry: %+v", stored)
+	}
+}
+
+func TestMailDispatchFailsAfterMaxAttempts(t *testing.T) {
+	f := newMailFixture(t, 10, 2)
+	email := f.enqueue(t, "ana@universidad.edu.pe")
+
+	f.dispatch(t)
+	f.makeDue(t, email)
+	f.dispatch(t)
+
+	stored := f.reload(t, email)
+	if stored.Status != models.OutboxFailed || stored.Attempts != 2 {
+		t.Fatalf("expected FAILED after 2 attempts, got %+v", stored)
+	}
+	f.makeDue(t, email)
+	f.dispatch(t)
+	if f.transport.Calls() != 2 {
+		t.Fatalf("failed email dispatched again: calls=%d", f.transport.Calls())
+	}
+
+	if err := f.service.Retry(email.ID); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	f.transport.failures = 0
+	if sent := f.dispatch(t); sent != 1 {
+		t.Fatalf("expected manual retry to send, got %d", sent)
+	}
+	if stored := f.reload(t, email); stored.Status != models.OutboxSent || stored.Attempts != 1 {
+		t.Fatalf("unexpected outbox row after manual retry: %+v", stored)
+	}
+	if err := f.service.Retry(email.ID); err == nil {
+		t.Fatal("expected error retrying a sent email")
+	}
+}
+
+func TestMailDispatchHonoursLease(t *testing.T) {
+	f := newMailFixture(t, 0, 2)
+	leased := f.enqueue(t, "leased@universidad.edu.pe")
+	expired := f.enqueue(t, "expired@universidad.edu.pe")
+	exhausted := f.enqueue(t, "exhausted@universidad.edu.pe")
+
+	now := time.Now()
+	rows := map[*models.OutboxEmail]map[string]any{
+		leased:    {"status": models.OutboxSending, "attempts": 1, "next_attempt_at": now.Add(mailLease)},
+		expired:   {"status": models.OutboxSending, "attempts": 1, "next_attempt_at": now.Add(-time.Second)},
+		exhausted: {"status": models.OutboxSending, "attempts": 2, "next_attempt_at": now.Add(-time.Second)},
+	}
+	for email, updates := range rows {
+		if err := f.db.Model(&models.OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+			t.Fatalf("prepare outbox: %v", err)
+		}
+	}
+
+	if sent := f.dispatch(t); sent != 1 {
+		t.Fatalf("expected only the expired lease to be sent, got %d", sent)
+	}
+	messages := f.transport.Messages()
+	if len(messages) != 1 || messages[0].To != "expired@universidad.edu.pe" {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+	if stored := f.reload(t, leased); stored.Status != models.OutboxSending || stored.Attempts != 1 {
+		t.Fatalf("active lease must be left alone: %+v", stored)
+	}
+	if stored := f.reload(t, expired); stored.Status != models.OutboxSent || stored.Attempts != 2 {
+		t.Fatalf("unexpected expired lease row: %+v", stored)
+	}
+	if stored := f.reload(t, exhausted); stored.Status != models.OutboxFailed || stored.Attempts != 2 || stored.LastError == "" {
+		t.Fatalf("exhausted lease must fail without sending: %+v", stored)
+	}
+}
+
+func TestMailDispatchCountsClaimBeforeSending(t *testing.T) {
+	f := newMailFixture(t, 0, 3)
+	email := f.enqueue(t, "ana@universidad.edu.pe")
+
+	batch, err := f.service.claimBatch()
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if len(batch) != 1 || batch[0].Attempts != 1 {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+	stored := f.reload(t, email)
+	if stored.Status != models.OutboxSending || stored.Attempts != 1 || !stored.NextAttemptAt.After(time.Now().Add(mailLease-time.Minute)) {
+		t.Fatalf("claim not recorded: %+v", stored)
+	}
+	if again, err := f.service.claimBatch(); err != nil || len(again) != 0 {
+		t.Fatalf("leased row claimed twice: %+v, %v", again, err)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	htmltemplate "html/template"
+	"text/template"
+)
+
+type mailTemplateSource struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type mailTemplate struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+var mailTemplateSources = map[string]map[string]mailTemplateSource{
+	"welcome": {
+		"es": {
+			Subject: "Bienvenido a la biblioteca digital, {{.FullName}}",
+			Text:    "Hola {{.FullName}},\n\nTu cuenta con DNI {{.DNI}} ha sido creada correctamente.\n\nBiblioteca digital",
+			HTML:    "<p>Hola {{.FullName}},</p><p>Tu cuenta con DNI <strong>{{.DNI}}</strong> ha sido creada correctamente.</p><p>Biblioteca digital</p>",
+		},
+		"en": {
+			Subject: "Welcome to the digital library, {{.FullName}}",
+			Text:    "Hello {{.FullName}},\n\nYour account with DNI {{.DNI}} has been created.\n\nDigital library",
+			HTML:    "<p>Hello {{.FullName}},</p><p>Your account with DNI <strong>{{.DNI}}</strong> has been created.</p><p>Digital library</p>",
+		},
+	},
+	"password_reset": {
+		"es": {
+			Subject: "Restablece tu contrasena",
+			Text:    "Hola {{.FullName}},\n\nRecibimos una solicitud para restablecer tu contrasena. Abre este enlace dentro de los proximos {{.Minutes}} minutos:\n\n{{.Link}}\n\nSi no lo solicitaste, ignora este correo.\n\nBiblioteca digital",
+			HTML:    "<p>Hola {{.FullName}},</p><p>Recibimos una solicitud para restablecer tu contrasena. Abre este enlace dentro de los proximos {{.Minutes}} minutos:</p><p><a href=\"{{.Link}}\">Restablecer contrasena</a></p><p>Si no lo solicitaste, ignora este correo.</p><p>Biblioteca digital</p>",
+		},
+		"en": {
+			Subject: "Reset your password",
+			Text:    "Hello {{.FullName}},\n\nWe received a request to reset your password. Open this link within the next {{.Minutes}} minutes:\n\n{{.Link}}\n\nIf you did not request it, ignore this email.\n\nDigital library",
+			HTML:    "<p>Hello {{.FullName}},</p><p>We received a request to reset your password. Open this link within the next {{.Minutes}} minutes:</p><p><a href=\"{{.Link}}\">Reset password</a></p><p>If you did not request it, ignore this email.</p><p>Digital library</p>",
+		},
+	},
+	"registration_code": {
+		"es": {
+			Subject: "Tu codigo de verificacion: {{.Code}}",
+			Text:    "Hola {{.FullName}},\n\nUsa este codigo para confirmar el registro de tu cuenta con DNI {{.DNI}}. Vence en {{.Minutes}} minutos:\n\n{{.Code}}\n\nSi no solicitaste una cuenta, ignora este correo.\n\nBiblioteca digital",
+			HTML:    "<p>Hola {{.FullName}},</p><p>Usa este codigo para confirmar el registro de tu cuenta con DNI <strong>{{.DNI}}</strong>. Vence en {{.Minutes}} minutos:</p><p style=\"font-size:24px;letter-spacing:4px\"><strong>{{.Code}}</strong></p><p>Si no solicitaste una cuenta, ignora este correo.</p><p>Biblioteca digital</p>",
+		},
+		"en": {
+			Subject: "Your verification code: {{.Code}}",
+			Text:    "Hello {{.FullName}},\n\nUse this code to confirm the registration of your account with DNI {{.DNI}}. It expires in {{.Minutes}} minutes:\n\n{{.Code}}\n\nIf you did not request an account, ignore this email.\n\nDigital library",
+			HTML:    "<p>Hello {{.FullName}},</p><p>Use this code to confirm the registration of your account with DNI <strong>{{.DNI}}</strong>. It expires in {{.Minutes}} minutes:</p><p style=\"font-size:24px;letter-spacing:4px\"><strong>{{.Code}}</strong></p><p>If you did not request an account, ignore this email.</p><p>Digital library</p>",
+		},
+	},
+	"suggestion_available": {
+		"es": {
+			Subject: "Ya esta disponible: {{.Title}}",
+			Text:    "Hola {{.FullName}},\n\nEl libro que sugeriste o apoyaste, \"{{.Title}}\", ya esta disponible en la biblioteca.{{if .BookID}} Puedes encontrarlo con el codigo {{.BookID}}.{{end}}\n\nBiblioteca digital",
+			HTML:    "<p>Hola {{.FullName}},</p><p>El libro que sugeriste o apoyaste, <strong>{{.Title}}</strong>, ya esta disponible en la biblioteca.{{if .BookID}} Puedes encontrarlo con el codigo {{.BookID}}.{{end}}</p><p>Biblioteca digital</p>",
+		},
+		"en": {
+			Subject: "Now available: {{.Title}}",
+			Text:    "Hello {{.FullName}},\n\nThe book you suggested or supported, \"{{.Title}}\", is now available in the library.{{if .BookID}} You can find it with code {{.BookID}}.{{end}}\n\nDigital library",
+			HTML:    "<p>Hello {{.FullName}},</p><p>The book you suggested or supported, <strong>{{.Title}}</strong>, is now available in the library.{{if .BookID}} You can find it with code {{.BookID}}.{{end}}</p><p>Digital library</p>",
+		},
+	},
+}
+
+func parseMailTemplates() (map[string]map[string]*mailTemplate, error) {
+	parsed := make(map[string]map[string]*mailTemplate, len(mailTemplateSources))
+	for name, locales := range mailTemplateSources {
+		parsed[name] = make(map[string]*mailTemplate, len(locales))
+		for locale, source := range locales {
+			id := name + "." + locale
+			subject, err := template.New(id + ".subject").Parse(source.Subject)
+			if err != nil {
+				return nil, err
+			}
+			text, err := template.New(id + ".text").Parse(source.Text)
+			if err != nil {
+				return nil, err
+			}
+			tpl := &mailTemplate{subject: subject, text: text}
+			if source.HTML != "" {
+				html, err := htmltemplate.New(id + ".html").Parse(source.HTML)
+				if err != nil {
+					return nil, err
+				}
+				tpl.html = html
+			}
+			parsed[name][locale] = tpl
+		}
+	}
+	return parsed, nil
+}
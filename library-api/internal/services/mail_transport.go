@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jos3lo89/library-api/config"
+)
+
+type MailMessage struct {
+	From     string
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+type MailTransport interface {
+	Send(message MailMessage) error
+}
+
+func NewMailTransport(cfg *config.Config) (MailTransport, error) {
+	switch strings.ToLower(cfg.MailTransport) {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, errors.New("SMTP_HOST is required for smtp transport")
+		}
+		timeout := cfg.SMTPTimeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		return &SMTPTransport{host: cfg.SMTPHost, port: cfg.SMTPPort, user: cfg.SMTPUser, password: cfg.SMTPPassword, timeout: timeout}, nil
+	case "file", "":
+		if err := os.MkdirAll(cfg.MailFileDir, 0o755); err != nil {
+			return nil, err
+		}
+		return &FileTransport{dir: cfg.MailFileDir}, nil
+	case "memory":
+		return NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.MailTransport)
+	}
+}
+
+type SMTPTransport struct {
+	host     string
+	port     string
+	user     string
+	password string
+	timeout  time.Duration
+}
+
+func (t *SMTPTransport) Send(message MailMessage) error {
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(t.host, t.port), t.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+			return err
+		}
+	}
+	if t.user != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.user, t.password, t.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+	body, err := buildMIME(message)
+	if err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type FileTransport struct {
+	dir string
+}
+
+func (t *FileTransport) Send(message MailMessage) error {
+	name := time.Now().UTC().Format("20060102T150405") + "-" + uuid.New().String() + ".eml"
+	body, err := buildMIME(message)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.dir, name), body, 0o644)
+}
+
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(message MailMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, message)
+	return nil
+}
+
+func (t *MemoryTransport) Messages() []MailMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]MailMessage(nil), t.messages...)
+}
+
+func buildMIME(message MailMessage) ([]byte, error) {
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if message.HTMLBody == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(message.TextBody)
+		return buf.Bytes(), nil
+	}
+
+	boundary := "alt-" + uuid.New().String()
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(message.TextBody + "\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	buf.WriteString(message.HTMLBody + "\r\n")
+	buf.WriteString("--" + boundary + "--\r\n")
+	return buf.Bytes(), nil
+}
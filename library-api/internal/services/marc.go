@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+	marcXMLNamespace      = "http://www.loc.gov/MARC21/slim"
+	marcDefaultLeader     = "00000nam a2200000 i 4500"
+)
+
+type MARCRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []MARCControlField `xml:"controlfield"`
+	DataFields    []MARCDataField    `xml:"datafield"`
+}
+
+type MARCControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type MARCDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []MARCSubfield `xml:"subfield"`
+}
+
+type MARCSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcCollection struct {
+	XMLName xml.Name     `xml:"collection"`
+	Xmlns   string       `xml:"xmlns,attr,omitempty"`
+	Records []MARCRecord `xml:"record"`
+}
+
+func (r *MARCRecord) Control(tag string) string {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func (r *MARCRecord) Subfield(tag string, code string) string {
+	values := r.Subfields(tag, code)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (r *MARCRecord) Subfields(tag string, code string) []string {
+	var values []string
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == code {
+				values = append(values, subfield.Value)
+			}
+		}
+	}
+	return values
+}
+
+func (r *MARCRecord) AddControl(tag string, value string) {
+	if value == "" {
+		return
+	}
+	r.ControlFields = append(r.ControlFields, MARCControlField{Tag: tag, Value: value})
+}
+
+func (r *MARCRecord) AddData(tag string, ind1 string, ind2 string, subfields ...MARCSubfield) {
+	kept := make([]MARCSubfield, 0, len(subfields))
+	for _, subfield := range subfields {
+		if subfield.Value != "" {
+			kept = append(kept, subfield)
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+	r.DataFields = append(r.DataFields, MARCDataField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: kept})
+}
+
+func ParseMARCXML(data []byte) ([]MARCRecord, error) {
+	var collection marcCollection
+	if err := xml.Unmarshal(data, &collection); err == nil {
+		return collection.Records, nil
+	}
+	var record MARCRecord
+	if err := xml.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid MARCXML: %w", err)
+	}
+	return []MARCRecord{record}, nil
+}
+
+func WriteMARCXML(records []MARCRecord) ([]byte, error) {
+	payload, err := xml.MarshalIndent(marcCollection{Xmlns: marcXMLNamespace, Records: records}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), payload...), nil
+}
+
+func ParseISO2709(data []byte) ([]MARCRecord, error) {
+	var records []MARCRecord
+	for len(bytes.TrimSpace(data)) > 0 {
+		data = bytes.TrimLeft(data, "\r\n ")
+		if len(data) < 24 {
+			return nil, errors.New("truncated ISO 2709 leader")
+		}
+		length, ok := marcNumber(data[0:5])
+		if !ok || length < 24 || length > len(data) {
+			return nil, fmt.Errorf("invalid ISO 2709 record length at record %d", len(records)+1)
+		}
+		record, err := parseISO2709Record(data[:length])
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+		data = data[length:]
+	}
+	return records, nil
+}
+
+func parseISO2709Record(raw []byte) (MARCRecord, error) {
+	record := MARCRecord{Leader: string(raw[:24])}
+	base, ok := marcNumber(raw[12:17])
+	if !ok || base < 24 || base > len(raw) {
+		return record, errors.New("invalid base address")
+	}
+	directory := raw[24:base]
+	if idx := bytes.IndexByte(directory, marcFieldTerminator); idx >= 0 {
+		directory = directory[:idx]
+	}
+	if len(directory)%12 != 0 {
+		return record, errors.New("invalid directory")
+	}
+
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[0:3])
+		fieldLength, okLength := marcNumber(entry[3:7])
+		start, okStart := marcNumber(entry[7:12])
+		if !okLength || !okStart || start > len(raw)-base || fieldLength > len(raw)-base-start {
+			return record, fmt.Errorf("invalid directory entry for tag %q", tag)
+		}
+		value := bytes.TrimRight(raw[base+start:base+start+fieldLength], string([]byte{marcFieldTerminator, marcRecordTerminator}))
+
+		if tag < "010" {
+			record.ControlFields = append(record.ControlFields, MARCControlField{Tag: tag, Value: string(value)})
+			continue
+		}
+
+		field := MARCDataField{Tag: tag, Ind1: " ", Ind2: " "}
+		if len(value) >= 2 {
+			field.Ind1 = string(value[0])
+			field.Ind2 = string(value[1])
+			value = value[2:]
+		}
+		for _, part := range bytes.Split(value, []byte{marcSubfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			field.Subfields = append(field.Subfields, MARCSubfield{Code: string(part[0]), Value: string(part[1:])})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+	return record, nil
+}
+
+func WriteISO2709(records []MARCRecord) ([]byte, error) {
+	var out bytes.Buffer
+	for _, record := range records {
+		var directory, body bytes.Buffer
+		addField := func(tag string, value []byte) error {
+			value = append(value, marcFieldTerminator)
+			if len(value) > 9999 || body.Len() > 99999 {
+				return fmt.Errorf("field %s too long for ISO 2709", tag)
+			}
+			fmt.Fprintf(&directory, "%s%04d%05d", tag, len(value), body.Len())
+			body.Write(value)
+			return nil
+		}
+
+		for _, field := range record.ControlFields {
+			if err := addField(field.Tag, []byte(field.Value)); err != nil {
+				return nil, err
+			}
+		}
+		for _, field := range record.DataFields {
+			var value bytes.Buffer
+			value.WriteString(indicator(field.Ind1))
+			value.WriteString(indicator(field.Ind2))
+			for _, subfield := range field.Subfields {
+				value.WriteByte(marcSubfieldDelimiter)
+				value.WriteString(subfield.Code)
+				value.WriteString(subfield.Value)
+			}
+			if err := addField(field.Tag, value.Bytes()); err != nil {
+				return nil, err
+			}
+		}
+		directory.WriteByte(marcFieldTerminator)
+		body.WriteByte(marcRecordTerminator)
+
+		base := 24 + directory.Len()
+		length := base + body.Len()
+		if length > 99999 {
+			return nil, errors.New("record too long for ISO 2709")
+		}
+
+		leader := []byte(record.Leader)
+		if len(leader) != 24 {
+			leader = []byte(marcDefaultLeader)
+		}
+		copy(leader[0:5], fmt.Sprintf("%05d", length))
+		leader[9] = 'a'
+		copy(leader[10:12], "22")
+		copy(leader[12:17], fmt.Sprintf("%05d", base))
+		copy(leader[20:24], "4500")
+
+		out.Write(leader)
+		out.Write(directory.Bytes())
+		out.Write(body.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+func marcNumber(digits []byte) (int, bool) {
+	if len(digits) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		n = n*10 + int(digit-'0')
+	}
+	return n, true
+}
+
+func indicator(value string) string {
+	if len(value) != 1 {
+		return " "
+	}
+	return value
+}
+
+func cleanMARCValue(value string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(value), " /:;,."))
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleMARCRecord() MARCRecord {
+	record := MARCRecord{Leader: marcDefaultLeader}
+	record.AddControl("001", "BK-42")
+	record.AddControl("008", "190301s2019    pe            000 0 spa d")
+	record.AddData("020", " ", " ", MARCSubfield{Code: "a", Value: testISBN})
+	record.AddData("100", "1", " ", MARCSubfield{Code: "a", Value: "Torres, Ana"})
+	record.AddData("245", "1", "0",
+		MARCSubfield{Code: "a", Value: "Ciencia de datos"},
+		MARCSubfield{Code: "b", Value: "una introduccion"},
+	)
+	record.AddData("650", " ", "0", MARCSubfield{Code: "a", Value: "Estadistica"})
+	record.AddData("650", " ", "0", MARCSubfield{Code: "a", Value: "Programacion"})
+	return record
+}
+
+func marcLeader(length, base int) string {
+	return fmt.Sprintf("%05dnam a22%05d i 4500", length, base)
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	first := sampleMARCRecord()
+	second := MARCRecord{Leader: marcDefaultLeader}
+	second.AddControl("001", "BK-43")
+	second.AddData("245", "0", "0", MARCSubfield{Code: "a", Value: "Año académico"})
+
+	data, err := WriteISO2709([]MARCRecord{first, second})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	records, err := ParseISO2709(append(data, '\n'))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if !reflect.DeepEqual(records[0].ControlFields, first.ControlFields) || !reflect.DeepEqual(records[0].DataFields, first.DataFields) {
+		t.Fatalf("first record changed: %+v", records[0])
+	}
+	if records[1].Control("001") != "BK-43" || records[1].Subfield("245", "a") != "Año académico" {
+		t.Fatalf("second record changed: %+v", records[1])
+	}
+	if got := records[0].Subfields("650", "a"); !reflect.DeepEqual(got, []string{"Estadistica", "Programacion"}) {
+		t.Fatalf("unexpected subjects: %v", got)
+	}
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	record := sampleMARCRecord()
+	data, err := WriteMARCXML([]MARCRecord{record})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(string(data), `xmlns="`+marcXMLNamespace+`"`) {
+		t.Fatalf("missing namespace: %s", data)
+	}
+	records, err := ParseMARCXML(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if !reflect.DeepEqual(records[0].ControlFields, record.ControlFields) || !reflect.DeepEqual(records[0].DataFields, record.DataFields) {
+		t.Fatalf("record changed: %+v", records[0])
+	}
+}
+
+func TestParseMARCXMLSingleRecord(t *testing.T) {
+	records, err := ParseMARCXML([]byte(`<record><leader>` + marcDefaultLeader + `</leader>
+		<datafield tag="245" ind1="1" ind2="0"><subfield code="a">Solo</subfield></datafield></record>`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(records) != 1 || records[0].Subfield("245", "a") != "Solo" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	if _, err := ParseMARCXML([]byte(`<collection><record>`)); err == nil {
+		t.Fatal("expected error for truncated XML")
+	}
+}
+
+func TestParseISO2709RejectsMalformedInput(t *testing.T) {
+	valid, err := WriteISO2709([]MARCRecord{sampleMARCRecord()})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	body := string(valid[24:])
+	directoryEnd := strings.IndexByte(body, marcFieldTerminator)
+	base := 24 + directoryEnd + 1
+
+	withLeader := func(leader string) string {
+		return leader + body
+	}
+	withEntry := func(entry string) string {
+		data := []byte(string(valid))
+		copy(data[24:36], entry)
+		return string(data)
+	}
+
+	cases := map[string]string{
+		"short leader":            "00024nam a22",
+		"non numeric length":      withLeader("abcdenam a2200000 i 4500"),
+		"negative length":         withLeader("-0001nam a2200000 i 4500"),
+		"length below leader":     withLeader(marcLeader(10, base)),
+		"length beyond data":      withLeader(marcLeader(len(valid)+1, base)),
+		"negative base":           withLeader(marcLeader(len(valid), 0)[:12] + "-0001" + marcDefaultLeader[17:]),
+		"signed base":             withLeader(marcLeader(len(valid), 0)[:12] + "+0030" + marcDefaultLeader[17:]),
+		"base below leader":       withLeader(marcLeader(len(valid), 5)),
+		"base beyond record":      withLeader(marcLeader(len(valid), len(valid)+1)),
+		"truncated directory":     marcLeader(24+13, 24+13) + "0010003000" + string(rune(marcFieldTerminator)) + "x" + string(rune(marcRecordTerminator)),
+		"negative field length":   withEntry("001-00100000"),
+		"negative field start":    withEntry("0010007-0001"),
+		"field beyond record":     withEntry("001999900000"),
+		"start beyond record":     withEntry("001000199999"),
+		"non numeric field start": withEntry("00100070000x"),
+		"truncated record":        string(valid[:len(valid)-5]),
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("parser panicked: %v", r)
+				}
+			}()
+			if _, err := ParseISO2709([]byte(input)); err == nil {
+				t.Fatalf("expected error for %q", input)
+			}
+		})
+	}
+}
+
+func TestParseISO2709EmptyInput(t *testing.T) {
+	records, err := ParseISO2709([]byte("\n  \r\n"))
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no records, got %v, %v", records, err)
+	}
+}
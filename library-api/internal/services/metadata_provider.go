@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jos3lo89/library-api/config"
+)
+
+const metadataMaxBody = 2 << 20
+
+var (
+	ErrMetadataNotFound = errors.New("no metadata found for isbn")
+	yearPattern         = regexp.MustCompile(`\b(1[5-9]|20)\d{2}\b`)
+)
+
+type BookMetadata struct {
+	ISBN        string   `json:"isbn"`
+	Title       string   `json:"title"`
+	Subtitle    string   `json:"subtitle,omitempty"`
+	Authors     []string `json:"authors"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	CoverURL    string   `json:"cover_url,omitempty"`
+	Subjects    []string `json:"subjects"`
+	Description string   `json:"description,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Pages       int      `json:"pages,omitempty"`
+	Source      string   `json:"source"`
+}
+
+type MetadataProvider interface {
+	Name() string
+	LookupISBN(ctx context.Context, isbn string) (*BookMetadata, error)
+}
+
+func NewMetadataProviders(cfg *config.Config) ([]MetadataProvider, error) {
+	client := &http.Client{Timeout: cfg.MetadataTimeout}
+	providers := make([]MetadataProvider, 0, len(cfg.MetadataProviders))
+	for _, name := range cfg.MetadataProviders {
+		switch strings.ToLower(name) {
+		case "openlibrary":
+			providers = append(providers, &OpenLibraryProvider{baseURL: strings.TrimRight(cfg.OpenLibraryURL, "/"), client: client})
+		case "googlebooks":
+			providers = append(providers, &GoogleBooksProvider{baseURL: strings.TrimRight(cfg.GoogleBooksURL, "/"), apiKey: cfg.GoogleBooksAPIKey, client: client})
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %q", name)
+		}
+	}
+	return providers, nil
+}
+
+type OpenLibraryProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+type openLibraryNamed struct {
+	Name string `json:"name"`
+}
+
+type openLibraryBook struct {
+	Title         string             `json:"title"`
+	Subtitle      string             `json:"subtitle"`
+	Authors       []openLibraryNamed `json:"authors"`
+	Publishers    []openLibraryNamed `json:"publishers"`
+	PublishDate   string             `json:"publish_date"`
+	Subjects      []openLibraryNamed `json:"subjects"`
+	NumberOfPages int                `json:"number_of_pages"`
+	Notes         any                `json:"notes"`
+	Cover         struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+func (p *OpenLibraryProvider) Name() string {
+	return "openlibrary"
+}
+
+func (p *OpenLibraryProvider) LookupISBN(ctx context.Context, isbn string) (*BookMetadata, error) {
+	query := url.Values{}
+	query.Set("bibkeys", "ISBN:"+isbn)
+	query.Set("format", "json")
+	query.Set("jscmd", "data")
+
+	var result map[string]openLibraryBook
+	if err := getJSON(ctx, p.client, p.baseURL+"/api/books?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	book, ok := result["ISBN:"+isbn]
+	if !ok || book.Title == "" {
+		return nil, ErrMetadataNotFound
+	}
+
+	metadata := &BookMetadata{
+		ISBN:     isbn,
+		Title:    book.Title,
+		Subtitle: book.Subtitle,
+		Authors:  []string{},
+		Subjects: []string{},
+		Year:     parseYear(book.PublishDate),
+		Pages:    book.NumberOfPages,
+		Source:   p.Name(),
+	}
+	for _, author := range book.Authors {
+		metadata.Authors = append(metadata.Authors, author.Name)
+	}
+	if len(book.Publishers) > 0 {
+		metadata.Publisher = book.Publishers[0].Name
+	}
+	for _, subject := range book.Subjects {
+		metadata.Subjects = append(metadata.Subjects, subject.Name)
+	}
+	switch notes := book.Notes.(type) {
+	case string:
+		metadata.Description = notes
+	case map[string]any:
+		metadata.Description, _ = notes["value"].(string)
+	}
+	switch {
+	case book.Cover.Large != "":
+		metadata.CoverURL = book.Cover.Large
+	case book.Cover.Medium != "":
+		metadata.CoverURL = book.Cover.Medium
+	default:
+		metadata.CoverURL = book.Cover.Small
+	}
+	return metadata, nil
+}
+
+type GoogleBooksProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+type googleBooksResponse struct {
+	TotalItems int `json:"totalItems"`
+	Items      []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Subtitle      string   `json:"subtitle"`
+			Authors       []string `json:"authors"`
+			Publisher     string   `json:"publisher"`
+			PublishedDate string   `json:"publishedDate"`
+			Description   string   `json:"description"`
+			Categories    []string `json:"categories"`
+			Language      string   `json:"language"`
+			PageCount     int      `json:"pageCount"`
+			ImageLinks    struct {
+				SmallThumbnail string `json:"smallThumbnail"`
+				Thumbnail      string `json:"thumbnail"`
+			} `json:"imageLinks"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func (p *GoogleBooksProvider) Name() string {
+	return "googlebooks"
+}
+
+func (p *GoogleBooksProvider) LookupISBN(ctx context.Context, isbn string) (*BookMetadata, error) {
+	query := url.Values{}
+	query.Set("q", "isbn:"+isbn)
+	if p.apiKey != "" {
+		query.Set("key", p.apiKey)
+	}
+
+	var result googleBooksResponse
+	if err := getJSON(ctx, p.client, p.baseURL+"/books/v1/volumes?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 || result.Items[0].VolumeInfo.Title == "" {
+		return nil, ErrMetadataNotFound
+	}
+
+	info := result.Items[0].VolumeInfo
+	metadata := &BookMetadata{
+		ISBN:        isbn,
+		Title:       info.Title,
+		Subtitle:    info.Subtitle,
+		Authors:     append([]string{}, info.Authors...),
+		Publisher:   info.Publisher,
+		Year:        parseYear(info.PublishedDate),
+		Subjects:    append([]string{}, info.Categories...),
+		Description: info.Description,
+		Language:    info.Language,
+		Pages:       info.PageCount,
+		Source:      p.Name(),
+	}
+	if info.ImageLinks.Thumbnail != "" {
+		metadata.CoverURL = info.ImageLinks.Thumbnail
+	} else {
+		metadata.CoverURL = info.ImageLinks.SmallThumbnail
+	}
+	return metadata, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrMetadataNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, metadataMaxBody)).Decode(target)
+}
+
+func parseYear(value string) int {
+	match := yearPattern.FindString(value)
+	if match == "" {
+		return 0
+	}
+	year, _ := strconv.Atoi(match)
+	if year > time.Now().Year()+1 {
+		return 0
+	}
+	return year
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+var ErrInvalidISBN = errors.New("invalid isbn")
+
+type MetadataLookup struct {
+	ISBN      string        `json:"isbn"`
+	Found     bool          `json:"found"`
+	Cached    bool          `json:"cached"`
+	FetchedAt time.Time     `json:"fetched_at"`
+	Metadata  *BookMetadata `json:"metadata"`
+	Errors    []string      `json:"errors,omitempty"`
+}
+
+type MetadataService struct {
+	db        *gorm.DB
+	providers []MetadataProvider
+	ttl       time.Duration
+}
+
+func NewMetadataService(db *gorm.DB, providers []MetadataProvider, ttl time.Duration) *MetadataService {
+	return &MetadataService{db: db, providers: providers, ttl: ttl}
+}
+
+func (s *MetadataService) LookupISBN(ctx context.Context, raw string, refresh bool) (*MetadataLookup, error) {
+	isbn, err := NormalizeISBN(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if !refresh {
+		var cached models.MetadataCache
+		err := s.db.Where("isbn = ?", isbn).First(&cached).Error
+		if err == nil && time.Since(cached.FetchedAt) < s.ttl {
+			lookup := &MetadataLookup{ISBN: isbn, Found: cached.Found, Cached: true, FetchedAt: cached.FetchedAt}
+			if cached.Found {
+				lookup.Metadata = &BookMetadata{}
+				if err := json.Unmarshal([]byte(cached.Payload), lookup.Metadata); err != nil {
+					return nil, err
+				}
+			}
+			return lookup, nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	lookup := &MetadataLookup{ISBN: isbn, FetchedAt: time.Now()}
+	for _, provider := range s.providers {
+		metadata, err := provider.LookupISBN(ctx, isbn)
+		if errors.Is(err, ErrMetadataNotFound) {
+			continue
+		}
+		if err != nil {
+			lookup.Errors = append(lookup.Errors, provider.Name()+": "+err.Error())
+			continue
+		}
+		lookup.Found = true
+		lookup.Metadata = metadata
+		break
+	}
+
+	if !lookup.Found && len(lookup.Errors) > 0 {
+		return lookup, errors.New("metadata providers unavailable")
+	}
+
+	entry := models.MetadataCache{ISBN: isbn, Found: lookup.Found, FetchedAt: lookup.FetchedAt}
+	if lookup.Metadata != nil {
+		payload, err := json.Marshal(lookup.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		entry.Provider = lookup.Metadata.Source
+		entry.Payload = string(payload)
+	}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "isbn"}},
+		DoUpdates: clause.AssignmentColumns([]string{"provider", "found", "payload", "fetched_at", "updated_at"}),
+	}).Create(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return lookup, nil
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const testISBN = "9780306406157"
+
+type metadataStub struct {
+	server *httptest.Server
+	calls  atomic.Int32
+}
+
+func newMetadataStub(t *testing.T, handler http.HandlerFunc) *metadataStub {
+	t.Helper()
+	stub := &metadataStub{}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.calls.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *metadataStub) openLibrary() *OpenLibraryProvider {
+	return &OpenLibraryProvider{baseURL: s.server.URL, client: s.server.Client()}
+}
+
+func (s *metadataStub) googleBooks() *GoogleBooksProvider {
+	return &GoogleBooksProvider{baseURL: s.server.URL, client: s.server.Client()}
+}
+
+func openLibraryFound(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/books" || r.URL.Query().Get("bibkeys") != "ISBN:"+testISBN {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ISBN:` + testISBN + `": {
+		"title": "Ciencia de datos",
+		"authors": [{"name": "Ana Torres"}],
+		"publishers": [{"name": "Fondo Editorial"}],
+		"publish_date": "March 2019",
+		"subjects": [{"name": "Estadistica"}],
+		"number_of_pages": 320,
+		"notes": {"value": "Segunda edicion"},
+		"cover": {"medium": "https://covers.example/m.jpg", "large": "https://covers.example/l.jpg"}
+	}}`))
+}
+
+func TestOpenLibraryLookupFound(t *testing.T) {
+	stub := newMetadataStub(t, openLibraryFound)
+
+	metadata, err := stub.openLibrary().LookupISBN(context.Background(), testISBN)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if metadata.Title != "Ciencia de datos" || metadata.Publisher != "Fondo Editorial" || metadata.Year != 2019 || metadata.Pages != 320 {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+	if len(metadata.Authors) != 1 || metadata.Authors[0] != "Ana Torres" {
+		t.Fatalf("unexpected authors: %v", metadata.Authors)
+	}
+	if metadata.Description != "Segunda edicion" || metadata.CoverURL != "https://covers.example/l.jpg" || metadata.Source != "openlibrary" {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestGoogleBooksLookupFound(t *testing.T) {
+	stub := newMetadataStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "isbn:"+testISBN {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"totalItems": 1, "items": [{"volumeInfo": {
+			"title": "Ciencia de datos",
+			"authors": ["Ana Torres"],
+			"publishedDate": "2019-03-01",
+			"categories": ["Computers"],
+			"language": "es",
+			"pageCount": 320,
+			"imageLinks": {"smallThumbnail": "https://img.example/s.jpg"}
+		}}]}`))
+	})
+
+	metadata, err := stub.googleBooks().LookupISBN(context.Background(), testISBN)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if metadata.Title != "Ciencia de datos" || metadata.Year != 2019 || metadata.Language != "es" || metadata.Source != "googlebooks" {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+	if metadata.CoverURL != "https://img.example/s.jpg" {
+		t.Fatalf("unexpected cover: %q", metadata.CoverURL)
+	}
+}
+
+func TestMetadataLookupNotFound(t *testing.T) {
+	cases := map[string]struct {
+		handler  http.HandlerFunc
+		provider func(*metadataStub) MetadataProvider
+	}{
+		"openlibrary empty": {
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) },
+			provider: func(s *metadataStub) MetadataProvider { return s.openLibrary() },
+		},
+		"googlebooks empty": {
+			handler:  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"totalItems": 0}`)) },
+			provider: func(s *metadataStub) MetadataProvider { return s.googleBooks() },
+		},
+		"http 404": {
+			handler:  http.NotFound,
+			provider: func(s *metadataStub) MetadataProvider { return s.openLibrary() },
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			stub := newMetadataStub(t, tc.handler)
+			_, err := tc.provider(stub).LookupISBN(context.Background(), testISBN)
+			if !errors.Is(err, ErrMetadataNotFound) {
+				t.Fatalf("expected ErrMetadataNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMetadataLookupServerError(t *testing.T) {
+	stub := newMetadataStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	})
+
+	_, err := stub.openLibrary().LookupISBN(context.Background(), testISBN)
+	if err == nil || errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+
+	service := NewMetadataService(newTestDB(t, &models.MetadataCache{}), []MetadataProvider{stub.openLibrary()}, time.Hour)
+	lookup, err := service.LookupISBN(context.Background(), testISBN, false)
+	if err == nil {
+		t.Fatal("expected error when every provider fails")
+	}
+	if lookup == nil || len(lookup.Errors) != 1 || !strings.HasPrefix(lookup.Errors[0], "openlibrary: ") {
+		t.Fatalf("unexpected lookup: %+v", lookup)
+	}
+}
+
+func TestMetadataLookupBodyLimit(t *testing.T) {
+	stub := newMetadataStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ISBN:` + testISBN + `": {"title": "`))
+		w.Write([]byte(strings.Repeat("a", metadataMaxBody)))
+		w.Write([]byte(`"}}`))
+	})
+
+	if _, err := stub.openLibrary().LookupISBN(context.Background(), testISBN); err == nil {
+		t.Fatal("expected oversized body to be rejected")
+	}
+}
+
+func TestMetadataServiceFallsBackToNextProvider(t *testing.T) {
+	failing := newMetadataStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	})
+	found := newMetadataStub(t, openLibraryFound)
+
+	service := NewMetadataService(newTestDB(t, &models.MetadataCache{}), []MetadataProvider{failing.openLibrary(), found.openLibrary()}, time.Hour)
+	lookup, err := service.LookupISBN(context.Background(), testISBN, false)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if !lookup.Found || lookup.Metadata.Title != "Ciencia de datos" || len(lookup.Errors) != 1 {
+		t.Fatalf("unexpected lookup: %+v", lookup)
+	}
+}
+
+func TestMetadataServiceCache(t *testing.T) {
+	stub := newMetadataStub(t, openLibraryFound)
+	db := newTestDB(t, &models.MetadataCache{})
+	service := NewMetadataService(db, []MetadataProvider{stub.openLibrary()}, time.Hour)
+	ctx := context.Background()
+
+	first, err := service.LookupISBN(ctx, testISBN, false)
+	if err != nil || !first.Found || first.Cached {
+		t.Fatalf("first lookup: %+v, %v", first, err)
+	}
+
+	cached, err := service.LookupISBN(ctx, testISBN, false)
+	if err != nil {
+		t.Fatalf("cached lookup: %v", err)
+	}
+	if !cached.Cached || !cached.Found || cached.Metadata.Title != "Ciencia de datos" {
+		t.Fatalf("expected cache hit, got %+v", cached)
+	}
+	if calls := stub.calls.Load(); calls != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", calls)
+	}
+
+	refreshed, err := service.LookupISBN(ctx, testISBN, true)
+	if err != nil || refreshed.Cached {
+		t.Fatalf("refresh lookup: %+v, %v", refreshed, err)
+	}
+	if calls := stub.calls.Load(); calls != 2 {
+		t.Fatalf("expected refresh to call upstream, got %d calls", calls)
+	}
+
+	if err := db.Model(&models.MetadataCache{}).Where("isbn = ?", testISBN).Update("fetched_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("expire cache: %v", err)
+	}
+	expired, err := service.LookupISBN(ctx, testISBN, false)
+	if err != nil || expired.Cached {
+		t.Fatalf("expired lookup: %+v, %v", expired, err)
+	}
+	if calls := stub.calls.Load(); calls != 3 {
+		t.Fatalf("expected expired entry to call upstream, got %d calls", calls)
+	}
+
+	var count int64
+	db.Model(&models.MetadataCache{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected a single cache row, got %d", count)
+	}
+}
+
+func TestMetadataServiceCachesMisses(t *testing.T) {
+	stub := newMetadataStub(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) })
+	service := NewMetadataService(newTestDB(t, &models.MetadataCache{}), []MetadataProvider{stub.openLibrary()}, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		lookup, err := service.LookupISBN(context.Background(), testISBN, false)
+		if err != nil || lookup.Found {
+			t.Fatalf("lookup %d: %+v, %v", i, lookup, err)
+		}
+	}
+	if calls := stub.calls.Load(); calls != 1 {
+		t.Fatalf("expected the miss to be cached, got %d calls", calls)
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrSSODisabled        = errors.New("single sign-on is not configured")
+	ErrInvalidSSOState    = errors.New("invalid or expired sign-on state")
+	ErrSSOExchange        = errors.New("identity provider rejected the sign-on")
+	ErrSSOMissingDNI      = errors.New("identity provider did not return a dni")
+	ErrSSOAccountConflict = errors.New("account is linked to a different identity")
+	ErrSSONoAccount       = errors.New("no account for this identity")
+	ErrSSOLinkRequired    = errors.New("account must be linked by an administrator")
+)
+
+type OIDCService struct {
+	db        *gorm.DB
+	mail      *MailService
+	issuer    string
+	clientID  string
+	secret    string
+	redirect  string
+	scopes    []string
+	dniClaim  string
+	nameClaim string
+	mailClaim string
+	provision bool
+	linkAny   bool
+	locale    string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCService(db *gorm.DB, mail *MailService, cfg *config.Config) *OIDCService {
+	scopes := cfg.OIDCScopes
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &OIDCService{
+		db:        db,
+		mail:      mail,
+		issuer:    strings.TrimSpace(cfg.OIDCIssuer),
+		clientID:  cfg.OIDCClientID,
+		secret:    cfg.OIDCClientSecret,
+		redirect:  cfg.OIDCRedirectURL,
+		scopes:    scopes,
+		dniClaim:  cfg.OIDCDNIClaim,
+		nameClaim: cfg.OIDCNameClaim,
+		mailClaim: cfg.OIDCEmailClaim,
+		provision: cfg.OIDCProvision,
+		linkAny:   cfg.OIDCLinkAny,
+		locale:    cfg.MailLocale,
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.issuer != "" && s.clientID != ""
+}
+
+func (s *OIDCService) Begin(ctx context.Context, redirect string) (string, string, error) {
+	oauth, _, err := s.client(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return "", "", err
+	}
+	if err := s.db.Create(&models.OIDCLoginState{
+		StateHash: utils.HashToken(state),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		Redirect:  redirect,
+		ExpiresAt: now.Add(oidcStateTTL),
+	}).Error; err != nil {
+		return "", "", err
+	}
+
+	authURL := oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+func (s *OIDCService) Complete(ctx context.Context, state, code string) (*models.User, string, error) {
+	oauth, provider, err := s.client(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var login models.OIDCLoginState
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state_hash = ? AND expires_at > ?", utils.HashToken(state), time.Now()).
+			First(&login).Error; err != nil {
+			return ErrInvalidSSOState
+		}
+		return tx.Delete(&login).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, "", ErrSSOExchange
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, "", ErrSSOExchange
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.clientID}).Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != login.Nonce {
+		return nil, "", ErrSSOExchange
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", ErrSSOExchange
+	}
+	if claimString(claims, s.dniClaim) == "" {
+		if info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token)); err == nil {
+			extra := map[string]any{}
+			if err := info.Claims(&extra); err == nil {
+				for key, value := range extra {
+					if _, exists := claims[key]; !exists {
+						claims[key] = value
+					}
+				}
+			}
+		}
+	}
+
+	user, err := s.linkUser(idToken.Subject, claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, login.Redirect, nil
+}
+
+func (s *OIDCService) linkUser(subject string, claims map[string]any) (*models.User, error) {
+	dni := strings.TrimSpace(claimString(claims, s.dniClaim))
+	if dni == "" {
+		return nil, ErrSSOMissingDNI
+	}
+
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var linked models.User
+		err := tx.Where("oidc_subject = ?", subject).First(&linked).Error
+		if err == nil && linked.DNI != dni {
+			return ErrSSOAccountConflict
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("dni = ?", dni).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.provisionUser(tx, &user, dni, subject, claims)
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.OIDCSubject != nil {
+			if *user.OIDCSubject != subject {
+				return ErrSSOAccountConflict
+			}
+			return nil
+		}
+		if !s.linkAny && (user.Role == models.RoleAdmin || user.AuthSource != models.AuthSourceLocal) {
+			return ErrSSOLinkRequired
+		}
+		user.OIDCSubject = &subject
+		return tx.Model(&user).Update("oidc_subject", subject).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	return &user, nil
+}
+
+func (s *OIDCService) Link(userID uint, subject string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.User{}).Where("oidc_subject = ? AND id <> ?", subject, user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSSOAccountConflict
+		}
+		return tx.Model(&user).Update("oidc_subject", subject).Error
+	})
+}
+
+func (s *OIDCService) Unlink(userID uint) error {
+	result := s.db.Model(&models.User{}).Where("id = ?", userID).Update("oidc_subject", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *OIDCService) provisionUser(tx *gorm.DB, user *models.User, dni, subject string, claims map[string]any) error {
+	if !s.provision {
+		return ErrSSONoAccount
+	}
+
+	password, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fullName := strings.TrimSpace(claimString(claims, s.nameClaim))
+	if fullName == "" {
+		fullName = dni
+	}
+	*user = models.User{
+		DNI:          dni,
+		FullName:     fullName,
+		Email:        strings.TrimSpace(claimString(claims, s.mailClaim)),
+		Locale:       s.locale,
+		PasswordHash: hashed,
+		Role:         models.RoleStudent,
+		IsActive:     true,
+		OIDCSubject:  &subject,
+		AuthSource:   models.AuthSourceOIDC,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+	return s.mail.Enqueue(tx, user.Email, "welcome", user.Locale, user)
+}
+
+func (s *OIDCService) client(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	if !s.Enabled() {
+		return nil, nil, ErrSSODisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(ctx, s.issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.provider = provider
+	}
+
+	return &oauth2.Config{
+		ClientID:     s.clientID,
+		ClientSecret: s.secret,
+		RedirectURL:  s.redirect,
+		Endpoint:     s.provider.Endpoint(),
+		Scopes:       s.scopes,
+	}, s.provider, nil
+}
+
+func claimString(claims map[string]any, path string) string {
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const (
+	testOIDCClientID = "biblioteca"
+	testOIDCKeyID    = "idp-key"
+)
+
+type mockIdPGrant struct {
+	challenge string
+	nonce     string
+}
+
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	grants   map[string]mockIdPGrant
+	next     int
+	subject  string
+	claims   map[string]any
+	userinfo map[string]any
+	nonce    string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate idp key: %v", err)
+	}
+	idp := &mockIdP{
+		key:      key,
+		grants:   map[string]mockIdPGrant{},
+		subject:  "sub-1",
+		claims:   map[string]any{"dni": "12345678", "name": "Ana Torres", "email": "ana@universidad.edu.pe"},
+		userinfo: map[string]any{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"userinfo_endpoint":                     idp.server.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testOIDCKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		writeTestJSON(w, http.StatusOK, idp.userinfo)
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	if !ok {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	digest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(digest[:]) != grant.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "pkce verification failed"})
+		return
+	}
+
+	nonce := grant.nonce
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   testOIDCClientID,
+		"sub":   idp.subject,
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for key, value := range idp.claims {
+		claims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testOIDCKeyID
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeTestJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (idp *mockIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("auth url lacks a PKCE challenge: %s", authURL)
+	}
+	if query.Get("client_id") != testOIDCClientID || query.Get("nonce") == "" {
+		t.Fatalf("unexpected auth url: %s", authURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.next++
+	code := "code-" + strconv.Itoa(idp.next)
+	idp.grants[code] = mockIdPGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return code
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+type oidcFixture struct {
+	idp       *mockIdP
+	db        *gorm.DB
+	cfg       *config.Config
+	transport *MemoryTransport
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+	idp := newMockIdP(t)
+	return &oidcFixture{
+		idp:       idp,
+		db:        newTestDB(t, &models.User{}, &models.OIDCLoginState{}, &models.OutboxEmail{}),
+		transport: NewMemoryTransport(),
+		cfg: &config.Config{
+			OIDCIssuer:       idp.server.URL,
+			OIDCClientID:     testOIDCClientID,
+			OIDCClientSecret: "client-secret",
+			OIDCRedirectURL:  "http://localhost:3000/api/auth/oidc/callback",
+			OIDCScopes:       []string{"openid", "profile", "email"},
+			OIDCDNIClaim:     "dni",
+			OIDCNameClaim:    "name",
+			OIDCEmailClaim:   "email",
+			OIDCProvision:    true,
+			MailFrom:         "Biblioteca <no-reply@biblioteca.local>",
+			MailLocale:       "es",
+		},
+	}
+}
+
+func (f *oidcFixture) service(t *testing.T) *OIDCService {
+	t.Helper()
+	mail, err := NewMailService(f.db, f.transport, f.cfg)
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	return NewOIDCService(f.db, mail, f.cfg)
+}
+
+func (f *oidcFixture) begin(t *testing.T, service *OIDCService) (string, string) {
+	t.Helper()
+	authURL, state, err := service.Begin(context.Background(), "/mis-libros")
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	return state, f.idp.authorize(t, authURL)
+}
+
+func (f *oidcFixture) login(t *testing.T, service *OIDCService) (*models.User, error) {
+	t.Helper()
+	state, code := f.begin(t, service)
+	user, _, err := service.Complete(context.Background(), state, code)
+	return user, err
+}
+
+func (f *oidcFixture) createUser(t *testing.T, user models.User) *models.User {
+	t.Helper()
+	if user.FullName == "" {
+		user.FullName = "Usuario " + user.DNI
+	}
+	if user.PasswordHash == "" {
+		user.PasswordHash = "x"
+	}
+	if user.Role == "" {
+		user.Role = models.RoleStudent
+	}
+	if user.AuthSource == "" {
+		user.AuthSource = models.AuthSourceLocal
+	}
+	if err := f.db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return &user
+}
+
+func TestOIDCCompleteProvisionsUser(t *testing.T) {
+	f := newOIDCFixture(t)
+	service := f.service(t)
+
+	state, code := f.begin(t, service)
+	user, redirect, err := service.Complete(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if redirect != "/mis-libros" {
+		t.Fatalf("unexpected redirect %q", redirect)
+	}
+	if user.DNI != "12345678" || user.FullName != "Ana Torres" || user.Role != models.RoleStudent || user.AuthSource != models.AuthSourceOIDC {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if user.OIDCSubject == nil || *user.OIDCSubject != "sub-1" {
+		t.Fatalf("user not linked to subject: %v", user.OIDCSubject)
+	}
+
+	var queued int64
+	f.db.Model(&models.OutboxEmail{}).Where("recipient = ? AND template = ?", "ana@universidad.edu.pe", "welcome").Count(&queued)
+	if queued != 1 {
+		t.Fatalf("expected a welcome email, got %d", queued)
+	}
+
+	again, err := f.login(t, service)
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("second login: %+v, %v", again, err)
+	}
+}
+
+func TestOIDCCompleteRejectsWrongVerifier(t *testing.T) {
+	f := newOIDCFixture(t)
+	service := f.service(t)
+
+	state, code := f.begin(t, service)
+	if err := f.db.Model(&models.OIDCLoginState{}).Where("1 = 1").Update("verifier", "tampered-verifier-tampered-verifier-tampered").Error; err != nil {
+		t.Fatalf("tamper verifier: %v", err)
+	}
+	if _, _, err := service.Complete(context.Background(), state, code); !errors.Is(err, ErrSSOExchange) {
+		t.Fatalf("expected ErrSSOExchange, got %v", err)
+	}
+}
+
+func TestOIDCCompleteStateIsSingleUse(t *testing.T) {
+	f := newOIDCFixture(t)
+	service := f.service(t)
+
+	state, code := f.begin(t, service)
+	if _, _, err := service.Complete(context.Background(), state, code); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, _, err := service.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("expected ErrInvalidSSOState on reuse, got %v", err)
+	}
+	if _, _, err := service.Complete(context.Background(), "unknown-state", code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("expected ErrInvalidSSOState for unknown state, got %v", err)
+	}
+}
+
+func TestOIDCCompleteRejectsExpiredState(t *testing.T) {
+	f := newOIDCFixture(t)
+	service := f.service(t)
+
+	state, code := f.begin(t, service)
+	if err := f.db.Model(&models.OIDCLoginState{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire state: %v", err)
+	}
+	if _, _, err := service.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("expected ErrInvalidSSOState, got %v", err)
+	}
+}
+
+func TestOIDCCompleteRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.idp.nonce = "another-nonce"
+	service := f.service(t)
+
+	if _, err := f.login(t, service); !errors.Is(err, ErrSSOExchange) {
+		t.Fatalf("expected ErrSSOExchange, got %v", err)
+	}
+	var count int64
+	f.db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("no user should be created, got %d", count)
+	}
+}
+
+func TestOIDCCompleteMissingDNI(t *testing.T) {
+	f := newOIDCFixture(t)
+	delete(f.idp.claims, "dni")
+	service := f.service(t)
+
+	if _, err := f.login(t, service); !errors.Is(err, ErrSSOMissingDNI) {
+		t.Fatalf("expected ErrSSOMissingDNI, got %v", err)
+	}
+
+	f.idp.userinfo = map[string]any{"dni": "87654321"}
+	user, err := f.login(t, service)
+	if err != nil {
+		t.Fatalf("userinfo fallback: %v", err)
+	}
+	if user.DNI != "87654321" {
+		t.Fatalf("expected dni from userinfo, got %q", user.DNI)
+	}
+}
+
+func TestOIDCCompleteSubjectConflict(t *testing.T) {
+	f := newOIDCFixture(t)
+	other := "sub-other"
+	f.createUser(t, models.User{DNI: "12345678", OIDCSubject: &other})
+	service := f.service(t)
+
+	if _, err := f.login(t, service); !errors.Is(err, ErrSSOAccountConflict) {
+		t.Fatalf("expected conflict for a user linked to another subject, got %v", err)
+	}
+
+	f.idp.subject = other
+	f.idp.claims["dni"] = "11111111"
+	if _, err := f.login(t, service); !errors.Is(err, ErrSSOAccountConflict) {
+		t.Fatalf("expected conflict for a subject linked to another dni, got %v", err)
+	}
+}
+
+func TestOIDCCompleteWithoutProvisioning(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.cfg.OIDCProvision = false
+	service := f.service(t)
+
+	if _, err := f.login(t, service); !errors.Is(err, ErrSSONoAccount) {
+		t.Fatalf("expected ErrSSONoAccount, got %v", err)
+	}
+
+	existing := f.createUser(t, models.User{DNI: "12345678"})
+	user, err := f.login(t, service)
+	if err != nil {
+		t.Fatalf("link existing user: %v", err)
+	}
+	if user.ID != existing.ID || user.OIDCSubject == nil || *user.OIDCSubject != "sub-1" {
+		t.Fatalf("existing user not linked: %+v", user)
+	}
+}
+
+func TestOIDCCompleteRefusesToAutoLinkProtectedAccounts(t *testing.T) {
+	cases := map[string]models.User{
+		"local admin": {DNI: "12345678", Role: models.RoleAdmin},
+		"ldap user":   {DNI: "12345678", AuthSource: models.AuthSourceLDAP},
+	}
+	for name, existing := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			user := f.createUser(t, existing)
+			service := f.service(t)
+
+			if _, err := f.login(t, service); !errors.Is(err, ErrSSOLinkRequired) {
+				t.Fatalf("expected ErrSSOLinkRequired, got %v", err)
+			}
+
+			if err := service.Link(user.ID, "sub-1"); err != nil {
+				t.Fatalf("admin link: %v", err)
+			}
+			linked, err := f.login(t, service)
+			if err != nil || linked.ID != user.ID {
+				t.Fatalf("login after admin link: %+v, %v", linked, err)
+			}
+		})
+	}
+
+	t.Run("allowed by config", func(t *testing.T) {
+		f := newOIDCFixture(t)
+		f.cfg.OIDCLinkAny = true
+		admin := f.createUser(t, models.User{DNI: "12345678", Role: models.RoleAdmin})
+		user, err := f.login(t, f.service(t))
+		if err != nil || user.ID != admin.ID {
+			t.Fatalf("expected admin to be linked, got %+v, %v", user, err)
+		}
+	})
+}
+
+func TestOIDCLinkRejectsSubjectInUse(t *testing.T) {
+	f := newOIDCFixture(t)
+	subject := "sub-1"
+	f.createUser(t, models.User{DNI: "11111111", OIDCSubject: &subject})
+	user := f.createUser(t, models.User{DNI: "22222222"})
+	service := f.service(t)
+
+	if err := service.Link(user.ID, subject); !errors.Is(err, ErrSSOAccountConflict) {
+		t.Fatalf("expected ErrSSOAccountConflict, got %v", err)
+	}
+	if err := service.Link(9999, "sub-2"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := service.Unlink(user.ID); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+}
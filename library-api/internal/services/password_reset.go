@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+type ResetDelivery interface {
+	Deliver(tx *gorm.DB, user *models.User, token string, expiresAt time.Time) error
+}
+
+func NewResetDelivery(cfg *config.Config, mail *MailService) (ResetDelivery, error) {
+	switch strings.ToLower(cfg.PasswordResetChannel) {
+	case "mail", "":
+		return &MailResetDelivery{mail: mail, baseURL: cfg.PasswordResetURL}, nil
+	case "log":
+		return &LogResetDelivery{}, nil
+	default:
+		return nil, fmt.Errorf("unknown password reset channel %q", cfg.PasswordResetChannel)
+	}
+}
+
+type resetNotice struct {
+	FullName string
+	Link     string
+	Minutes  int
+}
+
+type MailResetDelivery struct {
+	mail    *MailService
+	baseURL string
+}
+
+func (d *MailResetDelivery) Deliver(tx *gorm.DB, user *models.User, token string, expiresAt time.Time) error {
+	if user.Email == "" {
+		return nil
+	}
+	link, err := url.Parse(d.baseURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	notice := resetNotice{
+		FullName: user.FullName,
+		Link:     link.String(),
+		Minutes:  int(time.Until(expiresAt).Round(time.Minute).Minutes()),
+	}
+	return d.mail.Enqueue(tx, user.Email, "password_reset", user.Locale, notice)
+}
+
+type LogResetDelivery struct{}
+
+func (d *LogResetDelivery) Deliver(tx *gorm.DB, user *models.User, token string, expiresAt time.Time) error {
+	log.Printf("password reset token for %s (expires %s): %s", user.DNI, expiresAt.Format(time.RFC3339), token)
+	return nil
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+type AccessSubject struct {
+	Role     string `json:"role"`
+	Career   string `json:"career"`
+	Semester *int   `json:"semester,omitempty"`
+}
+
+type AccessDecision struct {
+	Allowed         bool                `json:"allowed"`
+	Scope           string              `json:"scope,omitempty"`
+	ScopeCategoryID *uint               `json:"scope_category_id,omitempty"`
+	ScopeCategory   string              `json:"scope_category,omitempty"`
+	Inherited       bool                `json:"inherited,omitempty"`
+	Reasons         []string            `json:"reasons"`
+	Rule            *models.AccessRule  `json:"rule,omitempty"`
+	Rules           []models.AccessRule `json:"evaluated_rules,omitempty"`
+}
+
+type PolicyService struct {
+	db *gorm.DB
+}
+
+func NewPolicyService(db *gorm.DB) *PolicyService {
+	return &PolicyService{db: db}
+}
+
+func SubjectFromEnrollment(role string, enrollment *models.Enrollment) AccessSubject {
+	subject := AccessSubject{Role: role}
+	if enrollment == nil {
+		return subject
+	}
+	subject.Career = strings.TrimSpace(enrollment.Career)
+	if semester, err := strconv.Atoi(strings.TrimSpace(enrollment.Semester)); err == nil {
+		subject.Semester = &semester
+	}
+	return subject
+}
+
+func (s *PolicyService) Create(rule *models.AccessRule) error {
+	rule.Effect = models.PolicyEffect(strings.ToUpper(string(rule.Effect)))
+	if rule.Effect != models.PolicyAllow && rule.Effect != models.PolicyDeny {
+		return errors.New("effect must be ALLOW or DENY")
+	}
+	if (rule.BookID == nil) == (rule.CategoryID == nil) {
+		return errors.New("rule must target exactly one of book_id or category_id")
+	}
+	if rule.SemesterMin != nil && rule.SemesterMax != nil && *rule.SemesterMin > *rule.SemesterMax {
+		return errors.New("semester_min must not exceed semester_max")
+	}
+	rule.Role = strings.ToUpper(strings.TrimSpace(rule.Role))
+	rule.Career = strings.TrimSpace(rule.Career)
+	return s.db.Create(rule).Error
+}
+
+func (s *PolicyService) List(bookID *uint, categoryID *uint) ([]models.AccessRule, error) {
+	var rules []models.AccessRule
+	q := s.db.Order("id ASC")
+	if bookID != nil {
+		q = q.Where("book_id = ?", *bookID)
+	}
+	if categoryID != nil {
+		q = q.Where("category_id = ?", *categoryID)
+	}
+	if err := q.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *PolicyService) Delete(id uint) error {
+	result := s.db.Delete(&models.AccessRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("rule not found")
+	}
+	return nil
+}
+
+// Evaluate applies the rules of the most specific scope that has any: rules
+// attached to the book replace those of its category, and a category without
+// rules inherits those of its nearest ancestor that has some. Within a scope
+// a matching DENY wins, and if ALLOW rules exist at least one must match.
+func (s *PolicyService) Evaluate(book *models.Book, subject AccessSubject) (*AccessDecision, error) {
+	var rules []models.AccessRule
+	if err := s.db.Where("book_id = ?", book.ID).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	decision := &AccessDecision{Scope: "book"}
+	if len(rules) == 0 {
+		category, categoryRules, err := s.nearestCategoryRules(book.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		if category != nil {
+			rules = categoryRules
+			decision.Scope = "category"
+			decision.ScopeCategoryID = &category.ID
+			decision.ScopeCategory = category.Name
+			decision.Inherited = category.ID != book.CategoryID
+		}
+	}
+	if len(rules) == 0 {
+		return &AccessDecision{Allowed: true, Reasons: []string{"no access rules apply to this book"}}, nil
+	}
+
+	decision.Rules = rules
+	var allowRules []models.AccessRule
+	for i := range rules {
+		rule := rules[i]
+		if rule.Effect == models.PolicyDeny && ruleMatches(rule, subject) {
+			decision.Rule = &rule
+			decision.Reasons = []string{"denied: " + describeRule(rule)}
+			decision.explainScope()
+			return decision, nil
+		}
+		if rule.Effect == models.PolicyAllow {
+			allowRules = append(allowRules, rule)
+		}
+	}
+
+	if len(allowRules) == 0 {
+		decision.Allowed = true
+		decision.Reasons = []string{"no deny rule matched"}
+		decision.explainScope()
+		return decision, nil
+	}
+
+	for i := range allowRules {
+		rule := allowRules[i]
+		if ruleMatches(rule, subject) {
+			decision.Allowed = true
+			decision.Rule = &rule
+			decision.Reasons = []string{"allowed: " + describeRule(rule)}
+			decision.explainScope()
+			return decision, nil
+		}
+	}
+
+	decision.Reasons = make([]string, 0, len(allowRules))
+	for _, rule := range allowRules {
+		decision.Reasons = append(decision.Reasons, "restricted to "+describeRule(rule))
+	}
+	decision.explainScope()
+	return decision, nil
+}
+
+func (s *PolicyService) nearestCategoryRules(categoryID uint) (*models.Category, []models.AccessRule, error) {
+	ancestors, err := categoryAncestors(s.db, categoryID)
+	if err != nil || len(ancestors) == 0 {
+		return nil, nil, err
+	}
+	ids := make([]uint, len(ancestors))
+	for i, category := range ancestors {
+		ids[i] = category.ID
+	}
+
+	var rules []models.AccessRule
+	if err := s.db.Where("category_id IN ?", ids).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range ancestors {
+		var scoped []models.AccessRule
+		for _, rule := range rules {
+			if *rule.CategoryID == ancestors[i].ID {
+				scoped = append(scoped, rule)
+			}
+		}
+		if len(scoped) > 0 {
+			return &ancestors[i], scoped, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func (d *AccessDecision) explainScope() {
+	if d.Inherited {
+		d.Reasons = append(d.Reasons, "inherited from category "+d.ScopeCategory)
+	}
+}
+
+func ruleMatches(rule models.AccessRule, subject AccessSubject) bool {
+	if rule.Role != "" && !strings.EqualFold(rule.Role, subject.Role) {
+		return false
+	}
+	if rule.Career != "" && !strings.EqualFold(rule.Career, strings.TrimSpace(subject.Career)) {
+		return false
+	}
+	if rule.SemesterMin != nil || rule.SemesterMax != nil {
+		if subject.Semester == nil {
+			return false
+		}
+		if rule.SemesterMin != nil && *subject.Semester < *rule.SemesterMin {
+			return false
+		}
+		if rule.SemesterMax != nil && *subject.Semester > *rule.SemesterMax {
+			return false
+		}
+	}
+	return true
+}
+
+func describeRule(rule models.AccessRule) string {
+	parts := []string{}
+	if rule.Role != "" {
+		parts = append(parts, "role "+rule.Role)
+	}
+	if rule.Career != "" {
+		parts = append(parts, "career "+rule.Career)
+	}
+	switch {
+	case rule.SemesterMin != nil && rule.SemesterMax != nil:
+		parts = append(parts, fmt.Sprintf("semester %d-%d", *rule.SemesterMin, *rule.SemesterMax))
+	case rule.SemesterMin != nil:
+		parts = append(parts, fmt.Sprintf("semester >= %d", *rule.SemesterMin))
+	case rule.SemesterMax != nil:
+		parts = append(parts, fmt.Sprintf("semester <= %d", *rule.SemesterMax))
+	}
+	description := "everyone"
+	if len(parts) > 0 {
+		description = strings.Join(parts, ", ")
+	}
+	if rule.Description != "" {
+		description += " (" + rule.Description + ")"
+	}
+	return description
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const favoritesListName = "Favoritos"
+
+var (
+	ErrListNotFound      = errors.New("list not found")
+	ErrListName          = errors.New("list name required")
+	ErrFavoritesList     = errors.New("the favorites list cannot be renamed, shared or deleted")
+	ErrInvalidVisibility = errors.New("visibility must be PRIVATE or SHARED")
+	ErrInvalidListOrder  = errors.New("book_ids must list every book in the list exactly once")
+	ErrBookNotInList     = errors.New("book is not in this list")
+)
+
+type ReadingListSummary struct {
+	ID          uint                  `json:"id"`
+	Name        string                `json:"name"`
+	IsFavorites bool                  `json:"is_favorites"`
+	Visibility  models.ListVisibility `json:"visibility"`
+	ShareToken  *string               `json:"share_token,omitempty"`
+	BookCount   int64                 `json:"book_count"`
+}
+
+type ReadingListService struct {
+	db *gorm.DB
+}
+
+func NewReadingListService(db *gorm.DB) *ReadingListService {
+	return &ReadingListService{db: db}
+}
+
+func (s *ReadingListService) Favorites(userID uint) (*models.ReadingList, error) {
+	list := models.ReadingList{UserID: userID, Name: favoritesListName, IsFavorites: true, Visibility: models.ListPrivate}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&list).Error; err != nil {
+		return nil, err
+	}
+	if list.ID == 0 {
+		if err := s.db.Where("user_id = ? AND is_favorites", userID).First(&list).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+func (s *ReadingListService) ListForUser(userID uint) ([]ReadingListSummary, error) {
+	if _, err := s.Favorites(userID); err != nil {
+		return nil, err
+	}
+	var items []ReadingListSummary
+	err := s.db.Model(&models.ReadingList{}).
+		Select("reading_lists.id, reading_lists.name, reading_lists.is_favorites, reading_lists.visibility, reading_lists.share_token, (SELECT COUNT(*) FROM reading_list_items i JOIN books b ON b.id = i.book_id AND b.deleted_at IS NULL WHERE i.list_id = reading_lists.id) AS book_count").
+		Where("reading_lists.user_id = ?", userID).
+		Order("reading_lists.is_favorites DESC, reading_lists.name ASC").
+		Scan(&items).Error
+	return items, err
+}
+
+func (s *ReadingListService) Create(userID uint, name string, visibility models.ListVisibility) (*models.ReadingList, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return nil, ErrListName
+	}
+	if visibility == "" {
+		visibility = models.ListPrivate
+	}
+	list := &models.ReadingList{UserID: userID, Name: name}
+	if err := applyListVisibility(list, visibility); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *ReadingListService) Get(userID uint, listID uint) (*models.ReadingList, error) {
+	var list models.ReadingList
+	if err := s.db.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+		return nil, ErrListNotFound
+	}
+	return s.withItems(&list)
+}
+
+func (s *ReadingListService) FindShared(token string) (*models.ReadingList, error) {
+	var list models.ReadingList
+	if err := s.db.Where("share_token = ? AND visibility = ?", token, models.ListShared).First(&list).Error; err != nil {
+		return nil, ErrListNotFound
+	}
+	return s.withItems(&list)
+}
+
+func (s *ReadingListService) withItems(list *models.ReadingList) (*models.ReadingList, error) {
+	err := s.db.InnerJoins("Book").Preload("Book.Category").
+		Where("reading_list_items.list_id = ?", list.ID).
+		Order("reading_list_items.position ASC").
+		Find(&list.Items).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *ReadingListService) Update(userID uint, listID uint, name *string, visibility *models.ListVisibility) (*models.ReadingList, error) {
+	var list models.ReadingList
+	if err := s.db.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+		return nil, ErrListNotFound
+	}
+	if list.IsFavorites {
+		return nil, ErrFavoritesList
+	}
+	if name != nil {
+		list.Name = strings.Join(strings.Fields(*name), " ")
+		if list.Name == "" {
+			return nil, ErrListName
+		}
+	}
+	if visibility != nil {
+		if err := applyListVisibility(&list, *visibility); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.Omit(clause.Associations).Save(&list).Error; err != nil {
+		return nil, err
+	}
+	return s.withItems(&list)
+}
+
+func applyListVisibility(list *models.ReadingList, visibility models.ListVisibility) error {
+	switch visibility {
+	case models.ListPrivate:
+		list.Visibility, list.ShareToken = visibility, nil
+	case models.ListShared:
+		list.Visibility = visibility
+		if list.ShareToken == nil {
+			token, err := utils.RandomToken(24)
+			if err != nil {
+				return err
+			}
+			list.ShareToken = &token
+		}
+	default:
+		return ErrInvalidVisibility
+	}
+	return nil
+}
+
+func (s *ReadingListService) Delete(userID uint, listID uint) error {
+	var list models.ReadingList
+	if err := s.db.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+		return ErrListNotFound
+	}
+	if list.IsFavorites {
+		return ErrFavoritesList
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", list.ID).Delete(&models.ReadingListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&list).Error
+	})
+}
+
+func (s *ReadingListService) AddBook(userID uint, listID uint, bookID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var list models.ReadingList
+		if err := tx.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+			return ErrListNotFound
+		}
+		return addListBook(tx, list.ID, bookID)
+	})
+}
+
+func addListBook(tx *gorm.DB, listID uint, bookID uint) error {
+	var count int64
+	if err := tx.Model(&models.Book{}).Where("id = ?", bookID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBookNotFound
+	}
+	var maxPosition *int
+	if err := tx.Model(&models.ReadingListItem{}).Where("list_id = ?", listID).Select("MAX(position)").Scan(&maxPosition).Error; err != nil {
+		return err
+	}
+	item := models.ReadingListItem{ListID: listID, BookID: bookID, Position: 1}
+	if maxPosition != nil {
+		item.Position = *maxPosition + 1
+	}
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error
+}
+
+func (s *ReadingListService) RemoveBook(userID uint, listID uint, bookID uint) error {
+	var list models.ReadingList
+	if err := s.db.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+		return ErrListNotFound
+	}
+	result := s.db.Where("list_id = ? AND book_id = ?", list.ID, bookID).Delete(&models.ReadingListItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBookNotInList
+	}
+	return nil
+}
+
+func (s *ReadingListService) Reorder(userID uint, listID uint, bookIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var list models.ReadingList
+		if err := tx.Where("id = ? AND user_id = ?", listID, userID).First(&list).Error; err != nil {
+			return ErrListNotFound
+		}
+		var count int64
+		if err := tx.Model(&models.ReadingListItem{}).Where("list_id = ?", list.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(bookIDs) || len(uniqueIDs(bookIDs)) != len(bookIDs) {
+			return ErrInvalidListOrder
+		}
+		for i, bookID := range bookIDs {
+			result := tx.Model(&models.ReadingListItem{}).Where("list_id = ? AND book_id = ?", list.ID, bookID).Update("position", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrBookNotInList
+			}
+		}
+		return nil
+	})
+}
+
+func (s *ReadingListService) AddFavorite(userID uint, bookID uint) error {
+	list, err := s.Favorites(userID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return addListBook(tx, list.ID, bookID)
+	})
+}
+
+func (s *ReadingListService) RemoveFavorite(userID uint, bookID uint) error {
+	list, err := s.Favorites(userID)
+	if err != nil {
+		return err
+	}
+	return s.RemoveBook(userID, list.ID, bookID)
+}
+
+func (s *ReadingListService) MarkFavorites(userID uint, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	var favorites []uint
+	err := s.db.Model(&models.ReadingListItem{}).
+		Joins("JOIN reading_lists l ON l.id = reading_list_items.list_id").
+		Where("l.user_id = ? AND l.is_favorites AND reading_list_items.book_id IN ?", userID, ids).
+		Pluck("reading_list_items.book_id", &favorites).Error
+	if err != nil {
+		return err
+	}
+	marked := make(map[uint]bool, len(favorites))
+	for _, id := range favorites {
+		marked[id] = true
+	}
+	for i := range books {
+		favorite := marked[books[i].ID]
+		books[i].IsFavorite = &favorite
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const (
+	RegistrationDisabled   = "disabled"
+	RegistrationInvite     = "invite"
+	RegistrationEnrollment = "enrollment"
+
+	registrationResendAfter = time.Minute
+)
+
+var (
+	ErrRegistrationDisabled    = errors.New("self-registration is disabled")
+	ErrDNIRegistered           = errors.New("dni is already registered")
+	ErrInviteRequired          = errors.New("an invitation code is required")
+	ErrInvalidInvite           = errors.New("invalid or expired invitation code")
+	ErrInviteNotFound          = errors.New("invitation not found")
+	ErrNotInRoster             = errors.New("dni is not in a pending enrollment list")
+	ErrEmailRequired           = errors.New("an institutional email is required")
+	ErrEmailDomain             = errors.New("email must belong to an institutional domain")
+	ErrRegistrationCooldown    = errors.New("a verification code was sent recently, try again in a minute")
+	ErrRegistrationPending     = errors.New("a registration for this dni is already awaiting verification")
+	ErrInvalidVerificationCode = errors.New("invalid or expired verification code")
+	ErrInvalidMaxUses          = errors.New("max_uses must be at least 1")
+)
+
+type RegistrationRequest struct {
+	DNI        string
+	FullName   string
+	Email      string
+	Locale     string
+	Password   string
+	InviteCode string
+}
+
+type RegistrationChallenge struct {
+	DNI       string    `json:"dni"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type registrationNotice struct {
+	FullName string
+	DNI      string
+	Code     string
+	Minutes  int
+}
+
+type RegistrationService struct {
+	db          *gorm.DB
+	users       *repositories.UserRepository
+	mail        *MailService
+	enrollments *EnrollmentService
+	dni         *DNIFormat
+	mode        string
+	domains     []string
+	codeTTL     time.Duration
+	maxAttempts int
+}
+
+func NewRegistrationService(db *gorm.DB, users *repositories.UserRepository, mail *MailService, enrollments *EnrollmentService, dni *DNIFormat, cfg *config.Config) (*RegistrationService, error) {
+	mode := strings.ToLower(strings.TrimSpace(cfg.RegistrationMode))
+	switch mode {
+	case RegistrationDisabled, RegistrationInvite, RegistrationEnrollment:
+	default:
+		return nil, fmt.Errorf("unknown registration mode %q", cfg.RegistrationMode)
+	}
+
+	domains := make([]string, 0, len(cfg.RegistrationEmailDomains))
+	for _, domain := range cfg.RegistrationEmailDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if mode != RegistrationDisabled && len(domains) == 0 {
+		return nil, fmt.Errorf("REGISTRATION_EMAIL_DOMAINS is required when REGISTRATION_MODE is %q", mode)
+	}
+	codeTTL := cfg.RegistrationCodeTTL
+	if codeTTL <= 0 {
+		codeTTL = 15 * time.Minute
+	}
+	maxAttempts := cfg.RegistrationMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	return &RegistrationService{
+		db:          db,
+		users:       users,
+		mail:        mail,
+		enrollments: enrollments,
+		dni:         dni,
+		mode:        mode,
+		domains:     domains,
+		codeTTL:     codeTTL,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+func (s *RegistrationService) Mode() string {
+	return s.mode
+}
+
+func (s *RegistrationService) Start(request RegistrationRequest) (*RegistrationChallenge, error) {
+	if s.mode == RegistrationDisabled {
+		return nil, ErrRegistrationDisabled
+	}
+	dni, err := s.dni.Normalize(request.DNI)
+	if err != nil {
+		return nil, err
+	}
+	if len(request.Password) < minPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	if _, err := s.users.FindByDNI(dni); err == nil {
+		return nil, ErrDNIRegistered
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	trustedEmail := false
+	var inviteID *uint
+	switch s.mode {
+	case RegistrationInvite:
+		invite, err := s.findInvite(s.db, request.InviteCode)
+		if err != nil {
+			return nil, err
+		}
+		inviteID = &invite.ID
+		if invite.Email != "" {
+			email, trustedEmail = invite.Email, true
+		}
+	case RegistrationEnrollment:
+		pending, err := s.enrollments.FindPendingByDNI(dni)
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) == 0 {
+			return nil, ErrNotInRoster
+		}
+		email = ""
+		for _, entry := range pending {
+			if entry.Email != "" {
+				email, trustedEmail = entry.Email, true
+				break
+			}
+		}
+	}
+	if email == "" {
+		return nil, ErrEmailRequired
+	}
+	if !trustedEmail && !s.allowedEmail(email) {
+		return nil, ErrEmailDomain
+	}
+
+	hashed, err := utils.HashPassword(request.Password)
+	if err != nil {
+		return nil, err
+	}
+	code, err := newVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pending := &models.PendingRegistration{
+		DNI:          dni,
+		FullName:     strings.TrimSpace(request.FullName),
+		Email:        email,
+		Locale:       request.Locale,
+		PasswordHash: hashed,
+		InviteID:     inviteID,
+		CodeHash:     utils.HashToken(code),
+		ExpiresAt:    now.Add(s.codeTTL),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var previous models.PendingRegistration
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("dni = ?", dni).First(&previous).Error
+		if err == nil {
+			if previous.ExpiresAt.After(now) && previous.Email != email {
+				return ErrRegistrationPending
+			}
+			if now.Sub(previous.CreatedAt) < registrationResendAfter {
+				return ErrRegistrationCooldown
+			}
+			if err := tx.Delete(&previous).Error; err != nil {
+				return err
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Create(pending).Error; err != nil {
+			return err
+		}
+		return s.mail.Enqueue(tx, email, "registration_code", pending.Locale, registrationNotice{
+			FullName: pending.FullName,
+			DNI:      dni,
+			Code:     code,
+			Minutes:  int(s.codeTTL.Round(time.Minute).Minutes()),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegistrationChallenge{DNI: dni, Email: maskEmail(email), ExpiresAt: pending.ExpiresAt}, nil
+}
+
+func (s *RegistrationService) Verify(dni, code string) (*models.User, error) {
+	if s.mode == RegistrationDisabled {
+		return nil, ErrRegistrationDisabled
+	}
+	dni, err := s.dni.Normalize(dni)
+	if err != nil {
+		return nil, ErrInvalidVerificationCode
+	}
+	code = strings.TrimSpace(code)
+
+	var user *models.User
+	invalidCode := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var pending models.PendingRegistration
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("dni = ? AND expires_at > ?", dni, time.Now()).
+			First(&pending).Error; err != nil {
+			return ErrInvalidVerificationCode
+		}
+
+		if subtle.ConstantTimeCompare([]byte(pending.CodeHash), []byte(utils.HashToken(code))) != 1 {
+			invalidCode = true
+			if pending.Attempts+1 >= s.maxAttempts {
+				return tx.Delete(&pending).Error
+			}
+			return tx.Model(&pending).Update("attempts", pending.Attempts+1).Error
+		}
+
+		var count int64
+		if err := tx.Model(&models.User{}).Where("dni = ?", dni).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			if err := tx.Delete(&pending).Error; err != nil {
+				return err
+			}
+			return ErrDNIRegistered
+		}
+
+		if s.mode == RegistrationInvite {
+			if pending.InviteID == nil {
+				return ErrInvalidInvite
+			}
+			if err := s.useInvite(tx, *pending.InviteID); err != nil {
+				return err
+			}
+		}
+
+		user = &models.User{
+			DNI:          pending.DNI,
+			FullName:     pending.FullName,
+			Email:        pending.Email,
+			Locale:       pending.Locale,
+			PasswordHash: pending.PasswordHash,
+			Role:         models.RoleStudent,
+			IsActive:     true,
+			AuthSource:   models.AuthSourceLocal,
+		}
+		if err := s.users.WithTx(tx).Create(user); err != nil {
+			return err
+		}
+		claimed, err := s.enrollments.ClaimPending(tx, user)
+		if err != nil {
+			return err
+		}
+		if s.mode == RegistrationEnrollment && claimed == 0 {
+			return ErrNotInRoster
+		}
+		if err := tx.Delete(&pending).Error; err != nil {
+			return err
+		}
+		return s.mail.Enqueue(tx, user.Email, "welcome", user.Locale, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if invalidCode {
+		return nil, ErrInvalidVerificationCode
+	}
+	return user, nil
+}
+
+func (s *RegistrationService) CreateInvite(email string, maxUses int, expiresAt *time.Time, createdBy uint) (string, *models.RegistrationInvite, error) {
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if maxUses < 0 {
+		return "", nil, ErrInvalidMaxUses
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return "", nil, err
+	}
+	invite := &models.RegistrationInvite{
+		CodeHash:    utils.HashToken(normalizeInviteCode(code)),
+		Email:       strings.ToLower(strings.TrimSpace(email)),
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+		CreatedByID: createdBy,
+	}
+	if err := s.db.Create(invite).Error; err != nil {
+		return "", nil, err
+	}
+	return code, invite, nil
+}
+
+func (s *RegistrationService) ListInvites() ([]models.RegistrationInvite, error) {
+	var invites []models.RegistrationInvite
+	if err := s.db.Order("created_at DESC").Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s *RegistrationService) RevokeInvite(id uint) error {
+	result := s.db.Model(&models.RegistrationInvite{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+func (s *RegistrationService) findInvite(db *gorm.DB, code string) (*models.RegistrationInvite, error) {
+	code = normalizeInviteCode(code)
+	if code == "" {
+		return nil, ErrInviteRequired
+	}
+	var invite models.RegistrationInvite
+	if err := db.Where("code_hash = ?", utils.HashToken(code)).First(&invite).Error; err != nil {
+		return nil, ErrInvalidInvite
+	}
+	if !inviteUsable(&invite) {
+		return nil, ErrInvalidInvite
+	}
+	return &invite, nil
+}
+
+func (s *RegistrationService) useInvite(tx *gorm.DB, id uint) error {
+	var invite models.RegistrationInvite
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invite, id).Error; err != nil {
+		return ErrInvalidInvite
+	}
+	if !inviteUsable(&invite) {
+		return ErrInvalidInvite
+	}
+	return tx.Model(&invite).Update("uses", invite.Uses+1).Error
+}
+
+func (s *RegistrationService) allowedEmail(email string) bool {
+	_, domain, found := strings.Cut(email, "@")
+	if !found || domain == "" || strings.Contains(domain, "@") {
+		return false
+	}
+	for _, allowed := range s.domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func inviteUsable(invite *models.RegistrationInvite) bool {
+	if invite.RevokedAt != nil || invite.Uses >= invite.MaxUses {
+		return false
+	}
+	return invite.ExpiresAt == nil || invite.ExpiresAt.After(time.Now())
+}
+
+func newVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+	return encoded[:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16], nil
+}
+
+func normalizeInviteCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return email
+	}
+	return local[:1] + strings.Repeat("*", max(len(local)-1, 3)) + "@" + domain
+}
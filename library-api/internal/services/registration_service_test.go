@@ -0,0 +1,230 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/internal/repositories"
+)
+
+var registrationCodePattern = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+type registrationFixture struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func newRegistrationFixture(t *testing.T, mode string) *registrationFixture {
+	t.Helper()
+	return &registrationFixture{
+		db: newTestDB(t, &models.User{}, &models.PendingRegistration{}, &models.RegistrationInvite{},
+			&models.AcademicPeriod{}, &models.PendingEnrollment{}, &models.Enrollment{}, &models.OutboxEmail{}),
+		cfg: &config.Config{
+			RegistrationMode:         mode,
+			RegistrationEmailDomains: []string{"@Universidad.edu.pe"},
+			MailFrom:                 "Biblioteca <no-reply@biblioteca.local>",
+			MailLocale:               "es",
+		},
+	}
+}
+
+func (f *registrationFixture) service(t *testing.T) *RegistrationService {
+	t.Helper()
+	mail, err := NewMailService(f.db, NewMemoryTransport(), f.cfg)
+	if err != nil {
+		t.Fatalf("mail service: %v", err)
+	}
+	dni, err := NewDNIFormat(`^[0-9]{8}$`)
+	if err != nil {
+		t.Fatalf("dni format: %v", err)
+	}
+	service, err := NewRegistrationService(f.db, repositories.NewUserRepository(f.db), mail, NewEnrollmentService(f.db, dni), dni, f.cfg)
+	if err != nil {
+		t.Fatalf("registration service: %v", err)
+	}
+	return service
+}
+
+func (f *registrationFixture) roster(t *testing.T, dni string, email string) {
+	t.Helper()
+	period := models.AcademicPeriod{Name: "2026-II", StartDate: time.Now().AddDate(0, -1, 0), EndDate: time.Now().AddDate(0, 3, 0)}
+	if err := f.db.FirstOrCreate(&period, models.AcademicPeriod{Name: period.Name}).Error; err != nil {
+		t.Fatalf("create period: %v", err)
+	}
+	if err := f.db.Create(&models.PendingEnrollment{PeriodID: period.ID, DNI: dni, FullName: "Ana Torres", Email: email}).Error; err != nil {
+		t.Fatalf("create roster entry: %v", err)
+	}
+}
+
+func (f *registrationFixture) lastCode(t *testing.T, to string) string {
+	t.Helper()
+	var email models.OutboxEmail
+	if err := f.db.Where("recipient = ? AND template = ?", to, "registration_code").Order("id DESC").First(&email).Error; err != nil {
+		t.Fatalf("no registration code sent to %s: %v", to, err)
+	}
+	code := registrationCodePattern.FindString(email.TextBody)
+	if code == "" {
+		t.Fatalf("no code in %q", email.TextBody)
+	}
+	return code
+}
+
+func (f *registrationFixture) agePending(t *testing.T, dni string, age time.Duration, expired bool) {
+	t.Helper()
+	updates := map[string]any{"created_at": time.Now().Add(-age)}
+	if expired {
+		updates["expires_at"] = time.Now().Add(-time.Second)
+	}
+	if err := f.db.Model(&models.PendingRegistration{}).Where("dni = ?", dni).Updates(updates).Error; err != nil {
+		t.Fatalf("age pending registration: %v", err)
+	}
+}
+
+func registrationRequest(dni string, email string) RegistrationRequest {
+	return RegistrationRequest{DNI: dni, FullName: "Ana Torres", Email: email, Locale: "es", Password: "contrasena-segura"}
+}
+
+func TestRegistrationRequiresEmailDomains(t *testing.T) {
+	for _, mode := range []string{RegistrationInvite, RegistrationEnrollment} {
+		f := newRegistrationFixture(t, mode)
+		f.cfg.RegistrationEmailDomains = []string{" ", "@"}
+		if _, err := NewRegistrationService(f.db, repositories.NewUserRepository(f.db), nil, nil, nil, f.cfg); err == nil {
+			t.Fatalf("%s: expected error without REGISTRATION_EMAIL_DOMAINS", mode)
+		}
+	}
+
+	f := newRegistrationFixture(t, RegistrationDisabled)
+	f.cfg.RegistrationEmailDomains = nil
+	if _, err := NewRegistrationService(f.db, repositories.NewUserRepository(f.db), nil, nil, nil, f.cfg); err != nil {
+		t.Fatalf("disabled mode must not need domains: %v", err)
+	}
+
+	f.cfg.RegistrationMode = "open"
+	if _, err := NewRegistrationService(f.db, repositories.NewUserRepository(f.db), nil, nil, nil, f.cfg); err == nil {
+		t.Fatal("expected error for removed open mode")
+	}
+}
+
+func TestRegistrationEnrollmentSendsCodeToRosterEmail(t *testing.T) {
+	f := newRegistrationFixture(t, RegistrationEnrollment)
+	f.roster(t, "12345678", "ana.torres@universidad.edu.pe")
+	service := f.service(t)
+
+	challenge, err := service.Start(registrationRequest("12345678", "intruso@universidad.edu.pe"))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if challenge.Email != maskEmail("ana.torres@universidad.edu.pe") {
+		t.Fatalf("code must go to the roster email, got %s", challenge.Email)
+	}
+	var leaked int64
+	f.db.Model(&models.OutboxEmail{}).Where("recipient = ?", "intruso@universidad.edu.pe").Count(&leaked)
+	if leaked != 0 {
+		t.Fatal("code sent to the applicant's email")
+	}
+
+	user, err := service.Verify("12345678", f.lastCode(t, "ana.torres@universidad.edu.pe"))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if user.Email != "ana.torres@universidad.edu.pe" || user.Role != models.RoleStudent {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	var enrollments int64
+	f.db.Model(&models.Enrollment{}).Where("user_id = ?", user.ID).Count(&enrollments)
+	if enrollments != 1 {
+		t.Fatalf("expected roster entry claimed, got %d enrollments", enrollments)
+	}
+}
+
+func TestRegistrationEnrollmentRequiresRosterEmail(t *testing.T) {
+	f := newRegistrationFixture(t, RegistrationEnrollment)
+	f.roster(t, "12345678", "")
+	service := f.service(t)
+
+	if _, err := service.Start(registrationRequest("12345678", "ana@universidad.edu.pe")); !errors.Is(err, ErrEmailRequired) {
+		t.Fatalf("expected ErrEmailRequired, got %v", err)
+	}
+	if _, err := service.Start(registrationRequest("87654321", "ana@universidad.edu.pe")); !errors.Is(err, ErrNotInRoster) {
+		t.Fatalf("expected ErrNotInRoster, got %v", err)
+	}
+	var pending int64
+	f.db.Model(&models.PendingRegistration{}).Count(&pending)
+	if pending != 0 {
+		t.Fatalf("expected no pending registrations, got %d", pending)
+	}
+}
+
+func TestRegistrationInviteChecksEmailDomain(t *testing.T) {
+	f := newRegistrationFixture(t, RegistrationInvite)
+	service := f.service(t)
+	code, _, err := service.CreateInvite("", 2, nil, 1)
+	if err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+
+	request := registrationRequest("12345678", "ana@gmail.com")
+	request.InviteCode = code
+	if _, err := service.Start(request); !errors.Is(err, ErrEmailDomain) {
+		t.Fatalf("expected ErrEmailDomain, got %v", err)
+	}
+	request.Email = "ana@universidad.edu.pe"
+	request.InviteCode = ""
+	if _, err := service.Start(request); !errors.Is(err, ErrInviteRequired) {
+		t.Fatalf("expected ErrInviteRequired, got %v", err)
+	}
+	request.InviteCode = code
+	if _, err := service.Start(request); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+}
+
+func TestRegistrationKeepsPendingRequestForAnotherEmail(t *testing.T) {
+	f := newRegistrationFixture(t, RegistrationInvite)
+	service := f.service(t)
+	code, _, err := service.CreateInvite("", 5, nil, 1)
+	if err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+	start := func(email string) error {
+		request := registrationRequest("12345678", email)
+		request.InviteCode = code
+		_, err := service.Start(request)
+		return err
+	}
+
+	if err := start("ana@universidad.edu.pe"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := start("ana@universidad.edu.pe"); !errors.Is(err, ErrRegistrationCooldown) {
+		t.Fatalf("expected ErrRegistrationCooldown, got %v", err)
+	}
+
+	f.agePending(t, "12345678", 2*time.Minute, false)
+	if err := start("otro@universidad.edu.pe"); !errors.Is(err, ErrRegistrationPending) {
+		t.Fatalf("expected ErrRegistrationPending, got %v", err)
+	}
+	var pending models.PendingRegistration
+	if err := f.db.Where("dni = ?", "12345678").First(&pending).Error; err != nil || pending.Email != "ana@universidad.edu.pe" {
+		t.Fatalf("pending registration replaced: %+v, %v", pending, err)
+	}
+
+	if err := start("ana@universidad.edu.pe"); err != nil {
+		t.Fatalf("resend to the same email: %v", err)
+	}
+
+	f.agePending(t, "12345678", 2*time.Minute, true)
+	if err := start("otro@universidad.edu.pe"); err != nil {
+		t.Fatalf("expired registration must be replaceable: %v", err)
+	}
+	var replaced models.PendingRegistration
+	if err := f.db.Where("dni = ?", "12345678").First(&replaced).Error; err != nil || replaced.Email != "otro@universidad.edu.pe" {
+		t.Fatalf("expected new pending registration, got %+v, %v", replaced, err)
+	}
+}
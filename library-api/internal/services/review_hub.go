@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+const (
+	reviewEventsChannel     = "review_events"
+	reviewSubscriberBuffer  = 16
+	reviewListenRetryPeriod = 5 * time.Second
+)
+
+const (
+	ReviewCreated = "review.created"
+	ReviewUpdated = "review.updated"
+	ReviewHidden  = "review.hidden"
+)
+
+type ReviewEvent struct {
+	Type     string `json:"type"`
+	BookID   uint   `json:"book_id"`
+	ReviewID uint   `json:"review_id"`
+}
+
+type ReviewStreamMessage struct {
+	Type   string      `json:"type"`
+	Review *ReviewNode `json:"review"`
+}
+
+type ReviewSubscription struct {
+	BookID   uint
+	Messages chan ReviewStreamMessage
+}
+
+type ReviewHub struct {
+	db          *gorm.DB
+	dsn         string
+	mu          sync.RWMutex
+	subscribers map[uint]map[*ReviewSubscription]struct{}
+}
+
+func NewReviewHub(db *gorm.DB, dsn string) *ReviewHub {
+	return &ReviewHub{
+		db:          db,
+		dsn:         dsn,
+		subscribers: make(map[uint]map[*ReviewSubscription]struct{}),
+	}
+}
+
+func (h *ReviewHub) Subscribe(bookID uint) *ReviewSubscription {
+	sub := &ReviewSubscription{BookID: bookID, Messages: make(chan ReviewStreamMessage, reviewSubscriberBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[bookID] == nil {
+		h.subscribers[bookID] = make(map[*ReviewSubscription]struct{})
+	}
+	h.subscribers[bookID][sub] = struct{}{}
+	return sub
+}
+
+func (h *ReviewHub) Unsubscribe(sub *ReviewSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+func (h *ReviewHub) remove(sub *ReviewSubscription) {
+	subs, ok := h.subscribers[sub.BookID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.Messages)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.BookID)
+	}
+}
+
+func (h *ReviewHub) Notify(tx *gorm.DB, event ReviewEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", reviewEventsChannel, string(payload)).Error
+}
+
+func (h *ReviewHub) Listen(ctx context.Context) {
+	for {
+		err := h.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("review hub: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reviewListenRetryPeriod):
+		}
+	}
+}
+
+func (h *ReviewHub) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, h.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+reviewEventsChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event ReviewEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			continue
+		}
+		h.dispatch(event)
+	}
+}
+
+func (h *ReviewHub) dispatch(event ReviewEvent) {
+	h.mu.RLock()
+	listeners := len(h.subscribers[event.BookID])
+	h.mu.RUnlock()
+	if listeners == 0 {
+		return
+	}
+
+	var review models.Review
+	if err := h.db.First(&review, event.ReviewID).Error; err != nil {
+		log.Printf("review hub: load review %d: %v", event.ReviewID, err)
+		return
+	}
+	h.broadcast(event.BookID, ReviewStreamMessage{Type: event.Type, Review: newReviewNode(review)})
+}
+
+func (h *ReviewHub) broadcast(bookID uint, message ReviewStreamMessage) {
+	var slow []*ReviewSubscription
+
+	h.mu.RLock()
+	for sub := range h.subscribers[bookID] {
+		select {
+		case sub.Messages <- message:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+	h.mu.Lock()
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+	h.mu.Unlock()
+}
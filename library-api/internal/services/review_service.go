@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -18,16 +19,25 @@ type ReviewNode struct {
 	Comment      string        `json:"comment"`
 	DisplayName  string        `json:"display_name"`
 	AvatarURL    string        `json:"avatar_url"`
+	IsHidden     bool          `json:"is_hidden"`
 	CreatedAt    int64         `json:"created_at"`
+	EditedAt     *int64        `json:"edited_at,omitempty"`
 	Children     []*ReviewNode `json:"children"`
 }
 
+const bookRatingUpdate = `UPDATE books SET
+	rating = COALESCE((SELECT ROUND(AVG(r.rating)::numeric, 2) FROM reviews r
+		WHERE r.book_id = books.id AND r.parent_id IS NULL AND r.rating IS NOT NULL AND r.is_hidden = false AND r.deleted_at IS NULL), 0),
+	rating_count = (SELECT COUNT(*) FROM reviews r
+		WHERE r.book_id = books.id AND r.parent_id IS NULL AND r.rating IS NOT NULL AND r.is_hidden = false AND r.deleted_at IS NULL)`
+
 type ReviewService struct {
-	db *gorm.DB
+	db  *gorm.DB
+	hub *ReviewHub
 }
 
-func NewReviewService(db *gorm.DB) *ReviewService {
-	return &ReviewService{db: db}
+func NewReviewService(db *gorm.DB, hub *ReviewHub) *ReviewService {
+	return &ReviewService{db: db, hub: hub}
 }
 
 func (s *ReviewService) Create(review *models.Review, maxDepth int) error {
@@ -53,7 +63,91 @@ func (s *ReviewService) Create(review *models.Review, maxDepth int) error {
 			return errors.New("max comment depth exceeded")
 		}
 	}
-	return s.db.Create(review).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		if review.Rating != nil {
+			if err := refreshBookRating(tx, review.BookID); err != nil {
+				return err
+			}
+		}
+		return s.hub.Notify(tx, ReviewEvent{Type: ReviewCreated, BookID: review.BookID, ReviewID: review.ID})
+	})
+}
+
+func (s *ReviewService) Update(bookID uint, reviewID uint, userID uint, comment string, rating *int) (*models.Review, error) {
+	var review models.Review
+	if err := s.db.Where("id = ? AND book_id = ?", reviewID, bookID).First(&review).Error; err != nil {
+		return nil, err
+	}
+	if review.UserID != userID {
+		return nil, errors.New("only the author can edit this review")
+	}
+	if review.IsHidden {
+		return nil, errors.New("review is hidden")
+	}
+	if rating != nil && review.ParentID != nil {
+		return nil, errors.New("rating allowed only on root comments")
+	}
+
+	now := time.Now()
+	updates := map[string]any{"comment": comment, "edited_at": now}
+	if rating != nil {
+		updates["rating"] = *rating
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&review).Updates(updates).Error; err != nil {
+			return err
+		}
+		if rating != nil {
+			if err := refreshBookRating(tx, review.BookID); err != nil {
+				return err
+			}
+		}
+		return s.hub.Notify(tx, ReviewEvent{Type: ReviewUpdated, BookID: review.BookID, ReviewID: review.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (s *ReviewService) SetHidden(reviewID uint, hidden bool) (*models.Review, error) {
+	var review models.Review
+	if err := s.db.First(&review, reviewID).Error; err != nil {
+		return nil, err
+	}
+
+	eventType := ReviewUpdated
+	if hidden {
+		eventType = ReviewHidden
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&review).Update("is_hidden", hidden).Error; err != nil {
+			return err
+		}
+		if review.Rating != nil {
+			if err := refreshBookRating(tx, review.BookID); err != nil {
+				return err
+			}
+		}
+		return s.hub.Notify(tx, ReviewEvent{Type: eventType, BookID: review.BookID, ReviewID: review.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (s *ReviewService) RefreshRatings() error {
+	return s.db.Exec(bookRatingUpdate + " WHERE books.deleted_at IS NULL").Error
+}
+
+func refreshBookRating(tx *gorm.DB, bookID uint) error {
+	return tx.Exec(bookRatingUpdate+" WHERE books.id = ?", bookID).Error
 }
 
 func (s *ReviewService) getDepth(review *models.Review, maxDepth int) (int, error) {
@@ -81,20 +175,7 @@ func (s *ReviewService) ListTree(bookID uint) ([]ReviewNode, error) {
 
 	nodes := make(map[uint]*ReviewNode, len(reviews))
 	for _, review := range reviews {
-		node := ReviewNode{
-			ID:           review.ID,
-			BookID:       review.BookID,
-			ParentID:     review.ParentID,
-			UserID:       review.UserID,
-			EnrollmentID: review.EnrollmentID,
-			Rating:       review.Rating,
-			Comment:      review.Comment,
-			DisplayName:  review.DisplayName,
-			AvatarURL:    review.AvatarURL,
-			CreatedAt:    review.CreatedAt.Unix(),
-			Children:     []*ReviewNode{},
-		}
-		nodes[review.ID] = &node
+		nodes[review.ID] = newReviewNode(review)
 	}
 
 	for _, review := range reviews {
@@ -119,3 +200,29 @@ func (s *ReviewService) ListTree(bookID uint) ([]ReviewNode, error) {
 
 	return roots, nil
 }
+
+func newReviewNode(review models.Review) *ReviewNode {
+	node := &ReviewNode{
+		ID:           review.ID,
+		BookID:       review.BookID,
+		ParentID:     review.ParentID,
+		UserID:       review.UserID,
+		EnrollmentID: review.EnrollmentID,
+		Rating:       review.Rating,
+		Comment:      review.Comment,
+		DisplayName:  review.DisplayName,
+		AvatarURL:    review.AvatarURL,
+		IsHidden:     review.IsHidden,
+		CreatedAt:    review.CreatedAt.Unix(),
+		Children:     []*ReviewNode{},
+	}
+	if review.EditedAt != nil {
+		editedAt := review.EditedAt.Unix()
+		node.EditedAt = &editedAt
+	}
+	if review.IsHidden {
+		node.Comment = ""
+		node.Rating = nil
+	}
+	return node
+}
@@ -61,3 +61,11 @@ func (s *S3Service) PresignGetURL(ctx context.Context, key string, expires time.
 
 	return result.URL, nil
 }
+
+func (s *S3Service) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	return err
+}
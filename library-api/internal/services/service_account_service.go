@@ -0,0 +1,302 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const (
+	apiKeyPrefixLength = len(utils.APIKeyPrefix) + 8
+	apiKeyTouchEvery   = time.Minute
+)
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountName     = errors.New("name is required")
+	ErrServiceAccountExists   = errors.New("service account name already in use")
+	ErrServiceAccountInactive = errors.New("service account is inactive")
+	ErrInvalidUserRole        = errors.New("role must be ADMIN, TEACHER or STUDENT")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+	ErrAPIKeyRevoked          = errors.New("api key already revoked")
+	ErrInvalidAPIKey          = errors.New("invalid api key")
+	ErrInvalidAPIScope        = errors.New("scopes must look like area:read, area:write, area:* or *")
+	ErrInvalidExpiry          = errors.New("expires_at must be in the future")
+)
+
+var apiScopePattern = regexp.MustCompile(`^(\*|[a-z][a-z-]*:(read|write|\*))$`)
+
+type APIPrincipal struct {
+	AccountID uint
+	KeyID     uint
+	Role      models.Role
+	Scopes    []string
+}
+
+type ServiceAccountService struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountService(db *gorm.DB) *ServiceAccountService {
+	return &ServiceAccountService{db: db}
+}
+
+func ValidRole(role models.Role) bool {
+	return role == models.RoleAdmin || role == models.RoleTeacher || role == models.RoleStudent
+}
+
+func NormalizeAPIScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !apiScopePattern.MatchString(scope) {
+			return nil, ErrInvalidAPIScope
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidAPIScope
+	}
+	return normalized, nil
+}
+
+func (s *ServiceAccountService) Create(name, description string, role models.Role, createdBy uint) (*models.ServiceAccount, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrServiceAccountName
+	}
+	if role == "" {
+		role = models.RoleStudent
+	}
+	if !ValidRole(role) {
+		return nil, ErrInvalidUserRole
+	}
+
+	var count int64
+	if err := s.db.Model(&models.ServiceAccount{}).Where("LOWER(name) = LOWER(?)", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrServiceAccountExists
+	}
+
+	account := &models.ServiceAccount{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Role:        role,
+		IsActive:    true,
+		CreatedByID: createdBy,
+	}
+	if err := s.db.Create(account).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *ServiceAccountService) List() ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	err := s.db.Preload("Keys", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC")
+	}).Order("name ASC").Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (s *ServiceAccountService) FindByID(id uint) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := s.db.Preload("Keys", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC")
+	}).First(&account, id).Error
+	if err != nil {
+		return nil, ErrServiceAccountNotFound
+	}
+	return &account, nil
+}
+
+func (s *ServiceAccountService) Deactivate(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ServiceAccount{}).Where("id = ?", id).Update("is_active", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrServiceAccountNotFound
+		}
+		return tx.Model(&models.APIKey{}).
+			Where("service_account_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (s *ServiceAccountService) CreateKey(accountID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	scopes, err := NormalizeAPIScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	var secret string
+	var key *models.APIKey
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := s.activeAccount(tx, accountID); err != nil {
+			return err
+		}
+		secret, key, err = s.issueKey(tx, &models.APIKey{
+			ServiceAccountID: accountID,
+			Name:             strings.TrimSpace(name),
+			Scopes:           scopes,
+			ExpiresAt:        expiresAt,
+		})
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+func (s *ServiceAccountService) RotateKey(accountID, keyID uint, overlap time.Duration) (string, *models.APIKey, error) {
+	var secret string
+	var key *models.APIKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := s.activeAccount(tx, accountID); err != nil {
+			return err
+		}
+		var old models.APIKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND service_account_id = ?", keyID, accountID).
+			First(&old).Error; err != nil {
+			return ErrAPIKeyNotFound
+		}
+		now := time.Now()
+		if old.RevokedAt != nil || (old.ExpiresAt != nil && !old.ExpiresAt.After(now)) {
+			return ErrAPIKeyRevoked
+		}
+
+		var expiresAt *time.Time
+		if old.ExpiresAt != nil {
+			renewed := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+			expiresAt = &renewed
+		}
+		var err error
+		secret, key, err = s.issueKey(tx, &models.APIKey{
+			ServiceAccountID: accountID,
+			Name:             old.Name,
+			Scopes:           old.Scopes,
+			ExpiresAt:        expiresAt,
+			RotatedFromID:    &old.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if overlap <= 0 {
+			return tx.Model(&old).Update("revoked_at", now).Error
+		}
+		retireAt := now.Add(overlap)
+		if old.ExpiresAt != nil && old.ExpiresAt.Before(retireAt) {
+			return nil
+		}
+		return tx.Model(&old).Update("expires_at", retireAt).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+func (s *ServiceAccountService) RevokeKey(accountID, keyID uint) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND service_account_id = ? AND revoked_at IS NULL", keyID, accountID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *ServiceAccountService) Authenticate(secret, ip string) (*APIPrincipal, error) {
+	if !strings.HasPrefix(secret, utils.APIKeyPrefix) || len(secret) <= apiKeyPrefixLength+1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := s.db.Preload("ServiceAccount").Where("prefix = ?", secret[:apiKeyPrefixLength]).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(secret))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) || !key.ServiceAccount.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchEvery || key.LastUsedIP != ip {
+		if err := s.db.Model(&models.APIKey{}).Where("id = ?", key.ID).Updates(map[string]any{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &APIPrincipal{
+		AccountID: key.ServiceAccountID,
+		KeyID:     key.ID,
+		Role:      key.ServiceAccount.Role,
+		Scopes:    key.Scopes,
+	}, nil
+}
+
+func (s *ServiceAccountService) issueKey(tx *gorm.DB, key *models.APIKey) (string, *models.APIKey, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key.Prefix = utils.APIKeyPrefix + hex.EncodeToString(id)
+	secret := key.Prefix + "_" + random
+	key.KeyHash = utils.HashToken(secret)
+	if err := tx.Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+func (s *ServiceAccountService) activeAccount(tx *gorm.DB, id uint) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := tx.First(&account, id).Error; err != nil {
+		return nil, ErrServiceAccountNotFound
+	}
+	if !account.IsActive {
+		return nil, ErrServiceAccountInactive
+	}
+	return &account, nil
+}
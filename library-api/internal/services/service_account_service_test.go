@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+type serviceAccountFixture struct {
+	db      *gorm.DB
+	service *ServiceAccountService
+	account *models.ServiceAccount
+}
+
+func newServiceAccountFixture(t *testing.T) *serviceAccountFixture {
+	t.Helper()
+	db := newTestDB(t, &models.ServiceAccount{}, &models.APIKey{})
+	service := NewServiceAccountService(db)
+	account, err := service.Create(" catalogo-sync ", "", models.RoleTeacher, 1)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	return &serviceAccountFixture{db: db, service: service, account: account}
+}
+
+func (f *serviceAccountFixture) createKey(t *testing.T, scopes ...string) (string, *models.APIKey) {
+	t.Helper()
+	secret, key, err := f.service.CreateKey(f.account.ID, "integracion", scopes, nil)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	return secret, key
+}
+
+func (f *serviceAccountFixture) loadKey(t *testing.T, id uint) *models.APIKey {
+	t.Helper()
+	var key models.APIKey
+	if err := f.db.First(&key, id).Error; err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	return &key
+}
+
+func TestNormalizeAPIScopes(t *testing.T) {
+	scopes, err := NormalizeAPIScopes([]string{" Books:Read ", "books:read", "", "loans:*", "*"})
+	if err != nil || !reflect.DeepEqual(scopes, []string{"books:read", "loans:*", "*"}) {
+		t.Fatalf("unexpected scopes: %v, %v", scopes, err)
+	}
+	for _, invalid := range [][]string{nil, {" "}, {"books"}, {"books:delete"}, {"books:read:write"}, {"2fa:read"}} {
+		if _, err := NormalizeAPIScopes(invalid); !errors.Is(err, ErrInvalidAPIScope) {
+			t.Fatalf("%v: expected ErrInvalidAPIScope, got %v", invalid, err)
+		}
+	}
+}
+
+func TestServiceAccountAuthenticate(t *testing.T) {
+	f := newServiceAccountFixture(t)
+	secret, key := f.createKey(t, "books:read")
+
+	if !strings.HasPrefix(secret, key.Prefix+"_") || len(key.Prefix) != apiKeyPrefixLength {
+		t.Fatalf("unexpected key %q with prefix %q", secret, key.Prefix)
+	}
+	stored := f.loadKey(t, key.ID)
+	if stored.KeyHash != utils.HashToken(secret) || strings.Contains(stored.KeyHash, secret[apiKeyPrefixLength+1:]) {
+		t.Fatal("api key must be stored hashed")
+	}
+
+	principal, err := f.service.Authenticate(secret, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if principal.AccountID != f.account.ID || principal.KeyID != key.ID || principal.Role != models.RoleTeacher ||
+		!reflect.DeepEqual(principal.Scopes, []string{"books:read"}) {
+		t.Fatalf("unexpected principal: %+v", principal)
+	}
+	if stored := f.loadKey(t, key.ID); stored.LastUsedAt == nil || stored.LastUsedIP != "203.0.113.7" {
+		t.Fatalf("last use not recorded: %+v", stored)
+	}
+
+	invalid := []string{
+		"",
+		"Bearer " + secret,
+		utils.APIKeyPrefix,
+		key.Prefix + "_",
+		secret[:len(secret)-1] + "x",
+		strings.Replace(secret, key.Prefix, utils.APIKeyPrefix+"00000000", 1),
+	}
+	for _, candidate := range invalid {
+		if _, err := f.service.Authenticate(candidate, "203.0.113.7"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("%q: expected ErrInvalidAPIKey, got %v", candidate, err)
+		}
+	}
+}
+
+func TestServiceAccountAuthenticateRejectsRetiredKeys(t *testing.T) {
+	f := newServiceAccountFixture(t)
+	revoked, revokedKey := f.createKey(t, "*")
+	expired, expiredKey := f.createKey(t, "*")
+	active, _ := f.createKey(t, "*")
+
+	if err := f.service.RevokeKey(f.account.ID, revokedKey.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := f.service.RevokeKey(f.account.ID, revokedKey.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+	f.db.Model(&models.APIKey{}).Where("id = ?", expiredKey.ID).Update("expires_at", time.Now().Add(-time.Second))
+
+	for _, secret := range []string{revoked, expired} {
+		if _, err := f.service.Authenticate(secret, ""); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("expected ErrInvalidAPIKey, got %v", err)
+		}
+	}
+	if _, err := f.service.Authenticate(active, ""); err != nil {
+		t.Fatalf("active key: %v", err)
+	}
+
+	if err := f.service.Deactivate(f.account.ID); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if _, err := f.service.Authenticate(active, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("keys of inactive accounts must be rejected, got %v", err)
+	}
+	if _, _, err := f.service.CreateKey(f.account.ID, "", []string{"*"}, nil); !errors.Is(err, ErrServiceAccountInactive) {
+		t.Fatalf("expected ErrServiceAccountInactive, got %v", err)
+	}
+}
+
+func TestServiceAccountRotateKeyKeepsOverlap(t *testing.T) {
+	f := newServiceAccountFixture(t)
+	old, oldKey := f.createKey(t, "loans:write")
+
+	fresh, freshKey, err := f.service.RotateKey(f.account.ID, oldKey.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if freshKey.RotatedFromID == nil || *freshKey.RotatedFromID != oldKey.ID || !reflect.DeepEqual(freshKey.Scopes, oldKey.Scopes) {
+		t.Fatalf("unexpected rotated key: %+v", freshKey)
+	}
+	for _, secret := range []string{old, fresh} {
+		if _, err := f.service.Authenticate(secret, ""); err != nil {
+			t.Fatalf("both keys must work during the overlap: %v", err)
+		}
+	}
+	if retired := f.loadKey(t, oldKey.ID); retired.ExpiresAt == nil || retired.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("old key must expire after the overlap: %+v", retired)
+	}
+
+	_, _, err = f.service.RotateKey(f.account.ID, freshKey.ID, 0)
+	if err != nil {
+		t.Fatalf("rotate without overlap: %v", err)
+	}
+	if _, err := f.service.Authenticate(fresh, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("rotated key without overlap must be revoked, got %v", err)
+	}
+	if _, _, err := f.service.RotateKey(f.account.ID, freshKey.ID, 0); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Fatalf("expected ErrAPIKeyRevoked, got %v", err)
+	}
+}
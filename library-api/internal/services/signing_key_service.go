@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const (
+	signingKeyLockID      = 4049
+	signingKeyCheckEvery  = time.Minute
+	signingKeyReloadAfter = 10 * time.Second
+	minSigningKeyOverlap  = 24 * time.Hour
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyInUse    = errors.New("cannot revoke the current signing key, rotate first")
+	ErrNoSigningKey       = errors.New("no active signing key")
+)
+
+type loadedSigningKey struct {
+	key        *utils.SigningKey
+	activeFrom time.Time
+	expiresAt  *time.Time
+}
+
+type SigningKeyService struct {
+	db           *gorm.DB
+	algorithm    string
+	secret       string
+	rotation     time.Duration
+	publishAhead time.Duration
+	overlap      time.Duration
+
+	mu       sync.RWMutex
+	keys     []loadedSigningKey
+	loadedAt time.Time
+}
+
+func NewSigningKeyService(db *gorm.DB, cfg *config.Config) (*SigningKeyService, error) {
+	if cfg.JWTAlgorithm != utils.AlgorithmRS256 && cfg.JWTAlgorithm != utils.AlgorithmEdDSA {
+		return nil, utils.ErrUnsupportedAlgorithm
+	}
+	overlap := cfg.JWTKeyOverlap
+	if overlap < minSigningKeyOverlap {
+		overlap = minSigningKeyOverlap
+	}
+	publishAhead := cfg.JWTKeyPublishAhead
+	if publishAhead < 0 {
+		publishAhead = 0
+	}
+	return &SigningKeyService{
+		db:           db,
+		algorithm:    cfg.JWTAlgorithm,
+		secret:       cfg.SigningKeyEncryptionKey,
+		rotation:     cfg.JWTKeyRotation,
+		publishAhead: publishAhead,
+		overlap:      overlap,
+	}, nil
+}
+
+func (s *SigningKeyService) SigningKey() (*utils.SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, loaded := range s.keys {
+		if !loaded.activeFrom.After(now) && (loaded.expiresAt == nil || loaded.expiresAt.After(now)) {
+			return loaded.key, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+func (s *SigningKeyService) VerificationKey(kid string) (*utils.SigningKey, error) {
+	if key := s.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	s.mu.RLock()
+	stale := time.Since(s.loadedAt) >= signingKeyReloadAfter
+	s.mu.RUnlock()
+	if stale {
+		if err := s.Reload(); err != nil {
+			return nil, err
+		}
+		if key := s.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrSigningKeyNotFound
+}
+
+func (s *SigningKeyService) JWKS() []map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]map[string]string, 0, len(s.keys))
+	for _, loaded := range s.keys {
+		if loaded.expiresAt == nil || loaded.expiresAt.After(now) {
+			keys = append(keys, loaded.key.JWK())
+		}
+	}
+	return keys
+}
+
+func (s *SigningKeyService) List() ([]models.SigningKey, error) {
+	var records []models.SigningKey
+	if err := s.db.Order("active_from DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	current := ""
+	for _, record := range records {
+		if record.RevokedAt == nil && !record.ActiveFrom.After(now) && (record.ExpiresAt == nil || record.ExpiresAt.After(now)) {
+			current = record.ID
+			break
+		}
+	}
+	for i := range records {
+		record := &records[i]
+		switch {
+		case record.RevokedAt != nil:
+			record.Status = models.SigningKeyRevoked
+		case record.ExpiresAt != nil && !record.ExpiresAt.After(now):
+			record.Status = models.SigningKeyExpired
+		case record.ID == current:
+			record.Status = models.SigningKeyActive
+		case record.ActiveFrom.After(now):
+			record.Status = models.SigningKeyPending
+		default:
+			record.Status = models.SigningKeyRetiring
+		}
+	}
+	return records, nil
+}
+
+func (s *SigningKeyService) Maintain() error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLockID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var latest models.SigningKey
+		err := tx.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", now).
+			Order("active_from DESC").First(&latest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_, err = s.create(tx, now)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.rotation <= 0 || latest.ActiveFrom.After(now) || latest.ActiveFrom.Add(s.rotation-s.publishAhead).After(now) {
+			return nil
+		}
+		_, err = s.create(tx, now.Add(s.publishAhead))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Reload(); err != nil {
+		return err
+	}
+	if _, err := s.SigningKey(); err != nil {
+		log.Printf("signing key rotation: no usable signing key, rotating now")
+		_, err = s.Rotate()
+		return err
+	}
+	return nil
+}
+
+func (s *SigningKeyService) Rotate() (*models.SigningKey, error) {
+	var record *models.SigningKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLockID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Where("revoked_at IS NULL AND active_from > ?", now).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+		var err error
+		record, err = s.create(tx, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	record.Status = models.SigningKeyActive
+	return record, s.Reload()
+}
+
+func (s *SigningKeyService) Revoke(kid string) error {
+	current, err := s.SigningKey()
+	if err == nil && current.ID == kid {
+		return ErrSigningKeyInUse
+	}
+
+	result := s.db.Model(&models.SigningKey{}).Where("id = ? AND revoked_at IS NULL", kid).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSigningKeyNotFound
+	}
+	return s.Reload()
+}
+
+func (s *SigningKeyService) Reload() error {
+	now := time.Now()
+	var records []models.SigningKey
+	if err := s.db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", now).
+		Order("active_from DESC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	keys := make([]loadedSigningKey, 0, len(records))
+	for _, record := range records {
+		der, err := utils.Unseal(record.PrivateKey, s.secret)
+		if err != nil {
+			log.Printf("signing key %s: %v", record.ID, err)
+			continue
+		}
+		key, err := utils.ParseSigningKey(record.ID, record.Algorithm, der)
+		if err != nil {
+			log.Printf("signing key %s: %v", record.ID, err)
+			continue
+		}
+		keys = append(keys, loadedSigningKey{key: key, activeFrom: record.ActiveFrom, expiresAt: record.ExpiresAt})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].activeFrom.After(keys[j].activeFrom)
+	})
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = now
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SigningKeyService) RunRotation(ctx context.Context) {
+	ticker := time.NewTicker(signingKeyCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Maintain(); err != nil {
+			log.Printf("signing key rotation: %v", err)
+		}
+	}
+}
+
+func (s *SigningKeyService) lookup(kid string) *utils.SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, loaded := range s.keys {
+		if loaded.key.ID == kid && (loaded.expiresAt == nil || loaded.expiresAt.After(now)) {
+			return loaded.key
+		}
+	}
+	return nil
+}
+
+func (s *SigningKeyService) create(tx *gorm.DB, activeFrom time.Time) (*models.SigningKey, error) {
+	key, err := utils.GenerateSigningKey(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	der, err := key.MarshalPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := utils.Seal(der, s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&models.SigningKey{}).
+		Where("revoked_at IS NULL AND expires_at IS NULL").
+		Update("expires_at", activeFrom.Add(s.overlap)).Error; err != nil {
+		return nil, err
+	}
+
+	record := &models.SigningKey{
+		ID:         key.ID,
+		Algorithm:  key.Method.Alg(),
+		PrivateKey: sealed,
+		ActiveFrom: activeFrom,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
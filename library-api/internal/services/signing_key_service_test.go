@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const testSigningSecret = "signing-key-test-secret"
+
+func newTestSigningKeys(t *testing.T, db *gorm.DB, algorithm string, secret string) *SigningKeyService {
+	t.Helper()
+	service, err := NewSigningKeyService(db, &config.Config{JWTAlgorithm: algorithm, SigningKeyEncryptionKey: secret})
+	if err != nil {
+		t.Fatalf("signing key service: %v", err)
+	}
+	return service
+}
+
+func addSigningKey(t *testing.T, service *SigningKeyService, activeFrom time.Time) *models.SigningKey {
+	t.Helper()
+	record, err := service.create(service.db, activeFrom)
+	if err != nil {
+		t.Fatalf("create signing key: %v", err)
+	}
+	if err := service.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	return record
+}
+
+func testTokenSettings(keys utils.KeyStore) *utils.TokenSettings {
+	return &utils.TokenSettings{Keys: keys, Issuer: "http://localhost:3000", Audience: "library-api"}
+}
+
+func testClaims(settings *utils.TokenSettings) utils.Claims {
+	now := time.Now()
+	return utils.Claims{
+		UserID: 5,
+		Role:   string(models.RoleStudent),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    settings.Issuer,
+			Subject:   "5",
+			Audience:  jwt.ClaimStrings{settings.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti-1",
+		},
+	}
+}
+
+func signTestToken(t *testing.T, key *utils.SigningKey, kid string, claims utils.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed
+}
+
+func TestParseTokenAcceptsCurrentKey(t *testing.T) {
+	keys := newTestSigningKeys(t, newTestDB(t, &models.SigningKey{}), utils.AlgorithmEdDSA, testSigningSecret)
+	record := addSigningKey(t, keys, time.Now())
+	settings := testTokenSettings(keys)
+
+	token, err := utils.GenerateToken(5, string(models.RoleAdmin), 3, settings, time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	claims, err := utils.ParseToken(token, settings)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if claims.UserID != 5 || claims.Role != string(models.RoleAdmin) || claims.SessionVersion != 3 || claims.ID == "" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &utils.Claims{})
+	if err != nil || parsed.Header["kid"] != record.ID || parsed.Method.Alg() != utils.AlgorithmEdDSA {
+		t.Fatalf("unexpected header: %v, %v", parsed.Header, err)
+	}
+}
+
+func TestParseTokenRejectsForgedTokens(t *testing.T) {
+	keys := newTestSigningKeys(t, newTestDB(t, &models.SigningKey{}), utils.AlgorithmRS256, testSigningSecret)
+	record := addSigningKey(t, keys, time.Now())
+	settings := testTokenSettings(keys)
+	current, err := keys.SigningKey()
+	if err != nil {
+		t.Fatalf("current key: %v", err)
+	}
+	ed, err := utils.GenerateSigningKey(utils.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("eddsa key: %v", err)
+	}
+	foreign, err := utils.GenerateSigningKey(utils.AlgorithmRS256)
+	if err != nil {
+		t.Fatalf("rsa key: %v", err)
+	}
+
+	claims := testClaims(settings)
+	if _, err := utils.ParseToken(signTestToken(t, current, record.ID, claims), settings); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	with := func(change func(*utils.Claims)) utils.Claims {
+		changed := testClaims(settings)
+		change(&changed)
+		return changed
+	}
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = record.ID
+	hmacToken, err := hmac.SignedString([]byte(record.ID))
+	if err != nil {
+		t.Fatalf("sign hs256: %v", err)
+	}
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	none.Header["kid"] = record.ID
+	noneToken, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("sign none: %v", err)
+	}
+
+	cases := map[string]string{
+		"missing kid":        signTestToken(t, current, "", claims),
+		"unknown kid":        signTestToken(t, foreign, foreign.ID, claims),
+		"foreign key":        signTestToken(t, foreign, record.ID, claims),
+		"algorithm mismatch": signTestToken(t, ed, record.ID, claims),
+		"hmac with kid":      hmacToken,
+		"none algorithm":     noneToken,
+		"wrong issuer":       signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.Issuer = "https://evil.example.com" })),
+		"wrong audience":     signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.Audience = jwt.ClaimStrings{"other-api"} })),
+		"missing audience":   signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.Audience = nil })),
+		"expired":            signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })),
+		"missing expiry":     signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.ExpiresAt = nil })),
+		"issued in future":   signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour)) })),
+		"missing jti":        signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.ID = "" })),
+		"subject mismatch":   signTestToken(t, current, record.ID, with(func(c *utils.Claims) { c.Subject = strconv.Itoa(1) })),
+	}
+	for name, token := range cases {
+		if _, err := utils.ParseToken(token, settings); err == nil {
+			t.Fatalf("%s: token accepted", name)
+		}
+	}
+
+	if _, err := utils.ParseToken(signTestToken(t, current, "", claims), settings); !errors.Is(err, utils.ErrMissingKeyID) {
+		t.Fatalf("expected ErrMissingKeyID, got %v", err)
+	}
+	if _, err := utils.ParseToken(signTestToken(t, foreign, foreign.ID, claims), settings); !errors.Is(err, ErrSigningKeyNotFound) {
+		t.Fatalf("expected ErrSigningKeyNotFound, got %v", err)
+	}
+}
+
+func TestSigningKeyRotationKeepsOldTokensUntilRevoked(t *testing.T) {
+	db := newTestDB(t, &models.SigningKey{})
+	keys := newTestSigningKeys(t, db, utils.AlgorithmEdDSA, testSigningSecret)
+	first := addSigningKey(t, keys, time.Now().Add(-time.Hour))
+	settings := testTokenSettings(keys)
+
+	old, err := utils.GenerateToken(5, string(models.RoleStudent), 0, settings, time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := keys.Revoke(first.ID); !errors.Is(err, ErrSigningKeyInUse) {
+		t.Fatalf("expected ErrSigningKeyInUse, got %v", err)
+	}
+
+	second := addSigningKey(t, keys, time.Now())
+	if current, err := keys.SigningKey(); err != nil || current.ID != second.ID {
+		t.Fatalf("expected the new key to sign, got %v, %v", current, err)
+	}
+	if len(keys.JWKS()) != 2 {
+		t.Fatalf("expected both keys published, got %d", len(keys.JWKS()))
+	}
+	if _, err := utils.ParseToken(old, settings); err != nil {
+		t.Fatalf("tokens of the retiring key must still verify: %v", err)
+	}
+
+	records, err := keys.List()
+	if err != nil || len(records) != 2 || records[0].Status != models.SigningKeyActive || records[1].Status != models.SigningKeyRetiring {
+		t.Fatalf("unexpected key list: %+v, %v", records, err)
+	}
+
+	if err := keys.Revoke(first.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := utils.ParseToken(old, settings); err == nil {
+		t.Fatal("tokens of a revoked key must be rejected")
+	}
+	if err := keys.Revoke("missing"); !errors.Is(err, ErrSigningKeyNotFound) {
+		t.Fatalf("expected ErrSigningKeyNotFound, got %v", err)
+	}
+}
+
+func TestSigningKeysSealedWithAnotherSecretAreSkipped(t *testing.T) {
+	db := newTestDB(t, &models.SigningKey{})
+	keys := newTestSigningKeys(t, db, utils.AlgorithmEdDSA, testSigningSecret)
+	record := addSigningKey(t, keys, time.Now())
+
+	var stored models.SigningKey
+	if err := db.First(&stored, "id = ?", record.ID).Error; err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	if der, err := utils.Unseal(stored.PrivateKey, testSigningSecret); err != nil || len(der) == 0 {
+		t.Fatalf("private key must be sealed with SIGNING_KEY_ENCRYPTION_KEY: %v", err)
+	}
+
+	token, err := utils.GenerateToken(5, string(models.RoleStudent), 0, testTokenSettings(keys), time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	wrong := newTestSigningKeys(t, db, utils.AlgorithmEdDSA, "another-secret")
+	if err := wrong.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := wrong.SigningKey(); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
+	if _, err := utils.ParseToken(token, testTokenSettings(wrong)); err == nil {
+		t.Fatal("token verified with a key that could not be unsealed")
+	}
+
+	if _, err := NewSigningKeyService(db, &config.Config{JWTAlgorithm: "HS256"}); !errors.Is(err, utils.ErrUnsupportedAlgorithm) {
+		t.Fatalf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+}
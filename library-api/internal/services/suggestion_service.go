@@ -0,0 +1,409 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+var (
+	ErrSuggestionNotFound   = errors.New("suggestion not found")
+	ErrSuggestionFields     = errors.New("title or isbn and a justification are required")
+	ErrSuggestionClosed     = errors.New("suggestion is closed")
+	ErrInvalidStatus        = errors.New("status must be RECEIVED, APPROVED, ORDERED, REJECTED or AVAILABLE")
+	ErrInvalidTransition    = errors.New("status change not allowed")
+	ErrInvalidSuggestionIDs = errors.New("source_ids must list other open suggestions")
+	ErrBookInCatalog        = errors.New("book already in catalog")
+)
+
+var suggestionTransitions = map[models.SuggestionStatus][]models.SuggestionStatus{
+	models.SuggestionReceived: {models.SuggestionApproved, models.SuggestionRejected},
+	models.SuggestionApproved: {models.SuggestionOrdered, models.SuggestionAvailable, models.SuggestionRejected},
+	models.SuggestionOrdered:  {models.SuggestionAvailable, models.SuggestionRejected},
+	models.SuggestionRejected: {models.SuggestionReceived},
+}
+
+type SuggestionFilter struct {
+	Status models.SuggestionStatus
+	Query  string
+	Sort   string
+	Offset int
+	Limit  int
+}
+
+type suggestionNotice struct {
+	FullName string
+	Title    string
+	BookID   uint
+}
+
+type SuggestionService struct {
+	db   *gorm.DB
+	mail *MailService
+}
+
+func NewSuggestionService(db *gorm.DB, mail *MailService) *SuggestionService {
+	return &SuggestionService{db: db, mail: mail}
+}
+
+func ValidSuggestionStatus(status models.SuggestionStatus) bool {
+	switch status {
+	case models.SuggestionReceived, models.SuggestionApproved, models.SuggestionOrdered, models.SuggestionRejected, models.SuggestionAvailable:
+		return true
+	}
+	return false
+}
+
+func (s *SuggestionService) Create(suggestion *models.Suggestion) (*models.Suggestion, bool, error) {
+	suggestion.Title = strings.Join(strings.Fields(suggestion.Title), " ")
+	suggestion.Author = strings.Join(strings.Fields(suggestion.Author), " ")
+	suggestion.Justification = strings.TrimSpace(suggestion.Justification)
+	if suggestion.ISBN = strings.TrimSpace(suggestion.ISBN); suggestion.ISBN != "" {
+		isbn, err := NormalizeISBN(suggestion.ISBN)
+		if err != nil {
+			return nil, false, err
+		}
+		suggestion.ISBN = isbn
+	}
+	if (suggestion.Title == "" && suggestion.ISBN == "") || suggestion.Justification == "" {
+		return nil, false, ErrSuggestionFields
+	}
+	if suggestion.Title == "" {
+		suggestion.Title = suggestion.ISBN
+	}
+	suggestion.TitleKey = Slugify(suggestion.Title)
+	suggestion.Status = models.SuggestionReceived
+
+	var existing *models.Suggestion
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if exists, err := bookMatchesSuggestion(tx, suggestion); err != nil {
+			return err
+		} else if exists {
+			return ErrBookInCatalog
+		}
+
+		var duplicate models.Suggestion
+		q := openSuggestions(tx)
+		if suggestion.ISBN != "" {
+			q = q.Where("isbn = ? OR (isbn = '' AND title_key = ?)", suggestion.ISBN, suggestion.TitleKey)
+		} else {
+			q = q.Where("title_key = ?", suggestion.TitleKey)
+		}
+		err := q.Order("id ASC").First(&duplicate).Error
+		if err == nil {
+			existing = &duplicate
+			return addSuggestionVote(tx, duplicate.ID, suggestion.UserID, suggestion.EnrollmentID)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Create(suggestion).Error; err != nil {
+			return err
+		}
+		return addSuggestionVote(tx, suggestion.ID, suggestion.UserID, suggestion.EnrollmentID)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		found, err := s.FindByID(existing.ID, suggestion.UserID)
+		return found, true, err
+	}
+	found, err := s.FindByID(suggestion.ID, suggestion.UserID)
+	return found, false, err
+}
+
+func openSuggestions(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.Suggestion{}).
+		Where("merged_into_id IS NULL AND status NOT IN ?", []models.SuggestionStatus{models.SuggestionRejected, models.SuggestionAvailable})
+}
+
+func bookMatchesSuggestion(tx *gorm.DB, suggestion *models.Suggestion) (bool, error) {
+	if suggestion.ISBN == "" {
+		return false, nil
+	}
+	var count int64
+	err := tx.Model(&models.Book{}).Where("isbn = ?", suggestion.ISBN).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *SuggestionService) List(filter SuggestionFilter, userID uint) ([]models.Suggestion, int64, error) {
+	q := s.db.Model(&models.Suggestion{}).Where("merged_into_id IS NULL")
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if query := strings.TrimSpace(filter.Query); query != "" {
+		like := "%" + query + "%"
+		q = q.Where("title ILIKE ? OR author ILIKE ? OR isbn = ?", like, like, query)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "vote_count DESC, created_at ASC"
+	if filter.Sort == "recent" {
+		order = "created_at DESC"
+	}
+	var items []models.Suggestion
+	if err := q.Preload("Book").Order(order).Order("id ASC").Offset(filter.Offset).Limit(filter.Limit).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := s.markVoted(userID, items); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *SuggestionService) FindByID(id uint, userID uint) (*models.Suggestion, error) {
+	var suggestion models.Suggestion
+	if err := s.db.Preload("Book").First(&suggestion, id).Error; err != nil {
+		return nil, ErrSuggestionNotFound
+	}
+	items := []models.Suggestion{suggestion}
+	if err := s.markVoted(userID, items); err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+func (s *SuggestionService) markVoted(userID uint, items []models.Suggestion) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	var voted []uint
+	if err := s.db.Model(&models.SuggestionVote{}).Where("user_id = ? AND suggestion_id IN ?", userID, ids).Pluck("suggestion_id", &voted).Error; err != nil {
+		return err
+	}
+	marked := make(map[uint]bool, len(voted))
+	for _, id := range voted {
+		marked[id] = true
+	}
+	for i := range items {
+		items[i].HasVoted = marked[items[i].ID]
+	}
+	return nil
+}
+
+func (s *SuggestionService) Vote(id uint, userID uint, enrollmentID uint) (*models.Suggestion, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var suggestion models.Suggestion
+		if err := tx.First(&suggestion, id).Error; err != nil {
+			return ErrSuggestionNotFound
+		}
+		if !suggestionOpen(&suggestion) {
+			return ErrSuggestionClosed
+		}
+		return addSuggestionVote(tx, suggestion.ID, userID, enrollmentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(id, userID)
+}
+
+func (s *SuggestionService) Unvote(id uint, userID uint) (*models.Suggestion, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var suggestion models.Suggestion
+		if err := tx.First(&suggestion, id).Error; err != nil {
+			return ErrSuggestionNotFound
+		}
+		if !suggestionOpen(&suggestion) {
+			return ErrSuggestionClosed
+		}
+		if err := tx.Where("suggestion_id = ? AND user_id = ?", id, userID).Delete(&models.SuggestionVote{}).Error; err != nil {
+			return err
+		}
+		return refreshVoteCount(tx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(id, userID)
+}
+
+func suggestionOpen(suggestion *models.Suggestion) bool {
+	return suggestion.MergedIntoID == nil &&
+		suggestion.Status != models.SuggestionRejected &&
+		suggestion.Status != models.SuggestionAvailable
+}
+
+func addSuggestionVote(tx *gorm.DB, suggestionID uint, userID uint, enrollmentID uint) error {
+	vote := models.SuggestionVote{SuggestionID: suggestionID, UserID: userID, EnrollmentID: enrollmentID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&vote).Error; err != nil {
+		return err
+	}
+	return refreshVoteCount(tx, suggestionID)
+}
+
+func refreshVoteCount(tx *gorm.DB, suggestionID uint) error {
+	return tx.Exec("UPDATE suggestions SET vote_count = (SELECT COUNT(*) FROM suggestion_votes WHERE suggestion_id = ?) WHERE id = ?", suggestionID, suggestionID).Error
+}
+
+func (s *SuggestionService) SetStatus(id uint, status models.SuggestionStatus, note string, bookID *uint) (*models.Suggestion, error) {
+	if !ValidSuggestionStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var suggestion models.Suggestion
+		if err := tx.First(&suggestion, id).Error; err != nil {
+			return ErrSuggestionNotFound
+		}
+		if suggestion.MergedIntoID != nil {
+			return ErrSuggestionClosed
+		}
+		allowed := false
+		for _, next := range suggestionTransitions[suggestion.Status] {
+			if next == status {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return ErrInvalidTransition
+		}
+
+		updates := map[string]any{"status": status, "status_note": strings.TrimSpace(note)}
+		if bookID != nil {
+			var book models.Book
+			if err := tx.First(&book, *bookID).Error; err != nil {
+				return ErrBookNotFound
+			}
+			updates["book_id"] = book.ID
+		}
+		if err := tx.Model(&suggestion).Updates(updates).Error; err != nil {
+			return err
+		}
+		if status == models.SuggestionAvailable {
+			return s.notifyAvailable(tx, &suggestion)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(id, 0)
+}
+
+func (s *SuggestionService) Merge(targetID uint, sourceIDs []uint) (*models.Suggestion, error) {
+	sourceIDs = uniqueIDs(sourceIDs)
+	if len(sourceIDs) == 0 {
+		return nil, ErrInvalidSuggestionIDs
+	}
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return nil, ErrInvalidSuggestionIDs
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var target models.Suggestion
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return ErrSuggestionNotFound
+		}
+		if !suggestionOpen(&target) {
+			return ErrSuggestionClosed
+		}
+		var count int64
+		if err := openSuggestions(tx).Where("id IN ?", sourceIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(sourceIDs) {
+			return ErrInvalidSuggestionIDs
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO suggestion_votes (suggestion_id, user_id, enrollment_id, created_at)
+			SELECT ?, user_id, MIN(enrollment_id), MIN(created_at) FROM suggestion_votes WHERE suggestion_id IN ?
+			GROUP BY user_id
+			ON CONFLICT DO NOTHING`, targetID, sourceIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("suggestion_id IN ?", sourceIDs).Delete(&models.SuggestionVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Suggestion{}).Where("id IN ?", sourceIDs).Updates(map[string]any{"merged_into_id": targetID, "vote_count": 0}).Error; err != nil {
+			return err
+		}
+		if target.ISBN == "" {
+			var isbn string
+			if err := tx.Model(&models.Suggestion{}).Where("id IN ? AND isbn <> ''", sourceIDs).Order("id ASC").Limit(1).Pluck("isbn", &isbn).Error; err != nil {
+				return err
+			}
+			if isbn != "" {
+				if err := tx.Model(&target).Update("isbn", isbn).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return refreshVoteCount(tx, targetID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.FindByID(targetID, 0)
+}
+
+func (s *SuggestionService) BookCreated(book *models.Book) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.MatchBook(tx, book)
+	})
+}
+
+func (s *SuggestionService) MatchBook(tx *gorm.DB, book *models.Book) error {
+	q := openSuggestions(tx).Where("book_id IS NULL")
+	if book.ISBN != "" {
+		q = q.Where("isbn = ? OR (isbn = '' AND title_key = ?)", book.ISBN, Slugify(book.Title))
+	} else {
+		q = q.Where("isbn = '' AND title_key = ?", Slugify(book.Title))
+	}
+	var suggestions []models.Suggestion
+	if err := q.Find(&suggestions).Error; err != nil {
+		return err
+	}
+
+	for i := range suggestions {
+		suggestion := &suggestions[i]
+		if suggestion.ISBN == "" && suggestion.Author != "" && !strings.Contains(AuthorKey(book.Author), AuthorKey(suggestion.Author)) {
+			continue
+		}
+		if err := tx.Model(suggestion).Updates(map[string]any{"status": models.SuggestionAvailable, "book_id": book.ID}).Error; err != nil {
+			return err
+		}
+		suggestion.BookID = &book.ID
+		if err := s.notifyAvailable(tx, suggestion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SuggestionService) notifyAvailable(tx *gorm.DB, suggestion *models.Suggestion) error {
+	var users []models.User
+	err := tx.Where("id IN (SELECT user_id FROM suggestion_votes WHERE suggestion_id = ?) OR id = ?", suggestion.ID, suggestion.UserID).
+		Where("email <> ''").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+	var bookID uint
+	if suggestion.BookID != nil {
+		bookID = *suggestion.BookID
+	}
+	for _, user := range users {
+		notice := suggestionNotice{FullName: user.FullName, Title: suggestion.Title, BookID: bookID}
+		if err := s.mail.Enqueue(tx, user.Email, "suggestion_available", user.Locale, notice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/internal/models"
+)
+
+var ErrTagNotFound = errors.New("tag not found")
+
+type TagSummary struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	BookCount int64  `json:"book_count"`
+}
+
+type TagService struct {
+	db *gorm.DB
+}
+
+func NewTagService(db *gorm.DB) *TagService {
+	return &TagService{db: db}
+}
+
+func ParseTagList(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.Join(strings.Fields(tag), " "); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (s *TagService) List(query string) ([]TagSummary, error) {
+	var items []TagSummary
+	q := s.db.Model(&models.Tag{}).
+		Select("tags.id, tags.name, tags.slug, COUNT(b.id) AS book_count").
+		Joins("LEFT JOIN book_tags bt ON bt.tag_id = tags.id").
+		Joins("LEFT JOIN books b ON b.id = bt.book_id AND b.deleted_at IS NULL").
+		Group("tags.id, tags.name, tags.slug").
+		Order("tags.name ASC")
+	if query = strings.TrimSpace(query); query != "" {
+		q = q.Where("tags.name ILIKE ? OR tags.slug LIKE ?", "%"+query+"%", "%"+Slugify(query)+"%")
+	}
+	if err := q.Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *TagService) SetBookTags(bookID uint, names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		if err := tx.First(&book, bookID).Error; err != nil {
+			return ErrBookNotFound
+		}
+		var err error
+		tags, err = setBookTags(tx, &book, names)
+		return err
+	})
+	return tags, err
+}
+
+func setBookTags(tx *gorm.DB, book *models.Book, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		slug := Slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		tag := models.Tag{Name: name, Slug: slug}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+			return nil, err
+		}
+		if tag.ID == 0 {
+			if err := tx.Where("slug = ?", slug).First(&tag).Error; err != nil {
+				return nil, err
+			}
+		}
+		tags = append(tags, tag)
+	}
+	if err := tx.Model(book).Association("Tags").Replace(tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *TagService) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var tag models.Tag
+		if err := tx.First(&tag, id).Error; err != nil {
+			return ErrTagNotFound
+		}
+		if err := tx.Exec("DELETE FROM book_tags WHERE tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const (
+	recoveryCodeCount = 10
+	totpSkew          = 1
+)
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted  = errors.New("two-factor setup has not been started")
+	ErrTwoFactorMandatory   = errors.New("two-factor authentication is mandatory for this account")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+var (
+	recoveryEncoding  = base32.StdEncoding.WithPadding(base32.NoPadding)
+	totpSecretPattern = regexp.MustCompile(`^[A-Z2-7]+=*$`)
+)
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled       bool  `json:"enabled"`
+	Required      bool  `json:"required"`
+	RecoveryCodes int64 `json:"recovery_codes_left"`
+}
+
+type TwoFactorService struct {
+	db            *gorm.DB
+	issuer        string
+	secretKey     string
+	adminRequired bool
+}
+
+func NewTwoFactorService(db *gorm.DB, cfg *config.Config) *TwoFactorService {
+	issuer := strings.TrimSpace(cfg.TOTPIssuer)
+	if issuer == "" {
+		issuer = "Biblioteca"
+	}
+	return &TwoFactorService{db: db, issuer: issuer, secretKey: cfg.TOTPEncryptionKey, adminRequired: cfg.AdminRequire2FA}
+}
+
+func (s *TwoFactorService) MigrateLegacy() error {
+	var users []models.User
+	if err := s.db.Select("id", "totp_secret").Where("totp_secret <> ''").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		if _, err := utils.Unseal(user.TOTPSecret, s.secretKey); err == nil {
+			continue
+		}
+		if !totpSecretPattern.MatchString(user.TOTPSecret) {
+			return fmt.Errorf("totp secret of user %d cannot be opened with TOTP_ENCRYPTION_KEY", user.ID)
+		}
+		sealed, err := utils.Seal([]byte(user.TOTPSecret), s.secretKey)
+		if err != nil {
+			return err
+		}
+		if err := s.db.Model(&models.User{}).Where("id = ? AND totp_secret = ?", user.ID, user.TOTPSecret).Update("totp_secret", sealed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TwoFactorService) Required(user *models.User) bool {
+	return user.TwoFactorEnabled || (s.adminRequired && user.Role == models.RoleAdmin)
+}
+
+func (s *TwoFactorService) Status(userID uint) (*TwoFactorStatus, error) {
+	user, err := s.findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	var remaining int64
+	if err := s.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining).Error; err != nil {
+		return nil, err
+	}
+	return &TwoFactorStatus{Enabled: user.TwoFactorEnabled, Required: s.Required(user), RecoveryCodes: remaining}, nil
+}
+
+func (s *TwoFactorService) Setup(userID uint) (*TwoFactorEnrollment, error) {
+	user, err := s.findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := utils.Seal([]byte(secret), s.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+		"totp_secret":    sealed,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{Secret: secret, URI: utils.TOTPURI(s.issuer, user.DNI, secret)}, nil
+}
+
+func (s *TwoFactorService) Enable(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := s.findUser(tx.Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+		if err != nil {
+			return err
+		}
+		if user.TwoFactorEnabled {
+			return ErrTwoFactorEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrTwoFactorNotStarted
+		}
+		secret, err := s.openSecret(user)
+		if err != nil {
+			return err
+		}
+
+		step, ok := utils.VerifyTOTP(secret, code, time.Now(), totpSkew)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"two_factor_enabled": true,
+			"totp_last_step":     step,
+		}).Error; err != nil {
+			return err
+		}
+
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) Disable(userID uint, code string) error {
+	user, err := s.findUser(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.adminRequired && user.Role == models.RoleAdmin {
+		return ErrTwoFactorMandatory
+	}
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.clear(tx, user.ID, false)
+	})
+}
+
+func (s *TwoFactorService) Verify(user *models.User, code string) error {
+	if !user.TwoFactorEnabled || user.TOTPSecret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	secret, err := s.openSecret(user)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := utils.VerifyTOTP(secret, code, time.Now(), totpSkew); ok {
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	user, err := s.findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) Reset(userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := s.findUser(tx, userID); err != nil {
+			return err
+		}
+		return s.clear(tx, userID, true)
+	})
+}
+
+func (s *TwoFactorService) clear(tx *gorm.DB, userID uint, endSessions bool) error {
+	updates := map[string]any{
+		"two_factor_enabled": false,
+		"totp_secret":        "",
+		"totp_last_step":     0,
+	}
+	if endSessions {
+		updates["session_version"] = gorm.Expr("session_version + 1")
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(normalizeRecoveryCode(code))})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) findUser(db *gorm.DB, userID uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+	return encoded[:5] + "-" + encoded[5:10], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != 10 {
+		return ""
+	}
+	return code
+}
+
+func (s *TwoFactorService) openSecret(user *models.User) (string, error) {
+	secret, err := utils.Unseal(user.TOTPSecret, s.secretKey)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jos3lo89/library-api/config"
+	"github.com/jos3lo89/library-api/internal/models"
+	"github.com/jos3lo89/library-api/pkg/utils"
+)
+
+const testTOTPKey = "totp-test-encryption-key"
+
+type twoFactorFixture struct {
+	db      *gorm.DB
+	service *TwoFactorService
+}
+
+func newTwoFactorFixture(t *testing.T, adminRequired bool) *twoFactorFixture {
+	t.Helper()
+	db := newTestDB(t, &models.User{}, &models.RecoveryCode{})
+	return &twoFactorFixture{
+		db: db,
+		service: NewTwoFactorService(db, &config.Config{
+			TOTPIssuer:        "Biblioteca",
+			TOTPEncryptionKey: testTOTPKey,
+			AdminRequire2FA:   adminRequired,
+		}),
+	}
+}
+
+func (f *twoFactorFixture) createUser(t *testing.T, role models.Role) *models.User {
+	t.Helper()
+	user := &models.User{DNI: "12345678", FullName: "Ana Torres", Role: role, IsActive: true}
+	if err := f.db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func (f *twoFactorFixture) reload(t *testing.T, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := f.db.First(&user, id).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return &user
+}
+
+func (f *twoFactorFixture) enable(t *testing.T, user *models.User) (string, []string) {
+	t.Helper()
+	enrollment, err := f.service.Setup(user.ID)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	codes, err := f.service.Enable(user.ID, totpCode(t, enrollment.Secret, 0))
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("totp code: %v", err)
+	}
+	return code
+}
+
+func TestTwoFactorSetupSealsSecret(t *testing.T) {
+	f := newTwoFactorFixture(t, false)
+	user := f.createUser(t, models.RoleStudent)
+
+	enrollment, err := f.service.Setup(user.ID)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+		t.Fatalf("unexpected enrollment: %+v", enrollment)
+	}
+	stored := f.reload(t, user.ID)
+	if stored.TOTPSecret == "" || strings.Contains(stored.TOTPSecret, enrollment.Secret) || stored.TwoFactorEnabled {
+		t.Fatalf("secret must be stored sealed and 2FA left disabled: %+v", stored)
+	}
+	if opened, err := utils.Unseal(stored.TOTPSecret, testTOTPKey); err != nil || string(opened) != enrollment.Secret {
+		t.Fatalf("unseal: %q, %v", opened, err)
+	}
+
+	if _, err := f.service.Enable(user.ID, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+	if _, err := f.service.Enable(user.ID, totpCode(t, enrollment.Secret, 0)); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if _, err := f.service.Setup(user.ID); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Fatalf("expected ErrTwoFactorEnabled, got %v", err)
+	}
+}
+
+func TestTwoFactorVerifyRejectsReplayedStep(t *testing.T) {
+	f := newTwoFactorFixture(t, false)
+	user := f.createUser(t, models.RoleStudent)
+	secret, _ := f.enable(t, user)
+
+	if err := f.service.Verify(f.reload(t, user.ID), totpCode(t, secret, 0)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("code used to enable must not verify again, got %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), totpCode(t, secret, -1)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("earlier step must be rejected, got %v", err)
+	}
+
+	step := utils.TOTPStep(time.Now()) + 1
+	next, err := utils.TOTPCode(secret, step)
+	if err != nil {
+		t.Fatalf("totp code: %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), next); err != nil {
+		t.Fatalf("next step: %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), next); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("replayed step must be rejected, got %v", err)
+	}
+	if stored := f.reload(t, user.ID); stored.TOTPLastStep != step {
+		t.Fatalf("unexpected last step %d", stored.TOTPLastStep)
+	}
+}
+
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	f := newTwoFactorFixture(t, false)
+	user := f.createUser(t, models.RoleStudent)
+	_, codes := f.enable(t, user)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	var stored []models.RecoveryCode
+	f.db.Where("user_id = ?", user.ID).Find(&stored)
+	for _, record := range stored {
+		for _, code := range codes {
+			if strings.Contains(record.CodeHash, strings.ReplaceAll(code, "-", "")) {
+				t.Fatal("recovery codes must be stored hashed")
+			}
+		}
+	}
+
+	formatted := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if err := f.service.Verify(f.reload(t, user.ID), formatted); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), codes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("used recovery code must be rejected, got %v", err)
+	}
+	for _, code := range []string{"", "abcde-fghij", "short"} {
+		if err := f.service.Verify(f.reload(t, user.ID), code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("%q: expected ErrInvalidTwoFactorCode, got %v", code, err)
+		}
+	}
+
+	status, err := f.service.Status(user.ID)
+	if err != nil || !status.Enabled || status.RecoveryCodes != recoveryCodeCount-1 {
+		t.Fatalf("unexpected status: %+v, %v", status, err)
+	}
+
+	fresh, err := f.service.RegenerateRecoveryCodes(user.ID, codes[1])
+	if err != nil {
+		t.Fatalf("regenerate: %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), codes[2]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("old recovery codes must be replaced, got %v", err)
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), fresh[0]); err != nil {
+		t.Fatalf("new recovery code: %v", err)
+	}
+}
+
+func TestTwoFactorDisableAndReset(t *testing.T) {
+	f := newTwoFactorFixture(t, true)
+	admin := f.createUser(t, models.RoleAdmin)
+	_, codes := f.enable(t, admin)
+
+	if err := f.service.Disable(admin.ID, codes[0]); !errors.Is(err, ErrTwoFactorMandatory) {
+		t.Fatalf("expected ErrTwoFactorMandatory, got %v", err)
+	}
+
+	before := f.reload(t, admin.ID).SessionVersion
+	if err := f.service.Reset(admin.ID); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	stored := f.reload(t, admin.ID)
+	if stored.TwoFactorEnabled || stored.TOTPSecret != "" || stored.SessionVersion != before+1 {
+		t.Fatalf("unexpected user after reset: %+v", stored)
+	}
+	if !f.service.Required(stored) {
+		t.Fatal("admins must still be required to enroll")
+	}
+	var remaining int64
+	f.db.Model(&models.RecoveryCode{}).Where("user_id = ?", admin.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected recovery codes removed, got %d", remaining)
+	}
+	if err := f.service.Verify(stored, codes[1]); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Fatalf("expected ErrTwoFactorNotEnabled, got %v", err)
+	}
+}
+
+func TestTwoFactorMigrateLegacySecrets(t *testing.T) {
+	f := newTwoFactorFixture(t, false)
+	user := f.createUser(t, models.RoleStudent)
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("secret: %v", err)
+	}
+	f.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{"totp_secret": secret, "two_factor_enabled": true})
+
+	if err := f.service.MigrateLegacy(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	sealed := f.reload(t, user.ID).TOTPSecret
+	if sealed == secret {
+		t.Fatal("legacy secret left in plain text")
+	}
+	if err := f.service.Verify(f.reload(t, user.ID), totpCode(t, secret, 0)); err != nil {
+		t.Fatalf("verify after migration: %v", err)
+	}
+	if err := f.service.MigrateLegacy(); err != nil || f.reload(t, user.ID).TOTPSecret != sealed {
+		t.Fatalf("migration must be idempotent: %v", err)
+	}
+
+	f.db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_secret", "not a secret!")
+	if err := f.service.MigrateLegacy(); err == nil {
+		t.Fatal("expected error for a secret sealed with another key")
+	}
+}
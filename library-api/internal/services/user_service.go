@@ -8,20 +8,35 @@ import (
 )
 
 type UserService struct {
-	db *gorm.DB
+	db   *gorm.DB
+	mail *MailService
+	dni  *DNIFormat
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, mail *MailService, dni *DNIFormat) *UserService {
+	return &UserService{db: db, mail: mail, dni: dni}
 }
 
 func (s *UserService) CreateUser(user *models.User, password string) error {
+	dni, err := s.dni.Normalize(user.DNI)
+	if err != nil {
+		return err
+	}
+	user.DNI = dni
 	hashed, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
 	user.PasswordHash = hashed
-	return s.db.Create(user).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if user.Email == "" {
+			return nil
+		}
+		return s.mail.Enqueue(tx, user.Email, "welcome", user.Locale, user)
+	})
 }
 
 func (s *UserService) FindByID(id uint) (*models.User, error) {
@@ -1,38 +1,90 @@
 package utils
 
 import (
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var ErrMissingKeyID = errors.New("token has no kid header")
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID         uint   `json:"user_id"`
+	Role           string `json:"role"`
+	SessionVersion uint   `json:"sv"`
+	Scope          string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, role string, secret string, expiresIn time.Duration) (string, error) {
+type KeyStore interface {
+	SigningKey() (*SigningKey, error)
+	VerificationKey(kid string) (*SigningKey, error)
+}
+
+type TokenSettings struct {
+	Keys     KeyStore
+	Issuer   string
+	Audience string
+}
+
+func GenerateToken(userID uint, role string, sessionVersion uint, settings *TokenSettings, expiresIn time.Duration) (string, error) {
+	return GenerateScopedToken(userID, role, sessionVersion, "", settings, expiresIn)
+}
+
+func GenerateScopedToken(userID uint, role string, sessionVersion uint, scope string, settings *TokenSettings, expiresIn time.Duration) (string, error) {
+	key, err := settings.Keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:         userID,
+		Role:           role,
+		SessionVersion: sessionVersion,
+		Scope:          scope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    settings.Issuer,
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			Audience:  jwt.ClaimStrings{settings.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-func ParseToken(tokenString string, secret string) (*Claims, error) {
+func ParseToken(tokenString string, settings *TokenSettings) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+		key, err := settings.Keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, jwt.ErrTokenSignatureInvalid
 		}
-		return []byte(secret), nil
-	})
+		return key.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(settings.Issuer),
+		jwt.WithAudience(settings.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +93,9 @@ func ParseToken(tokenString string, secret string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
+	if claims.ID == "" || claims.Subject != strconv.FormatUint(uint64(claims.UserID), 10) {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
 
 	return claims, nil
 }